@@ -0,0 +1,268 @@
+package archive
+
+import (
+	"bytes"
+	"io/ioutil"
+	"os"
+	"path"
+	"strconv"
+	"testing"
+)
+
+func writeProfile(t *testing.T, basePath string, id int, data string) string {
+	p := path.Join(basePath, strconv.Itoa(id/1000000), strconv.Itoa(id/1000%1000), strconv.Itoa(id%1000), "photo.jpg")
+	if err := os.MkdirAll(path.Dir(p), 0777); err != nil {
+		t.Fatal(err)
+	}
+	if err := ioutil.WriteFile(p, []byte(data), 0666); err != nil {
+		t.Fatal(err)
+	}
+	return p
+}
+
+func TestArchiveRestore(t *testing.T) {
+	dir, err := ioutil.TempDir("", "archive")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	basePath := path.Join(dir, "deepavatar", "Jiayuan")
+	desFolder := path.Join(dir, "avatar_tars")
+	os.MkdirAll(path.Join(desFolder, "Jiayuan"), 0777)
+
+	first := writeProfile(t, basePath, 100010001, "first")
+	second := writeProfile(t, basePath, 100015002, "second")
+
+	if err := Archive(100010000, 100020000, desFolder, "Jiayuan", basePath); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := os.Stat(first); !os.IsNotExist(err) {
+		t.Fatalf("%s should be deleted after archiving", first)
+	}
+
+	stats, err := Restore(100010001, 100010002, desFolder, "Jiayuan", basePath)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if stats.Restored != 1 {
+		t.Fatalf("Restored %d files, want 1", stats.Restored)
+	}
+	if data, err := ioutil.ReadFile(first); err != nil || string(data) != "first" {
+		t.Fatalf("Restored %q, %v", data, err)
+	}
+	if _, err := os.Stat(second); !os.IsNotExist(err) {
+		t.Fatalf("%s is out of range and should not be restored", second)
+	}
+
+	stats, err = Restore(100010000, 100020000, desFolder, "Jiayuan", basePath)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if stats.Restored != 1 || stats.Skipped != 1 {
+		t.Fatalf("Restored %d and skipped %d files, want 1 and 1", stats.Restored, stats.Skipped)
+	}
+}
+
+func TestFetchFromIndex(t *testing.T) {
+	dir, err := ioutil.TempDir("", "archive")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	basePath := path.Join(dir, "deepavatar", "Baihe")
+	desFolder := path.Join(dir, "avatar_tars")
+	os.MkdirAll(path.Join(desFolder, "Baihe"), 0777)
+
+	for id := 200000000; id < 200000005; id++ {
+		writeProfile(t, basePath, id, strconv.Itoa(id))
+	}
+	if err := Archive(200000000, 200010000, desFolder, "Baihe", basePath); err != nil {
+		t.Fatal(err)
+	}
+	index, err := readIndex(ArchivePath(desFolder, "Baihe", 200000000, 200010000))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(index.Profiles) != 5 {
+		t.Fatalf("Indexed %d profiles, want 5", len(index.Profiles))
+	}
+
+	stats, err := FetchProfile(200000003, desFolder, "Baihe", basePath)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if stats.Restored != 1 {
+		t.Fatalf("Restored %d files, want 1", stats.Restored)
+	}
+
+	var buf bytes.Buffer
+	if err := FetchFile("/200/0/4/photo.jpg", desFolder, "Baihe", &buf); err != nil {
+		t.Fatal(err)
+	}
+	if buf.String() != "200000004" {
+		t.Fatalf("Fetched %q, want 200000004", buf.String())
+	}
+}
+
+func TestTrackerWaitsForRange(t *testing.T) {
+	dir, err := ioutil.TempDir("", "archive")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	basePath := path.Join(dir, "deepavatar", "Jiayuan")
+	desFolder := path.Join(dir, "avatar_tars")
+	os.MkdirAll(path.Join(desFolder, "Jiayuan"), 0777)
+	desFile := ArchivePath(desFolder, "Jiayuan", 100000000, 100000000+ArchiveSize)
+
+	tracker := NewTracker(desFolder, "Jiayuan", basePath, 100000000, 100020000)
+	for id := 100000000; id < 100000000+ArchiveSize; id++ {
+		tracker.Start(id)
+	}
+	for id := 100000001; id < 100000000+ArchiveSize; id++ {
+		tracker.Done(id)
+	}
+	tracker.Wait()
+	if _, err := os.Stat(desFile); !os.IsNotExist(err) {
+		t.Fatal("Range archived while an Id is still running")
+	}
+	progress, err := ReadProgress(desFolder, "Jiayuan")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if progress.Complete(100000000, 100000000+ArchiveSize) {
+		t.Fatal("Range complete while an Id is still running")
+	}
+
+	writeProfile(t, basePath, 100000000, "late")
+	tracker.Done(100000000)
+	tracker.Wait()
+	if _, err := os.Stat(desFile); err != nil {
+		t.Fatal(err)
+	}
+	progress, err = ReadProgress(desFolder, "Jiayuan")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !progress.Complete(100000000, 100000000+ArchiveSize) || progress.FirstId() != 100000000 {
+		t.Fatalf("Progress %+v, want the range complete", progress.Tasks[0])
+	}
+}
+
+func TestResumeInterruptedArchive(t *testing.T) {
+	dir, err := ioutil.TempDir("", "archive")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	basePath := path.Join(dir, "deepavatar", "Jiayuan")
+	desFolder := path.Join(dir, "avatar_tars")
+	os.MkdirAll(path.Join(desFolder, "Jiayuan"), 0777)
+	p := writeProfile(t, basePath, 100020001, "interrupted")
+
+	// A crash while writing leaves the range in the archiving state.
+	r := RangeState{StartId: 100020000, EndId: 100030000, State: RangeArchiving}
+	if err := setRangeState(desFolder, "Jiayuan", r); err != nil {
+		t.Fatal(err)
+	}
+	if err := Resume(desFolder, "Jiayuan", basePath); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := os.Stat(p); !os.IsNotExist(err) {
+		t.Fatalf("%s should be deleted after archiving", p)
+	}
+	state, err := ReadState(desFolder, "Jiayuan")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if r := state.Find(100020000); r == nil || r.State != RangeCleaned || r.Files != 1 {
+		t.Fatalf("Range state %+v, want 1 file cleaned", r)
+	}
+
+	// An interrupted Build is built again, keeping its sources for Clean.
+	kept := writeProfile(t, basePath, 100030001, "kept")
+	r = RangeState{StartId: 100030000, EndId: 100040000, State: RangeArchiving, Keep: true}
+	if err := setRangeState(desFolder, "Jiayuan", r); err != nil {
+		t.Fatal(err)
+	}
+	if err := Resume(desFolder, "Jiayuan", basePath); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := os.Stat(kept); err != nil {
+		t.Fatalf("%s should be kept after building again: %v", kept, err)
+	}
+	if state, err = ReadState(desFolder, "Jiayuan"); err != nil {
+		t.Fatal(err)
+	}
+	if r := state.Find(100030000); r == nil || r.State != RangeKept || r.Files != 1 {
+		t.Fatalf("Range state %+v, want 1 file kept", r)
+	}
+}
+
+func TestBuildKeepsSourcesUntilClean(t *testing.T) {
+	dir, err := ioutil.TempDir("", "archive")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	basePath := path.Join(dir, "deepavatar", "Baihe")
+	desFolder := path.Join(dir, "avatar_tars")
+	p := writeProfile(t, basePath, 200010001, "kept")
+
+	if err := Build(200010000, 200020000, desFolder, "Baihe", basePath); err != nil {
+		t.Fatal(err)
+	}
+	// Resume leaves kept ranges to Clean.
+	if err := Resume(desFolder, "Baihe", basePath); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := os.Stat(p); err != nil {
+		t.Fatalf("%s should be kept until cleaned: %v", p, err)
+	}
+	if err := Clean(200010000, desFolder, "Baihe", basePath); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := os.Stat(p); !os.IsNotExist(err) {
+		t.Fatalf("%s should be deleted once cleaned", p)
+	}
+	if err := Clean(200010000, desFolder, "Baihe", basePath); err != nil {
+		t.Fatalf("Cleaning twice: %v", err)
+	}
+	if err := Clean(200020000, desFolder, "Baihe", basePath); err == nil {
+		t.Fatal("Cleaned a range never archived")
+	}
+}
+
+func TestRangeStatesRecordedConcurrently(t *testing.T) {
+	dir, err := ioutil.TempDir("", "archive")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	os.MkdirAll(path.Join(dir, "Jiayuan"), 0777)
+
+	// Each writer locks the state file on its own, as separate scrapers do.
+	done := make(chan error)
+	for i := 0; i < 20; i++ {
+		go func(i int) {
+			done <- setRangeState(dir, "Jiayuan", RangeState{StartId: i * ArchiveSize, EndId: (i + 1) * ArchiveSize, State: RangeCleaned})
+		}(i)
+	}
+	for i := 0; i < 20; i++ {
+		if err := <-done; err != nil {
+			t.Fatal(err)
+		}
+	}
+	state, err := ReadState(dir, "Jiayuan")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(state.Ranges) != 20 {
+		t.Fatalf("Recorded %d ranges, want 20", len(state.Ranges))
+	}
+}
@@ -0,0 +1,276 @@
+package archive
+
+import (
+	"archive/tar"
+	"compress/gzip"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"github.com/charleswong/scraper/util"
+	"io"
+	"io/ioutil"
+	"log"
+	"os"
+	"path"
+)
+
+// IndexSuffix is appended to an archive file name to get its index file.
+const IndexSuffix = ".idx"
+
+// Index records where the gzip member holding each profile starts in an
+// archive, so that one profile can be read without decompressing the whole
+// archive. Every profile of an indexed archive is written as its own gzip
+// member; concatenated members are still a valid tar.gz.
+type Index struct {
+	Profiles []*ProfileEntry
+}
+
+type ProfileEntry struct {
+	Id     int
+	Offset int64
+	Size   int64
+	Files  []string
+}
+
+func (index *Index) find(id int) *ProfileEntry {
+	for _, p := range index.Profiles {
+		if p.Id == id {
+			return p
+		}
+	}
+	return nil
+}
+
+type countingWriter struct {
+	w io.Writer
+	n int64
+}
+
+func (c *countingWriter) Write(p []byte) (int, error) {
+	n, err := c.w.Write(p)
+	c.n += int64(n)
+	return n, err
+}
+
+// memberWriter is a gzip writer that starts a new gzip member whenever the
+// archived profile changes and records the members in an Index.
+type memberWriter struct {
+	out     *countingWriter
+	gz      *gzip.Writer
+	index   *Index
+	current *ProfileEntry
+}
+
+func newMemberWriter(w io.Writer) *memberWriter {
+	out := &countingWriter{w: w}
+	return &memberWriter{
+		out:   out,
+		gz:    gzip.NewWriter(out),
+		index: &Index{Profiles: make([]*ProfileEntry, 0)},
+	}
+}
+
+func (m *memberWriter) Write(p []byte) (int, error) {
+	return m.gz.Write(p)
+}
+
+// Begin must be called before the header of every file written to tw.
+func (m *memberWriter) Begin(tw *tar.Writer, id int, name string) error {
+	if m.current == nil || m.current.Id != id {
+		if m.current != nil {
+			if err := tw.Flush(); err != nil {
+				return err
+			}
+			if err := m.closeMember(); err != nil {
+				return err
+			}
+			m.gz.Reset(m.out)
+		}
+		m.current = &ProfileEntry{Id: id, Offset: m.out.n}
+		m.index.Profiles = append(m.index.Profiles, m.current)
+	}
+	m.current.Files = append(m.current.Files, name)
+	return nil
+}
+
+func (m *memberWriter) closeMember() error {
+	err := m.gz.Close()
+	if m.current != nil {
+		m.current.Size = m.out.n - m.current.Offset
+	}
+	return err
+}
+
+func (m *memberWriter) Close() error {
+	return m.closeMember()
+}
+
+func writeIndex(index *Index, archive string) error {
+	bytes, err := json.Marshal(index)
+	if err != nil {
+		return err
+	}
+	return util.WriteFileAtomic(archive+IndexSuffix, bytes, 0666)
+}
+
+func readIndex(archive string) (*Index, error) {
+	bytes, err := ioutil.ReadFile(archive + IndexSuffix)
+	if err != nil {
+		return nil, err
+	}
+	index := &Index{}
+	err = json.Unmarshal(bytes, index)
+	if err != nil {
+		return nil, err
+	}
+	return index, nil
+}
+
+func findArchive(id int, desFolder, subDesFolder string) (*archiveFile, error) {
+	archives, err := listArchives(desFolder, subDesFolder)
+	if err != nil {
+		return nil, err
+	}
+	for _, a := range archives {
+		if a.StartId <= id && id < a.EndId {
+			return a, nil
+		}
+	}
+	return nil, fmt.Errorf("No archive of %s covers Id %d", subDesFolder, id)
+}
+
+type profileReader struct {
+	*tar.Reader
+	file *os.File
+}
+
+func (r *profileReader) Close() error {
+	return r.file.Close()
+}
+
+// openProfile returns a tar reader over the gzip member holding profile id.
+func openProfile(archive string, index *Index, id int) (*profileReader, error) {
+	entry := index.find(id)
+	if entry == nil {
+		return nil, fmt.Errorf("Id %d is not in %s", id, archive)
+	}
+	file, err := os.Open(archive)
+	if err != nil {
+		return nil, err
+	}
+	if _, err := file.Seek(entry.Offset, io.SeekStart); err != nil {
+		file.Close()
+		return nil, err
+	}
+	gz, err := gzip.NewReader(io.LimitReader(file, entry.Size))
+	if err != nil {
+		file.Close()
+		return nil, err
+	}
+	gz.Multistream(false)
+	return &profileReader{Reader: tar.NewReader(gz), file: file}, nil
+}
+
+// FetchProfile extracts the files of profile id from its archive into
+// basePath. Only the profile's gzip member is read when the archive has an
+// index; older archives are scanned.
+func FetchProfile(id int, desFolder, subDesFolder, basePath string) (*RestoreStats, error) {
+	a, err := findArchive(id, desFolder, subDesFolder)
+	if err != nil {
+		log.Println(err)
+		return nil, err
+	}
+	stats := &RestoreStats{}
+	index, err := readIndex(a.Path)
+	if err != nil {
+		log.Printf("No index for %s, scanning the archive.\n", a.Path)
+		err = restoreArchive(id, id+1, a.Path, basePath, stats)
+		return stats, err
+	}
+
+	r, err := openProfile(a.Path, index, id)
+	if err != nil {
+		log.Println(err)
+		return nil, err
+	}
+	defer r.Close()
+	for {
+		h, err := r.Next()
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			return stats, err
+		}
+		p := memberFile(basePath, h.Name)
+		if _, err := os.Stat(p); err == nil {
+			stats.Skipped++
+			continue
+		}
+		err = extractMember(r, h, p)
+		if err != nil {
+			return stats, err
+		}
+		stats.Restored++
+	}
+	log.Printf("Fetched Id %d from %s: %d files restored, %d skipped.\n", id, a.Path, stats.Restored, stats.Skipped)
+	return stats, nil
+}
+
+// FetchFile writes one archived file, named like "/100/210/541/x.jpg", to w.
+func FetchFile(name string, desFolder, subDesFolder string, w io.Writer) error {
+	name = path.Clean("/" + name)
+	id, err := memberId(name)
+	if err != nil {
+		return err
+	}
+	a, err := findArchive(id, desFolder, subDesFolder)
+	if err != nil {
+		return err
+	}
+
+	var tr *tar.Reader
+	index, err := readIndex(a.Path)
+	if err == nil {
+		r, err := openProfile(a.Path, index, id)
+		if err != nil {
+			return err
+		}
+		defer r.Close()
+		tr = r.Reader
+	} else {
+		file, err := os.Open(a.Path)
+		if err != nil {
+			return err
+		}
+		defer file.Close()
+		gz, err := gzip.NewReader(file)
+		if err != nil {
+			return err
+		}
+		tr = tar.NewReader(gz)
+	}
+
+	for {
+		h, err := tr.Next()
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			return err
+		}
+		if path.Clean("/"+h.Name) != name {
+			continue
+		}
+		hash := sha256.New()
+		if _, err := io.Copy(io.MultiWriter(w, hash), tr); err != nil {
+			return err
+		}
+		if sum, ok := h.PAXRecords[ChecksumRecord]; ok && sum != hex.EncodeToString(hash.Sum(nil)) {
+			return fmt.Errorf("Checksum mismatch for %s", h.Name)
+		}
+		return nil
+	}
+	return fmt.Errorf("%s is not in %s", name, a.Path)
+}
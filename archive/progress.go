@@ -0,0 +1,119 @@
+package archive
+
+import (
+	"encoding/json"
+	"github.com/charleswong/scraper/util"
+	"io/ioutil"
+	"os"
+	"path"
+	"time"
+)
+
+// ProgressFile is written by the scraper next to the archives of a site. For
+// every task it records the watermark below which every Id has been crawled
+// and every complete range handed to Archive, so other programs know which
+// ranges the scraper no longer writes to.
+const ProgressFile = "scraper.progress"
+
+type TaskProgress struct {
+	// Site is the folder of the site the task crawls.
+	Site      string
+	BeginId   int
+	EndId     int
+	Watermark int
+	UpdatedTs int64
+}
+
+type Progress struct {
+	Tasks []*TaskProgress
+}
+
+func progressPath(desFolder, subDesFolder string) string {
+	return path.Join(desFolder, subDesFolder, ProgressFile)
+}
+
+func readProgress(desFolder, subDesFolder string) (*Progress, error) {
+	p := &Progress{Tasks: make([]*TaskProgress, 0)}
+	bytes, err := ioutil.ReadFile(progressPath(desFolder, subDesFolder))
+	if os.IsNotExist(err) {
+		return p, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	err = json.Unmarshal(bytes, p)
+	if err != nil {
+		return nil, err
+	}
+	return p, nil
+}
+
+// ReadProgress returns the scraper progress of a site. It has no task when
+// the scraper never ran for the site.
+func ReadProgress(desFolder, subDesFolder string) (*Progress, error) {
+	return readProgress(desFolder, subDesFolder)
+}
+
+// Complete reports whether no task will write to Id from startId to endId-1
+// anymore.
+func (p *Progress) Complete(startId, endId int) bool {
+	if len(p.Tasks) == 0 {
+		return false
+	}
+	for _, t := range p.Tasks {
+		if endId > t.Watermark && startId < t.EndId {
+			return false
+		}
+	}
+	return true
+}
+
+// FirstId returns the lowest Id any task started from.
+func (p *Progress) FirstId() int {
+	first := -1
+	for _, t := range p.Tasks {
+		if first < 0 || t.BeginId < first {
+			first = t.BeginId
+		}
+	}
+	return first
+}
+
+// setTaskProgress records the progress of the task of site t.Site ending at
+// t.EndId, with the progress file locked like the state file.
+func setTaskProgress(desFolder, subDesFolder string, t TaskProgress) error {
+	err := os.MkdirAll(path.Join(desFolder, subDesFolder), 0777)
+	if err != nil {
+		return err
+	}
+	lock, err := util.WaitLockFile(progressPath(desFolder, subDesFolder) + ".lock")
+	if err != nil {
+		return err
+	}
+	defer lock.Close()
+	p, err := readProgress(desFolder, subDesFolder)
+	if err != nil {
+		return err
+	}
+	t.UpdatedTs = time.Now().Unix()
+	found := false
+	for _, old := range p.Tasks {
+		// Files from before Site was recorded hold the site of their folder.
+		if (old.Site == t.Site || len(old.Site) == 0) && old.EndId == t.EndId {
+			// Keep where the task started before a restart.
+			if old.BeginId < t.BeginId {
+				t.BeginId = old.BeginId
+			}
+			*old = t
+			found = true
+		}
+	}
+	if !found {
+		p.Tasks = append(p.Tasks, &t)
+	}
+	bytes, err := json.Marshal(p)
+	if err != nil {
+		return err
+	}
+	return util.WriteFileAtomic(progressPath(desFolder, subDesFolder), bytes, 0666)
+}
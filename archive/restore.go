@@ -0,0 +1,208 @@
+package archive
+
+import (
+	"archive/tar"
+	"compress/gzip"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"log"
+	"os"
+	"path"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+type archiveFile struct {
+	StartId int
+	EndId   int
+	Path    string
+}
+
+// ArchivePath is where the archive of Id from startId to endId-1 is kept.
+func ArchivePath(desFolder, subDesFolder string, startId, endId int) string {
+	return fmt.Sprintf("%s/%s/%d-%d.tar.gz", desFolder, subDesFolder, startId, endId-1)
+}
+
+// listArchives returns the archives of a site sorted by StartId. EndId is
+// exclusive like everywhere else in this package.
+func listArchives(desFolder, subDesFolder string) ([]*archiveFile, error) {
+	dir := path.Join(desFolder, subDesFolder)
+	files, err := ioutil.ReadDir(dir)
+	if err != nil {
+		return nil, err
+	}
+	archives := make([]*archiveFile, 0)
+	for _, f := range files {
+		name := f.Name()
+		if f.IsDir() || !strings.HasSuffix(name, ".tar.gz") {
+			continue
+		}
+		ids := strings.Split(strings.TrimSuffix(name, ".tar.gz"), "-")
+		if len(ids) != 2 {
+			continue
+		}
+		startId, err := strconv.Atoi(ids[0])
+		if err != nil {
+			continue
+		}
+		lastId, err := strconv.Atoi(ids[1])
+		if err != nil {
+			continue
+		}
+		archives = append(archives, &archiveFile{
+			StartId: startId,
+			EndId:   lastId + 1,
+			Path:    path.Join(dir, name),
+		})
+	}
+	sort.Slice(archives, func(i, j int) bool {
+		return archives[i].StartId < archives[j].StartId
+	})
+	return archives, nil
+}
+
+// memberId returns the profile Id a member such as "/100/210/541/x.jpg"
+// belongs to.
+func memberId(name string) (int, error) {
+	parts := strings.Split(strings.TrimPrefix(name, "/"), "/")
+	if len(parts) < 4 {
+		return 0, fmt.Errorf("Invalid archive member %s", name)
+	}
+	id := 0
+	for _, p := range parts[:3] {
+		n, err := strconv.Atoi(p)
+		if err != nil {
+			return 0, fmt.Errorf("Invalid archive member %s", name)
+		}
+		id = id*1000 + n
+	}
+	return id, nil
+}
+
+// memberFile returns where member name is restored under basePath. Names
+// are cleaned so that no member escapes basePath.
+func memberFile(basePath, name string) string {
+	return filepath.Join(basePath, filepath.FromSlash(path.Clean("/"+name)))
+}
+
+type RestoreStats struct {
+	Restored int
+	Skipped  int
+}
+
+// extractMember writes the current member of r to p through a temporary
+// file, verifying the checksum recorded when the member was archived.
+func extractMember(r io.Reader, h *tar.Header, p string) error {
+	err := os.MkdirAll(path.Dir(p), 0777)
+	if err != nil {
+		return err
+	}
+	tmp := p + ".tmp"
+	f, err := os.Create(tmp)
+	if err != nil {
+		return err
+	}
+	hash := sha256.New()
+	_, err = io.Copy(io.MultiWriter(f, hash), r)
+	if closeErr := f.Close(); err == nil {
+		err = closeErr
+	}
+	if err == nil {
+		if sum, ok := h.PAXRecords[ChecksumRecord]; ok && sum != hex.EncodeToString(hash.Sum(nil)) {
+			err = fmt.Errorf("Checksum mismatch for %s", h.Name)
+		}
+	}
+	if err != nil {
+		os.Remove(tmp)
+		return err
+	}
+	return os.Rename(tmp, p)
+}
+
+func restoreArchive(startId, endId int, archive string, basePath string, stats *RestoreStats) error {
+	file, err := os.Open(archive)
+	if err != nil {
+		return err
+	}
+	defer file.Close()
+
+	gz, err := gzip.NewReader(file)
+	if err != nil {
+		return err
+	}
+	defer gz.Close()
+
+	tr := tar.NewReader(gz)
+	for {
+		h, err := tr.Next()
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			return err
+		}
+		if h.Typeflag != tar.TypeReg {
+			continue
+		}
+		id, err := memberId(h.Name)
+		if err != nil {
+			log.Println(err)
+			continue
+		}
+		if id < startId || id >= endId {
+			continue
+		}
+		p := memberFile(basePath, h.Name)
+		if _, err := os.Stat(p); err == nil {
+			stats.Skipped++
+			continue
+		}
+		err = extractMember(tr, h, p)
+		if err != nil {
+			return err
+		}
+		stats.Restored++
+	}
+	// Drain the stream so gzip verifies the trailing CRC.
+	_, err = io.Copy(ioutil.Discard, gz)
+	return err
+}
+
+// Restore extracts the files of Id from startId to endId-1 from the archives
+// in desFolder/subDesFolder back into basePath, using the same layout the
+// scraper writes. Files that already exist are left untouched.
+func Restore(startId, endId int, desFolder, subDesFolder, basePath string) (*RestoreStats, error) {
+	if startId >= endId {
+		return nil, errors.New("Invalid Id range to restore.")
+	}
+	archives, err := listArchives(desFolder, subDesFolder)
+	if err != nil {
+		log.Println(err)
+		return nil, err
+	}
+	stats := &RestoreStats{}
+	found := false
+	for _, a := range archives {
+		if a.EndId <= startId || a.StartId >= endId {
+			continue
+		}
+		found = true
+		err := restoreArchive(startId, endId, a.Path, basePath, stats)
+		if err != nil {
+			log.Printf("Failed to restore %s: %v\n", a.Path, err)
+			return stats, err
+		}
+		log.Printf("Restored %s into %s.\n", a.Path, basePath)
+	}
+	if !found {
+		return stats, fmt.Errorf("No archive of %s covers Id from %d to %d", subDesFolder, startId, endId-1)
+	}
+	log.Printf("Restored Id from %d to %d: %d files restored, %d skipped.\n", startId, endId-1, stats.Restored, stats.Skipped)
+	return stats, nil
+}
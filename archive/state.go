@@ -0,0 +1,102 @@
+package archive
+
+import (
+	"encoding/json"
+	"github.com/charleswong/scraper/util"
+	"io/ioutil"
+	"os"
+	"path"
+	"sort"
+)
+
+// StateFile is kept next to the archives of a site and records how far each
+// range got, so an interrupted archive can be redone on restart.
+const StateFile = "archive.state"
+
+const (
+	// The archive of the range is being written; sources are intact.
+	RangeArchiving = "archiving"
+	// The archive is written and verified; sources may still exist.
+	RangeArchived = "archived"
+	// The archive is written and verified; sources are kept until Clean.
+	RangeKept = "kept"
+	// The sources of the range have been deleted.
+	RangeCleaned = "cleaned"
+)
+
+type RangeState struct {
+	StartId int
+	EndId   int
+	State   string
+	Files   int
+	// Keep tells the range is built by Build, which keeps its sources.
+	Keep bool
+}
+
+type ArchiveState struct {
+	Ranges []*RangeState
+}
+
+func statePath(desFolder, subDesFolder string) string {
+	return path.Join(desFolder, subDesFolder, StateFile)
+}
+
+func readState(desFolder, subDesFolder string) (*ArchiveState, error) {
+	s := &ArchiveState{Ranges: make([]*RangeState, 0)}
+	bytes, err := ioutil.ReadFile(statePath(desFolder, subDesFolder))
+	if os.IsNotExist(err) {
+		return s, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	err = json.Unmarshal(bytes, s)
+	if err != nil {
+		return nil, err
+	}
+	return s, nil
+}
+
+// Find returns the range starting at startId, or nil.
+func (s *ArchiveState) Find(startId int) *RangeState {
+	for _, r := range s.Ranges {
+		if r.StartId == startId {
+			return r
+		}
+	}
+	return nil
+}
+
+// ReadState returns the archive state of a site. The state file is replaced
+// atomically, so it is read without lock.
+func ReadState(desFolder, subDesFolder string) (*ArchiveState, error) {
+	return readState(desFolder, subDesFolder)
+}
+
+// setRangeState records the state of a range and persists it before
+// returning. The state file is locked meanwhile, so that every scraper and
+// teleport working on the site records its ranges.
+func setRangeState(desFolder, subDesFolder string, r RangeState) error {
+	lock, err := util.WaitLockFile(statePath(desFolder, subDesFolder) + ".lock")
+	if err != nil {
+		return err
+	}
+	defer lock.Close()
+	s, err := readState(desFolder, subDesFolder)
+	if err != nil {
+		return err
+	}
+	if old := s.Find(r.StartId); old != nil {
+		*old = r
+	} else {
+		s.Ranges = append(s.Ranges, &r)
+		sort.Slice(s.Ranges, func(i, j int) bool {
+			return s.Ranges[i].StartId < s.Ranges[j].StartId
+		})
+	}
+	bytes, err := json.Marshal(s)
+	if err != nil {
+		return err
+	}
+	return util.WriteFileAtomic(statePath(desFolder, subDesFolder), bytes, 0666)
+}
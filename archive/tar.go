@@ -3,10 +3,13 @@ package archive
 import (
 	"archive/tar"
 	"compress/gzip"
+	"crypto/sha256"
+	"encoding/hex"
 	"errors"
 	"fmt"
 	"github.com/charleswong/scraper/util"
 	"io"
+	"io/ioutil"
 	"log"
 	"os"
 	"path"
@@ -20,6 +23,14 @@ var (
 	ArchiveSize = IdStep * 10
 )
 
+// ChecksumRecord is the PAX record holding the hex sha256 of a member.
+const ChecksumRecord = "VO.sha256"
+
+func checksum(data []byte) string {
+	sum := sha256.Sum256(data)
+	return hex.EncodeToString(sum[:])
+}
+
 func deleteRange(startId, endId int, basePath string) error {
 	for i := startId; i < endId; i += IdStep {
 		pathes := []string{
@@ -38,58 +49,107 @@ func deleteRange(startId, endId int, basePath string) error {
 	return nil
 }
 
-func archiveRange(startId, endId int, desFile string, basePath string) error {
-	os.Remove(desFile)
-	tarfile, err := os.Create(desFile)
+// archiveRange writes the files of Id from startId to endId-1 into desFile
+// and returns how many files it archived. The archive is written to a
+// temporary file which is synced and renamed into place only when complete,
+// and its index only after it, so an index never outlives its archive.
+func archiveRange(startId, endId int, desFile string, basePath string) (int, error) {
+	tmpFile := desFile + ".tmp"
+	tarfile, err := os.Create(tmpFile)
 	if err != nil {
 		log.Println(err)
-		return err
+		return 0, err
+	}
+	files, index, err := writeRange(startId, endId, tarfile, desFile, basePath)
+	if err == nil {
+		err = tarfile.Sync()
+	}
+	if closeErr := tarfile.Close(); err == nil {
+		err = closeErr
+	}
+	if err == nil {
+		// The index of a previous archive must not describe this one.
+		if err = os.Remove(desFile + IndexSuffix); os.IsNotExist(err) {
+			err = nil
+		}
+	}
+	if err == nil {
+		err = os.Rename(tmpFile, desFile)
+	}
+	if err == nil {
+		err = util.SyncDir(path.Dir(desFile))
+	}
+	if err != nil {
+		os.Remove(tmpFile)
+		return 0, err
+	}
+	if index != nil {
+		if err = writeIndex(index, desFile); err != nil {
+			return 0, err
+		}
 	}
+	log.Printf("Archived Id from %d to %d in %s.\n", startId, endId-1, basePath)
+	return files, nil
+}
 
-	defer tarfile.Close()
-	var fileWriter io.WriteCloser = tarfile
+// writeRange writes the files of a range to tarfile, and returns how many it
+// wrote and the index of the members when desFile is gzipped.
+func writeRange(startId, endId int, tarfile io.Writer, desFile string, basePath string) (int, *Index, error) {
+	var fileWriter io.Writer = tarfile
+	var members *memberWriter
 
 	if strings.HasSuffix(desFile, ".gz") {
-		fileWriter = gzip.NewWriter(tarfile) // add a gzip filter
-		defer fileWriter.Close()             // if user add .gz in the destination filename
+		members = newMemberWriter(tarfile) // add a gzip filter, one member per profile
+		fileWriter = members               // if user add .gz in the destination filename
 	}
 
 	tarfileWriter := tar.NewWriter(fileWriter)
-	defer tarfileWriter.Close()
+	files := 0
 
 	walkFn := func(path string, info os.FileInfo, err error) error {
-		if info == nil {
-			return nil
+		if err != nil {
+			if os.IsNotExist(err) {
+				return nil
+			}
+			return err
 		}
 		if info.Mode().IsDir() {
 			return nil
 		}
 		// Because of scoping we can reference the external root_directory variable
 		new_path := path[len(basePath):]
-		// log.Println("base_path: ", basePath, path)
-		// log.Println("new_path: ", new_path)
-		if len(new_path) == 0 {
+		if len(new_path) == 0 || strings.HasSuffix(new_path, ".tmp") {
 			return nil
 		}
-		fr, err := os.Open(path)
+		data, err := ioutil.ReadFile(path)
 		if err != nil {
 			return err
 		}
-		defer fr.Close()
-
-		if h, err := tar.FileInfoHeader(info, new_path); err != nil {
-			log.Fatalln(err)
-		} else {
-			h.Name = new_path
-			if err = tarfileWriter.WriteHeader(h); err != nil {
-				log.Fatalln(err)
+		if members != nil {
+			id, err := memberId(new_path)
+			if err != nil {
+				return err
+			}
+			if err = members.Begin(tarfileWriter, id, new_path); err != nil {
+				return err
 			}
 		}
-		if _, err := io.Copy(tarfileWriter, fr); err != nil {
-			log.Fatalln(err)
-		} else {
-			// log.Println(length)
+
+		h, err := tar.FileInfoHeader(info, new_path)
+		if err != nil {
+			return err
+		}
+		h.Name = new_path
+		h.PAXRecords = map[string]string{
+			ChecksumRecord: checksum(data),
 		}
+		if err = tarfileWriter.WriteHeader(h); err != nil {
+			return err
+		}
+		if _, err := tarfileWriter.Write(data); err != nil {
+			return err
+		}
+		files++
 		return nil
 	}
 
@@ -101,25 +161,184 @@ func archiveRange(startId, endId int, desFile string, basePath string) error {
 		}
 		p := path.Join(pathes...)
 
-		if err = filepath.Walk(p, walkFn); err != nil {
+		if err := filepath.Walk(p, walkFn); err != nil {
+			return 0, nil, err
+		}
+	}
+	if err := tarfileWriter.Close(); err != nil {
+		return 0, nil, err
+	}
+	if members == nil {
+		return files, nil, nil
+	}
+	if err := members.Close(); err != nil {
+		return 0, nil, err
+	}
+	return files, members.index, nil
+}
+
+// verifyArchive reads desFile back, checking the gzip CRC and the checksum of
+// every member, and that it holds the expected number of files.
+func verifyArchive(desFile string, files int) error {
+	file, err := os.Open(desFile)
+	if err != nil {
+		return err
+	}
+	defer file.Close()
+	gz, err := gzip.NewReader(file)
+	if err != nil {
+		return err
+	}
+	tr := tar.NewReader(gz)
+	found := 0
+	for {
+		h, err := tr.Next()
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
 			return err
 		}
+		hash := sha256.New()
+		if _, err := io.Copy(hash, tr); err != nil {
+			return err
+		}
+		if sum, ok := h.PAXRecords[ChecksumRecord]; ok && sum != hex.EncodeToString(hash.Sum(nil)) {
+			return fmt.Errorf("Checksum mismatch for %s in %s", h.Name, desFile)
+		}
+		found++
+	}
+	if _, err := io.Copy(ioutil.Discard, gz); err != nil {
+		return err
+	}
+	if found != files {
+		return fmt.Errorf("%s holds %d files, want %d", desFile, found, files)
 	}
-	log.Printf("Archived Id from %d to %d in %s.\n", startId, endId-1, basePath)
-	deleteRange(startId, endId, basePath)
 	return nil
 }
 
+// Archive packs the files of Id from startId to endId-1 into
+// desFolder/subDesFolder and deletes them from basePath. The range is recorded
+// in the state file of the site before anything is deleted, so sources are
+// only removed once their archive is complete and verified.
 func Archive(startId, endId int, desFolder, subDesFolder, basePath string) error {
-	os.MkdirAll(desFolder, 0666)
+	r, err := build(startId, endId, desFolder, subDesFolder, basePath, RangeArchived)
+	if err != nil || r == nil {
+		return err
+	}
+	return cleanRange(desFolder, subDesFolder, basePath, *r)
+}
+
+// Build packs the files of Id from startId to endId-1 like Archive, but keeps
+// them in basePath until Clean is called, e.g. once a copy of the archive is
+// verified elsewhere.
+func Build(startId, endId int, desFolder, subDesFolder, basePath string) error {
+	_, err := build(startId, endId, desFolder, subDesFolder, basePath, RangeKept)
+	return err
+}
+
+// build writes and verifies the archive of a range and records it in state.
+// It returns nil when the range was archived before.
+func build(startId, endId int, desFolder, subDesFolder, basePath string, state string) (*RangeState, error) {
+	err := os.MkdirAll(path.Join(desFolder, subDesFolder), 0777)
+	if err != nil {
+		log.Println(err)
+		return nil, err
+	}
+	s, err := ReadState(desFolder, subDesFolder)
+	if err != nil {
+		log.Println(err)
+		return nil, err
+	}
+	if r := s.Find(startId); r != nil && r.State != RangeArchiving {
+		log.Printf("Id from %d to %d is already archived.\n", startId, endId-1)
+		return nil, nil
+	}
 	if util.IsLowDiskSpace() {
-		return errors.New("Low disk space")
+		return nil, errors.New("Low disk space")
+	}
+
+	r := RangeState{StartId: startId, EndId: endId, State: RangeArchiving, Keep: state == RangeKept}
+	if err = setRangeState(desFolder, subDesFolder, r); err != nil {
+		log.Println(err)
+		return nil, err
+	}
+	desFile := ArchivePath(desFolder, subDesFolder, startId, endId)
+	r.Files, err = archiveRange(startId, endId, desFile, basePath)
+	if err != nil {
+		log.Println(err)
+		return nil, err
 	}
-	desFile := fmt.Sprintf("%s/%s/%d-%d.tar.gz", desFolder, subDesFolder, startId, endId-1)
-	err := archiveRange(startId, endId, desFile, basePath)
+	if err = verifyArchive(desFile, r.Files); err != nil {
+		log.Println(err)
+		return nil, err
+	}
+	r.State = state
+	if err = setRangeState(desFolder, subDesFolder, r); err != nil {
+		log.Println(err)
+		return nil, err
+	}
+	return &r, nil
+}
+
+// Clean deletes from basePath the files of the range starting at startId,
+// which must be archived. A range already cleaned is left alone.
+func Clean(startId int, desFolder, subDesFolder, basePath string) error {
+	state, err := ReadState(desFolder, subDesFolder)
 	if err != nil {
 		log.Println(err)
 		return err
 	}
+	r := state.Find(startId)
+	if r == nil || r.State == RangeArchiving {
+		return fmt.Errorf("Id from %d is not archived yet.", startId)
+	}
+	if r.State == RangeCleaned {
+		return nil
+	}
+	return cleanRange(desFolder, subDesFolder, basePath, *r)
+}
+
+func cleanRange(desFolder, subDesFolder, basePath string, r RangeState) error {
+	err := deleteRange(r.StartId, r.EndId, basePath)
+	if err != nil {
+		log.Println(err)
+		return err
+	}
+	r.State = RangeCleaned
+	if err = setRangeState(desFolder, subDesFolder, r); err != nil {
+		log.Println(err)
+		return err
+	}
+	return nil
+}
+
+// Resume finishes the ranges of a site whose archiving was interrupted:
+// ranges still being archived are built again as they were, by Build or
+// Archive, and archived ranges whose sources were not deleted yet are
+// cleaned. Kept ranges wait for Clean.
+func Resume(desFolder, subDesFolder, basePath string) error {
+	state, err := ReadState(desFolder, subDesFolder)
+	if err != nil {
+		log.Println(err)
+		return err
+	}
+	for _, r := range state.Ranges {
+		switch r.State {
+		case RangeArchiving:
+			log.Printf("Redo interrupted archive of Id from %d to %d.\n", r.StartId, r.EndId-1)
+			if r.Keep {
+				err = Build(r.StartId, r.EndId, desFolder, subDesFolder, basePath)
+			} else {
+				err = Archive(r.StartId, r.EndId, desFolder, subDesFolder, basePath)
+			}
+		case RangeArchived:
+			log.Printf("Clean archived Id from %d to %d.\n", r.StartId, r.EndId-1)
+			err = cleanRange(desFolder, subDesFolder, basePath, *r)
+		}
+		if err != nil {
+			return err
+		}
+	}
 	return nil
 }
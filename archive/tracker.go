@@ -0,0 +1,121 @@
+package archive
+
+import (
+	"log"
+	"sync"
+)
+
+// Tracker archives an Id range of ArchiveSize Ids once every Id in it has
+// finished crawling. Ids must be started in increasing order; a range is
+// complete when its last Id has been started and no Id of it is running.
+// Archiving runs in the background, one range at a time, so crawling goes on
+// while a range is archived. The watermark of the task is kept in the
+// ProgressFile of the site.
+type Tracker struct {
+	desFolder    string
+	subDesFolder string
+	basePath     string
+
+	lock      sync.Mutex
+	pending   map[int]int
+	sealed    map[int]bool
+	archiving map[int]bool
+	next      int
+	progress  TaskProgress
+
+	archiveLock sync.Mutex
+	wg          sync.WaitGroup
+}
+
+// NewTracker tracks a task crawling Id from beginId to endId-1.
+func NewTracker(desFolder, subDesFolder, basePath string, beginId, endId int) *Tracker {
+	t := &Tracker{
+		desFolder:    desFolder,
+		subDesFolder: subDesFolder,
+		basePath:     basePath,
+		pending:      make(map[int]int),
+		sealed:       make(map[int]bool),
+		archiving:    make(map[int]bool),
+		next:         beginId,
+		progress:     TaskProgress{Site: subDesFolder, BeginId: beginId, EndId: endId, Watermark: -1},
+	}
+	t.updateProgress()
+	return t
+}
+
+func rangeStart(id int) int {
+	return id - id%ArchiveSize
+}
+
+// Start records that id is being crawled.
+func (t *Tracker) Start(id int) {
+	t.lock.Lock()
+	defer t.lock.Unlock()
+	start := rangeStart(id)
+	t.pending[start]++
+	if id == start+ArchiveSize-1 {
+		t.sealed[start] = true
+	}
+	t.next = id + 1
+	t.updateProgress()
+}
+
+// Done records that id has finished and archives its range if it was the
+// last one running.
+func (t *Tracker) Done(id int) {
+	t.lock.Lock()
+	defer t.lock.Unlock()
+	start := rangeStart(id)
+	t.pending[start]--
+	if t.pending[start] > 0 || !t.sealed[start] {
+		return
+	}
+	delete(t.pending, start)
+	delete(t.sealed, start)
+	t.archiving[start] = true
+
+	t.wg.Add(1)
+	go func() {
+		defer t.wg.Done()
+		t.archiveLock.Lock()
+		err := Archive(start, start+ArchiveSize, t.desFolder, t.subDesFolder, t.basePath)
+		t.archiveLock.Unlock()
+		if err != nil {
+			log.Println(err)
+		}
+
+		t.lock.Lock()
+		defer t.lock.Unlock()
+		delete(t.archiving, start)
+		t.updateProgress()
+	}()
+}
+
+// updateProgress moves the watermark to the lowest range still crawled or
+// archived and records it when it changed. t.lock must be held.
+func (t *Tracker) updateProgress() {
+	watermark := rangeStart(t.next)
+	for start, n := range t.pending {
+		if n > 0 && start < watermark {
+			watermark = start
+		}
+	}
+	for start := range t.archiving {
+		if start < watermark {
+			watermark = start
+		}
+	}
+	if watermark == t.progress.Watermark {
+		return
+	}
+	t.progress.Watermark = watermark
+	err := setTaskProgress(t.desFolder, t.subDesFolder, t.progress)
+	if err != nil {
+		log.Println(err)
+	}
+}
+
+// Wait blocks until the ranges being archived are done.
+func (t *Tracker) Wait() {
+	t.wg.Wait()
+}
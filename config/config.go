@@ -2,114 +2,49 @@ package config
 
 import (
 	"encoding/json"
+	"flag"
 	"github.com/charleswong/scraper/model"
 	"io/ioutil"
 	"log"
 	"sync"
 )
 
-var (
-	ConfigFile string
-	config     *model.ScraperConfig
-	tasks      []model.Task
-	configLock = &sync.Mutex{}
-)
-
-func GetConfig() *model.ScraperConfig {
-	if config == nil {
-		configLock.Lock()
-		defer configLock.Unlock()
-		if config == nil {
-			loadConfig()
-		}
-	}
-	return config
-}
+// Config is a scraper config merged from its layers. It can be reloaded
+// while in use.
+type Config struct {
+	File  string
+	flags *flag.FlagSet
 
-func GetTasks() []model.Task {
-	if tasks == nil {
-		configLock.Lock()
-		defer configLock.Unlock()
-		if tasks == nil {
-			loadTasks()
-		}
-	}
-	return tasks
+	lock    sync.Mutex
+	current *model.ScraperConfig
 }
 
-func loadTasks() error {
-	c := GetConfig()
-	if c == nil || len(c.TaskFile) == 0 {
-		log.Fatal("No task file.")
-	}
-	bytes, err := ioutil.ReadFile(c.TaskFile)
-	if err != nil {
-		log.Println(err)
-		return err
-	}
-	scraperTasks := &model.ScraperTasks{}
-	err = json.Unmarshal(bytes, scraperTasks)
+// NewConfig reads the config from file, overridden by the environment and
+// by the flags of fs registered with RegisterFlags. fs may be nil.
+func NewConfig(file string, fs *flag.FlagSet) (*Config, error) {
+	c, _, err := readLayered(file, fs)
 	if err != nil {
 		log.Println(err)
-		return err
-	}
-
-	tasks = make([]model.Task, 0)
-	for _, t := range scraperTasks.Tasks {
-		task, err := model.UnpackScraperTask(t)
-		if err != nil {
-			log.Println(err)
-			return err
-		}
-		tasks = append(tasks, task)
+		return nil, err
 	}
-	return nil
+	return &Config{File: file, flags: fs, current: c}, nil
 }
 
-func SaveTasks() error {
-	c := GetConfig()
-	if c == nil || len(c.TaskFile) == 0 {
-		log.Fatal("No task file.")
-	}
-	scraperTasks := &model.ScraperTasks{}
-
-	for _, t := range tasks {
-		packedTask, err := model.PackScraperTask(t)
-		if err != nil {
-			log.Println(err)
-			return err
-		}
-		scraperTasks.Tasks = append(
-			scraperTasks.Tasks,
-			packedTask,
-		)
-	}
-
-	bytes, err := json.Marshal(scraperTasks)
-	if err != nil {
-		log.Println(err)
-		return err
-	}
-	err = ioutil.WriteFile(c.TaskFile, bytes, 0666)
-	if err != nil {
-		log.Println(err)
-		return err
-	}
-	log.Println("Task saved to ", c.TaskFile)
-	return nil
+// Get returns the config in use. It changes on Reload, so callers should
+// not hold on to it.
+func (cfg *Config) Get() *model.ScraperConfig {
+	cfg.lock.Lock()
+	defer cfg.lock.Unlock()
+	return cfg.current
 }
 
-func loadConfig() error {
-	if len(ConfigFile) == 0 {
-		log.Fatal("No config file.")
-	}
-	bytes, err := ioutil.ReadFile(ConfigFile)
+func (cfg *Config) Save() error {
+	bytes, err := json.Marshal(cfg.Get())
 	if err != nil {
 		log.Println(err)
 		return err
 	}
-	config = &model.ScraperConfig{}
-	err = json.Unmarshal(bytes, config)
+	err = ioutil.WriteFile(cfg.File, bytes, 0666)
 	if err != nil {
 		log.Println(err)
 		return err
@@ -117,16 +52,18 @@ func loadConfig() error {
 	return nil
 }
 
-func SaveConfig() error {
-	bytes, err := json.Marshal(GetConfig())
+// ReadConfig reads configFile alone, without defaults or overrides.
+func ReadConfig(configFile string) (*model.ScraperConfig, error) {
+	bytes, err := ioutil.ReadFile(configFile)
 	if err != nil {
 		log.Println(err)
-		return err
+		return nil, err
 	}
-	err = ioutil.WriteFile(ConfigFile, bytes, 0666)
+	c := &model.ScraperConfig{}
+	err = json.Unmarshal(bytes, c)
 	if err != nil {
 		log.Println(err)
-		return err
+		return nil, err
 	}
-	return nil
+	return c, nil
 }
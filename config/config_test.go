@@ -1,30 +1,161 @@
 package config
 
 import (
+	"encoding/json"
 	"github.com/charleswong/scraper/model"
+	"io/ioutil"
+	"os"
+	"path"
 	"testing"
 )
 
 func TestConfig(t *testing.T) {
-	configFile = "scraper.conf"
-	config = &model.ScraperConfig{}
-	config.TaskFile = "jiayuan.task"
-	config.Proxies = []string{"localhost:1081", "localhost:1082"}
-	config.ThreadNum = 1
-	config.ValidImgNum = 2
-	config.DataFolder = "deepavatar/"
-	config.ArchiveFolder = "avatar_tars/"
-	config.TmpFolder = "deep_tmp/"
+	dir, err := ioutil.TempDir("", "config")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	cfg := &Config{File: path.Join(dir, "scraper.conf")}
+	cfg.current = &model.ScraperConfig{}
+	cfg.current.TaskFile = path.Join(dir, "jiayuan.task")
+	cfg.current.Proxies = []string{"localhost:1081", "localhost:1082"}
+	cfg.current.ThreadNum = 1
+	cfg.current.ValidImgNum = 2
+	cfg.current.DataFolder = "deepavatar/"
+	cfg.current.ArchiveFolder = "avatar_tars/"
+	cfg.current.TmpFolder = "deep_tmp/"
 
 	jiayuanTask := &model.JiayuanTask{
-		Type: model.TaskType_JIAYUAN,
-		IdProfileTask: &model.IdProfileTask{
-			BeginId: 100,
-			EndId:   200,
+		SocialImageTask: &model.SocialImageTask{
+			Type: model.TaskType_JIAYUAN,
+			IdProfileTask: &model.IdProfileTask{
+				BeginId: 100,
+				EndId:   200,
+			},
 		},
 	}
-	tasks = []model.Task{jiayuanTask}
+	store := &TaskStore{File: cfg.current.TaskFile, tasks: []model.Task{jiayuanTask}}
+
+	if err := store.Save(); err != nil {
+		t.Fatal(err)
+	}
+	if err := cfg.Save(); err != nil {
+		t.Fatal(err)
+	}
+
+	loaded, err := NewConfig(cfg.File, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if loaded.Get().TaskFile != cfg.current.TaskFile || loaded.Get().ThreadNum != 1 || len(loaded.Get().Proxies) != 2 {
+		t.Fatalf("Loaded %v, want %v", loaded.Get(), cfg.current)
+	}
+	loadedStore, err := NewTaskStore(loaded.Get().TaskFile)
+	if err != nil {
+		t.Fatal(err)
+	}
+	tasks := loadedStore.Tasks()
+	if len(tasks) != 1 || tasks[0].GetType() != model.TaskType_JIAYUAN || tasks[0].GetSocialImageTask().GetIdProfileTask().EndId != 200 {
+		t.Fatalf("Loaded tasks %v", tasks)
+	}
+}
 
-	SaveTask()
-	SaveConfig()
+func TestConfigReload(t *testing.T) {
+	dir, err := ioutil.TempDir("", "config")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	file := path.Join(dir, "scraper.conf")
+	running := `{"TaskFile":"jiayuan.task","ThreadNum":2,"ValidImgNum":3,"Proxies":["localhost:1081"],` +
+		`"DataFolder":"` + path.Join(dir, "deepavatar") + `","ArchiveFolder":"` + path.Join(dir, "avatar_tars") +
+		`","TmpFolder":"` + path.Join(dir, "deep_tmp") + `"}`
+	tests := []struct {
+		name    string
+		changes map[string]interface{}
+		invalid bool
+		check   func(c *model.ScraperConfig) bool
+	}{
+		{
+			name:    "ThreadNum",
+			changes: map[string]interface{}{"ThreadNum": 8},
+			check:   func(c *model.ScraperConfig) bool { return c.ThreadNum == 8 },
+		},
+		{
+			name:    "ValidImgNum",
+			changes: map[string]interface{}{"ValidImgNum": 1},
+			check:   func(c *model.ScraperConfig) bool { return c.ValidImgNum == 1 },
+		},
+		{
+			name:    "Proxies",
+			changes: map[string]interface{}{"Proxies": []string{"localhost:1082", "localhost:1083"}},
+			check:   func(c *model.ScraperConfig) bool { return len(c.Proxies) == 2 && c.Proxies[0] == "localhost:1082" },
+		},
+		{
+			name:    "DataFolder kept, ThreadNum applied",
+			changes: map[string]interface{}{"DataFolder": path.Join(dir, "other"), "ThreadNum": 4},
+			check: func(c *model.ScraperConfig) bool {
+				return c.DataFolder == path.Join(dir, "deepavatar") && c.ThreadNum == 4
+			},
+		},
+		{
+			name:    "TaskFile and Control kept",
+			changes: map[string]interface{}{"TaskFile": "baihe.task", "Control": ":8091"},
+			check:   func(c *model.ScraperConfig) bool { return c.TaskFile == "jiayuan.task" && len(c.Control) == 0 },
+		},
+		{
+			name:    "invalid ThreadNum",
+			changes: map[string]interface{}{"ThreadNum": -1, "ValidImgNum": 1},
+			invalid: true,
+		},
+		{
+			name:    "invalid proxy",
+			changes: map[string]interface{}{"Proxies": []string{"http://"}},
+			invalid: true,
+		},
+	}
+	for _, test := range tests {
+		if err := ioutil.WriteFile(file, []byte(running), 0666); err != nil {
+			t.Fatal(err)
+		}
+		cfg, err := NewConfig(file, nil)
+		if err != nil {
+			t.Fatal(err)
+		}
+		old := cfg.Get()
+		changed := make(map[string]interface{})
+		if err := json.Unmarshal([]byte(running), &changed); err != nil {
+			t.Fatal(err)
+		}
+		for k, v := range test.changes {
+			changed[k] = v
+		}
+		bytes, err := json.Marshal(changed)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if err := ioutil.WriteFile(file, bytes, 0666); err != nil {
+			t.Fatal(err)
+		}
+
+		c, err := cfg.Reload()
+		if test.invalid {
+			if err == nil {
+				t.Errorf("%s: reloaded %v, want an error", test.name, c)
+			}
+			if cfg.Get() != old {
+				t.Errorf("%s: running config replaced by an invalid one", test.name)
+			}
+			continue
+		}
+		if err != nil {
+			t.Errorf("%s: %v", test.name, err)
+			continue
+		}
+		if cfg.Get() != c || !test.check(c) {
+			t.Errorf("%s: reloaded %v", test.name, c)
+		}
+	}
 }
@@ -0,0 +1,209 @@
+package config
+
+import (
+	"encoding/json"
+	"flag"
+	"fmt"
+	"github.com/charleswong/scraper/model"
+	"io"
+	"io/ioutil"
+	"os"
+	"strconv"
+	"strings"
+)
+
+// A ScraperConfig is merged from, lowest precedence first: the defaults,
+// ConfigFile, VO_* environment variables and command line flags.
+
+// field is a ScraperConfig field that can be set from every layer.
+type field struct {
+	name  string
+	env   string
+	flag  string
+	usage string
+	get   func(c *model.ScraperConfig) string
+	set   func(c *model.ScraperConfig, v string) error
+}
+
+func setInt32(p *int32, v string) error {
+	i, err := strconv.ParseInt(v, 10, 32)
+	if err != nil {
+		return err
+	}
+	*p = int32(i)
+	return nil
+}
+
+var fields = []*field{
+	{
+		name: "TaskFile", env: "VO_TASK_FILE", flag: "task_file", usage: "Task file.",
+		get: func(c *model.ScraperConfig) string { return c.TaskFile },
+		set: func(c *model.ScraperConfig, v string) error { c.TaskFile = v; return nil },
+	},
+	{
+		name: "Proxies", env: "VO_PROXIES", flag: "proxies", usage: "Comma separated proxies.",
+		get: func(c *model.ScraperConfig) string { return strings.Join(c.Proxies, ",") },
+		set: func(c *model.ScraperConfig, v string) error {
+			c.Proxies = nil
+			for _, p := range strings.Split(v, ",") {
+				if p = strings.TrimSpace(p); len(p) > 0 {
+					c.Proxies = append(c.Proxies, p)
+				}
+			}
+			return nil
+		},
+	},
+	{
+		name: "ThreadNum", env: "VO_THREAD_NUM", flag: "thread_num", usage: "Ids crawled at once.",
+		get: func(c *model.ScraperConfig) string { return strconv.Itoa(int(c.ThreadNum)) },
+		set: func(c *model.ScraperConfig, v string) error { return setInt32(&c.ThreadNum, v) },
+	},
+	{
+		name: "ValidImgNum", env: "VO_VALID_IMG_NUM", flag: "valid_img_num", usage: "Images a profile needs to be saved.",
+		get: func(c *model.ScraperConfig) string { return strconv.Itoa(int(c.ValidImgNum)) },
+		set: func(c *model.ScraperConfig, v string) error { return setInt32(&c.ValidImgNum, v) },
+	},
+	{
+		name: "TaskSaveSec", env: "VO_TASK_SAVE_SEC", flag: "task_save_sec", usage: "Seconds between saves of the task file.",
+		get: func(c *model.ScraperConfig) string { return strconv.Itoa(int(c.TaskSaveSec)) },
+		set: func(c *model.ScraperConfig, v string) error { return setInt32(&c.TaskSaveSec, v) },
+	},
+	{
+		name: "TaskSaveIds", env: "VO_TASK_SAVE_IDS", flag: "task_save_ids", usage: "Ids crawled between saves of the task file.",
+		get: func(c *model.ScraperConfig) string { return strconv.Itoa(int(c.TaskSaveIds)) },
+		set: func(c *model.ScraperConfig, v string) error { return setInt32(&c.TaskSaveIds, v) },
+	},
+	{
+		name: "TaskBackups", env: "VO_TASK_BACKUPS", flag: "task_backups", usage: "Previous task files kept.",
+		get: func(c *model.ScraperConfig) string { return strconv.Itoa(int(c.TaskBackups)) },
+		set: func(c *model.ScraperConfig, v string) error { return setInt32(&c.TaskBackups, v) },
+	},
+	{
+		name: "TaskConcurrency", env: "VO_TASK_CONCURRENCY", flag: "task_concurrency", usage: "Tasks run at once in task file order, 0 for all.",
+		get: func(c *model.ScraperConfig) string { return strconv.Itoa(int(c.TaskConcurrency)) },
+		set: func(c *model.ScraperConfig, v string) error { return setInt32(&c.TaskConcurrency, v) },
+	},
+	{
+		name: "Coordinator", env: "VO_COORDINATOR", flag: "coordinator", usage: "Address of the coordinator to lease Id ranges from.",
+		get: func(c *model.ScraperConfig) string { return c.Coordinator },
+		set: func(c *model.ScraperConfig, v string) error { c.Coordinator = v; return nil },
+	},
+	{
+		name: "LeaseIds", env: "VO_LEASE_IDS", flag: "lease_ids", usage: "Ids per lease of the coordinator.",
+		get: func(c *model.ScraperConfig) string { return strconv.Itoa(int(c.LeaseIds)) },
+		set: func(c *model.ScraperConfig, v string) error { return setInt32(&c.LeaseIds, v) },
+	},
+	{
+		name: "LeaseSec", env: "VO_LEASE_SEC", flag: "lease_sec", usage: "Seconds a lease lasts without heartbeat.",
+		get: func(c *model.ScraperConfig) string { return strconv.Itoa(int(c.LeaseSec)) },
+		set: func(c *model.ScraperConfig, v string) error { return setInt32(&c.LeaseSec, v) },
+	},
+	{
+		name: "Control", env: "VO_CONTROL", flag: "control", usage: "Address to serve the Control API on.",
+		get: func(c *model.ScraperConfig) string { return c.Control },
+		set: func(c *model.ScraperConfig, v string) error { c.Control = v; return nil },
+	},
+	{
+		name: "DataFolder", env: "VO_DATA_FOLDER", flag: "data_folder", usage: "Folder of crawled files.",
+		get: func(c *model.ScraperConfig) string { return c.DataFolder },
+		set: func(c *model.ScraperConfig, v string) error { c.DataFolder = v; return nil },
+	},
+	{
+		name: "ArchiveFolder", env: "VO_ARCHIVE_FOLDER", flag: "archive_folder", usage: "Folder of archives.",
+		get: func(c *model.ScraperConfig) string { return c.ArchiveFolder },
+		set: func(c *model.ScraperConfig, v string) error { c.ArchiveFolder = v; return nil },
+	},
+	{
+		name: "TmpFolder", env: "VO_TMP_FOLDER", flag: "tmp_folder", usage: "Folder of temporary files.",
+		get: func(c *model.ScraperConfig) string { return c.TmpFolder },
+		set: func(c *model.ScraperConfig, v string) error { c.TmpFolder = v; return nil },
+	},
+}
+
+// RegisterFlags adds a flag for every config field to fs. Only flags given
+// on the command line override the config.
+func RegisterFlags(fs *flag.FlagSet) {
+	for _, f := range fields {
+		fs.String(f.flag, "", f.usage+" Overrides "+f.name+".")
+	}
+}
+
+// readLayered merges the layers into a config and returns where each field
+// came from. Flags are taken from fs when it is parsed.
+func readLayered(configFile string, fs *flag.FlagSet) (*model.ScraperConfig, map[string]string, error) {
+	c := &model.ScraperConfig{TaskSaveSec: unset, TaskSaveIds: unset, TaskBackups: unset}
+	ApplyDefaults(c)
+	src := make(map[string]string)
+	for _, f := range fields {
+		src[f.name] = "default"
+	}
+
+	if len(configFile) > 0 {
+		bytes, err := ioutil.ReadFile(configFile)
+		if err != nil {
+			return nil, nil, err
+		}
+		keys := make(map[string]json.RawMessage)
+		if err = json.Unmarshal(bytes, &keys); err != nil {
+			return nil, nil, fmt.Errorf("%s: %v", configFile, err)
+		}
+		if err = json.Unmarshal(bytes, c); err != nil {
+			return nil, nil, fmt.Errorf("%s: %v", configFile, err)
+		}
+		for _, f := range fields {
+			if _, ok := keys[f.name]; ok {
+				src[f.name] = "file " + configFile
+			}
+		}
+		// Empty values in the file still get the defaults.
+		ApplyDefaults(c)
+	}
+
+	e := &ValidationError{}
+	for _, f := range fields {
+		if v, ok := os.LookupEnv(f.env); ok {
+			if err := f.set(c, v); err != nil {
+				e.add("Invalid %s %q: %v", f.env, v, err)
+				continue
+			}
+			src[f.name] = "env " + f.env
+		}
+	}
+	if fs != nil && fs.Parsed() {
+		for _, f := range fields {
+			fl := fs.Lookup(f.flag)
+			if fl == nil {
+				continue
+			}
+			set := false
+			fs.Visit(func(v *flag.Flag) {
+				set = set || v == fl
+			})
+			if !set {
+				continue
+			}
+			if err := f.set(c, fl.Value.String()); err != nil {
+				e.add("Invalid -%s %q: %v", f.flag, fl.Value.String(), err)
+				continue
+			}
+			src[f.name] = "flag -" + f.flag
+		}
+	}
+	if len(e.Problems) > 0 {
+		return nil, nil, e
+	}
+	return c, src, nil
+}
+
+// Print writes the config merged from file, the environment and fs, with
+// where each value came from.
+func Print(w io.Writer, file string, fs *flag.FlagSet) error {
+	c, src, err := readLayered(file, fs)
+	if err != nil {
+		return err
+	}
+	for _, f := range fields {
+		fmt.Fprintf(w, "%-14s %-30q %s\n", f.name, f.get(c), src[f.name])
+	}
+	return nil
+}
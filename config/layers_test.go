@@ -0,0 +1,61 @@
+package config
+
+import (
+	"flag"
+	"io/ioutil"
+	"os"
+	"path"
+	"testing"
+)
+
+func TestLayersPrecedence(t *testing.T) {
+	dir, err := ioutil.TempDir("", "config")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	configFile := path.Join(dir, "scraper.conf")
+	err = ioutil.WriteFile(configFile, []byte(`{"TaskFile":"jiayuan.task","ThreadNum":2,"ValidImgNum":3,"DataFolder":"file/"}`), 0666)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	fs := flag.NewFlagSet("scraper", flag.ContinueOnError)
+	RegisterFlags(fs)
+	if err := fs.Parse([]string{"-thread_num", "8"}); err != nil {
+		t.Fatal(err)
+	}
+	os.Setenv("VO_THREAD_NUM", "4")
+	os.Setenv("VO_VALID_IMG_NUM", "5")
+	defer os.Unsetenv("VO_THREAD_NUM")
+	defer os.Unsetenv("VO_VALID_IMG_NUM")
+
+	c, src, err := readLayered(configFile, fs)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if c.ThreadNum != 8 || src["ThreadNum"] != "flag -thread_num" {
+		t.Errorf("ThreadNum %d from %s, want 8 from the flag", c.ThreadNum, src["ThreadNum"])
+	}
+	if c.ValidImgNum != 5 || src["ValidImgNum"] != "env VO_VALID_IMG_NUM" {
+		t.Errorf("ValidImgNum %d from %s, want 5 from the environment", c.ValidImgNum, src["ValidImgNum"])
+	}
+	if c.DataFolder != "file/" || src["DataFolder"] != "file "+configFile {
+		t.Errorf("DataFolder %q from %s, want file/ from the file", c.DataFolder, src["DataFolder"])
+	}
+	if c.TmpFolder != DefaultTmpFolder || src["TmpFolder"] != "default" {
+		t.Errorf("TmpFolder %q from %s, want the default", c.TmpFolder, src["TmpFolder"])
+	}
+
+	// 0 saves every change and keeps no backup, so it is not taken as empty.
+	err = ioutil.WriteFile(configFile, []byte(`{"TaskFile":"jiayuan.task","TaskSaveIds":0,"TaskBackups":0}`), 0666)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if c, _, err = readLayered(configFile, nil); err != nil {
+		t.Fatal(err)
+	}
+	if c.TaskSaveIds != 0 || c.TaskBackups != 0 || c.TaskSaveSec != DefaultTaskSaveSec {
+		t.Errorf("TaskSaveIds %d, TaskBackups %d and TaskSaveSec %d, want 0, 0 and the default", c.TaskSaveIds, c.TaskBackups, c.TaskSaveSec)
+	}
+}
@@ -0,0 +1,324 @@
+package config
+
+import (
+	"bytes"
+	"fmt"
+	"github.com/charleswong/scraper/model"
+	"github.com/charleswong/scraper/util"
+	"github.com/golang/protobuf/jsonpb"
+	"io/ioutil"
+	"log"
+	"os"
+	"sync"
+	"time"
+)
+
+// TaskStore holds the tasks of a task file. Tasks are updated in place with
+// Update as they progress and written back once TaskSaveIds updates were
+// made or TaskSaveSec passed, not after every id.
+//
+// The task file is replaced atomically and its previous versions are kept
+// as File.1 (newest) to File.<TaskBackups>. NewTaskStore falls back to them
+// when the task file cannot be read.
+type TaskStore struct {
+	File string
+
+	lock      sync.Mutex
+	tasks     []model.Task
+	saveIds   int
+	saveEvery time.Duration
+	backups   int
+	changes   int
+	savedTs   time.Time
+	version   int
+	legacy    bool
+
+	// writeLock orders the writes of the task file and its backups.
+	writeLock sync.Mutex
+	written   int
+	last      []byte
+	lockFile  *os.File
+}
+
+// Tasks are written in the proto JSON format, which unlike encoding/json
+// handles the ScraperTask oneof.
+var marshaler = &jsonpb.Marshaler{OrigName: true}
+
+func NewTaskStore(file string) (*TaskStore, error) {
+	tasks, data, legacy, err := readTasks(file)
+	if err != nil {
+		for i := 1; ; i++ {
+			backup := backupFile(file, i)
+			if _, statErr := os.Stat(backup); statErr != nil {
+				return nil, err
+			}
+			if tasks, data, legacy, err = readTasks(backup); err == nil {
+				log.Printf("Cannot read %s, recovered tasks from %s.\n", file, backup)
+				break
+			}
+		}
+	}
+	return &TaskStore{
+		File:      file,
+		tasks:     tasks,
+		saveIds:   int(DefaultTaskSaveIds),
+		saveEvery: time.Duration(DefaultTaskSaveSec) * time.Second,
+		backups:   int(DefaultTaskBackups),
+		savedTs:   time.Now(),
+		last:      data,
+		legacy:    legacy,
+	}, nil
+}
+
+// Migrate rewrites a task file with legacy tasks, which keep the task as
+// JSON in ScraperTask.Data, with typed tasks. The legacy file is kept as
+// File.legacy.
+func (s *TaskStore) Migrate() error {
+	s.lock.Lock()
+	legacy, data := s.legacy, s.last
+	s.lock.Unlock()
+	if !legacy {
+		return nil
+	}
+	legacyFile := s.File + ".legacy"
+	if _, err := os.Stat(legacyFile); os.IsNotExist(err) {
+		err = util.WriteFileAtomic(legacyFile, data, 0666)
+		if err != nil {
+			log.Println(err)
+			return err
+		}
+	}
+	log.Printf("Migrating %s to typed tasks, the legacy file is kept as %s.\n", s.File, legacyFile)
+	err := s.Save()
+	if err != nil {
+		return err
+	}
+	s.lock.Lock()
+	s.legacy = false
+	s.lock.Unlock()
+	return nil
+}
+
+// Configure takes TaskSaveIds, TaskSaveSec and TaskBackups from c.
+func (s *TaskStore) Configure(c *model.ScraperConfig) {
+	s.lock.Lock()
+	defer s.lock.Unlock()
+	s.saveIds = int(c.TaskSaveIds)
+	s.saveEvery = time.Duration(c.TaskSaveSec) * time.Second
+	s.backups = int(c.TaskBackups)
+}
+
+// LockFile takes File.lock, so that no other scraper writes the task file
+// while this one runs. Close releases it.
+func (s *TaskStore) LockFile() error {
+	f, err := util.LockFile(s.File + ".lock")
+	if err != nil {
+		return fmt.Errorf("Cannot lock %s, is another scraper using it? %v", s.File, err)
+	}
+	s.lockFile = f
+	return nil
+}
+
+func (s *TaskStore) Tasks() []model.Task {
+	s.lock.Lock()
+	defer s.lock.Unlock()
+	return s.tasks
+}
+
+// View runs f, which reads the tasks, while no update runs.
+func (s *TaskStore) View(f func()) {
+	s.lock.Lock()
+	defer s.lock.Unlock()
+	f()
+}
+
+// State returns the state of task, which may change while it runs.
+func (s *TaskStore) State(task model.Task) model.TaskState {
+	s.lock.Lock()
+	defer s.lock.Unlock()
+	return task.GetSocialImageTask().GetState()
+}
+
+// Add appends task and saves the tasks. It returns the position of task.
+func (s *TaskStore) Add(task model.Task) (int, error) {
+	s.lock.Lock()
+	s.tasks = append(s.tasks, task)
+	i := len(s.tasks) - 1
+	s.changes++
+	s.lock.Unlock()
+	return i, s.Save()
+}
+
+// Update runs f, which changes the tasks, and saves them when due.
+func (s *TaskStore) Update(f func()) error {
+	s.lock.Lock()
+	f()
+	s.changes++
+	due := s.due()
+	s.lock.Unlock()
+	if !due {
+		return nil
+	}
+	return s.Save()
+}
+
+// SetState moves task to state and saves the tasks right away, unlike
+// progress, so that the task file always has the state of every task.
+func (s *TaskStore) SetState(task model.Task, state model.TaskState, err error) error {
+	s.lock.Lock()
+	task.GetSocialImageTask().SetState(state, err)
+	s.changes++
+	s.lock.Unlock()
+	return s.Save()
+}
+
+func (s *TaskStore) due() bool {
+	return s.changes > 0 && (s.changes >= s.saveIds || time.Since(s.savedTs) >= s.saveEvery)
+}
+
+// SaveIfDue saves changes older than TaskSaveSec. Call it periodically so
+// that a slow crawl still gets saved.
+func (s *TaskStore) SaveIfDue() error {
+	s.lock.Lock()
+	due := s.due()
+	s.lock.Unlock()
+	if !due {
+		return nil
+	}
+	return s.Save()
+}
+
+// Flush saves the changes not saved yet.
+func (s *TaskStore) Flush() error {
+	s.lock.Lock()
+	changed := s.changes > 0
+	s.lock.Unlock()
+	if !changed {
+		return nil
+	}
+	return s.Save()
+}
+
+// Close flushes the tasks and releases the lock taken by LockFile.
+func (s *TaskStore) Close() error {
+	err := s.Flush()
+	if s.lockFile != nil {
+		s.lockFile.Close()
+		s.lockFile = nil
+	}
+	return err
+}
+
+// Save writes the tasks now.
+func (s *TaskStore) Save() error {
+	s.lock.Lock()
+	scraperTasks := &model.ScraperTasks{}
+	for _, t := range s.tasks {
+		packedTask, err := model.PackScraperTask(t)
+		if err != nil {
+			s.lock.Unlock()
+			log.Println(err)
+			return err
+		}
+		scraperTasks.Tasks = append(
+			scraperTasks.Tasks,
+			packedTask,
+		)
+	}
+	data, err := marshaler.MarshalToString(scraperTasks)
+	if err != nil {
+		s.lock.Unlock()
+		log.Println(err)
+		return err
+	}
+	s.version++
+	version, backups, changes := s.version, s.backups, s.changes
+	s.changes = 0
+	s.savedTs = time.Now()
+	s.lock.Unlock()
+
+	err = s.write([]byte(data), version, backups)
+	if err != nil {
+		log.Println(err)
+		// Keep the changes pending so that the next save retries.
+		s.lock.Lock()
+		s.changes += changes
+		s.lock.Unlock()
+		return err
+	}
+	return nil
+}
+
+// write replaces the task file with data after rotating the backups. A
+// version older than the one on disk is dropped, so concurrent saves never
+// go back in time.
+func (s *TaskStore) write(data []byte, version int, backups int) error {
+	s.writeLock.Lock()
+	defer s.writeLock.Unlock()
+	if version <= s.written {
+		return nil
+	}
+	if bytes.Equal(data, s.last) {
+		s.written = version
+		return nil
+	}
+	if backups > 0 && s.last != nil {
+		for i := backups; i > 1; i-- {
+			err := os.Rename(backupFile(s.File, i-1), backupFile(s.File, i))
+			if err != nil && !os.IsNotExist(err) {
+				return err
+			}
+		}
+		err := util.WriteFileAtomic(backupFile(s.File, 1), s.last, 0666)
+		if err != nil {
+			return err
+		}
+	}
+	err := util.WriteFileAtomic(s.File, data, 0666)
+	if err != nil {
+		return err
+	}
+	s.last = data
+	s.written = version
+	log.Println("Task saved to ", s.File)
+	return nil
+}
+
+func backupFile(file string, i int) string {
+	return fmt.Sprintf("%s.%d", file, i)
+}
+
+// ReadTasks reads the tasks in taskFile.
+func ReadTasks(taskFile string) ([]model.Task, error) {
+	tasks, _, _, err := readTasks(taskFile)
+	return tasks, err
+}
+
+// readTasks also returns the content of taskFile and whether it has legacy
+// tasks.
+func readTasks(taskFile string) ([]model.Task, []byte, bool, error) {
+	data, err := ioutil.ReadFile(taskFile)
+	if err != nil {
+		log.Println(err)
+		return nil, nil, false, err
+	}
+	scraperTasks := &model.ScraperTasks{}
+	err = jsonpb.Unmarshal(bytes.NewReader(data), scraperTasks)
+	if err != nil {
+		log.Println(err)
+		return nil, nil, false, fmt.Errorf("%s: %v", taskFile, err)
+	}
+
+	tasks := make([]model.Task, 0)
+	legacy := false
+	for i, t := range scraperTasks.Tasks {
+		task, err := model.UnpackScraperTask(t)
+		if err != nil {
+			log.Println(err)
+			return nil, nil, false, fmt.Errorf("%s: task %d: %v", taskFile, i, err)
+		}
+		legacy = legacy || t.IsLegacy()
+		tasks = append(tasks, task)
+	}
+	return tasks, data, legacy, nil
+}
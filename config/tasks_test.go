@@ -0,0 +1,152 @@
+package config
+
+import (
+	"fmt"
+	"github.com/charleswong/scraper/model"
+	"io/ioutil"
+	"os"
+	"path"
+	"testing"
+)
+
+func TestTaskStoreSavesAndRecovers(t *testing.T) {
+	dir, err := ioutil.TempDir("", "config")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	file := path.Join(dir, "jiayuan.task")
+	task := &model.SocialImageTask{
+		Type:          model.TaskType_JIAYUAN,
+		IdProfileTask: &model.IdProfileTask{BeginId: 100, EndId: 200},
+	}
+	store := &TaskStore{File: file, tasks: []model.Task{task}}
+	store.Configure(&model.ScraperConfig{TaskSaveSec: 3600, TaskSaveIds: 3, TaskBackups: 2})
+	if err := store.Save(); err != nil {
+		t.Fatal(err)
+	}
+
+	beginId := func(file string) int64 {
+		tasks, err := ReadTasks(file)
+		if err != nil {
+			t.Fatal(err)
+		}
+		return tasks[0].GetSocialImageTask().GetIdProfileTask().BeginId
+	}
+	// Saved every third update only.
+	for id := int64(101); id <= 107; id++ {
+		if err := store.Update(func() { task.IdProfileTask.BeginId = id }); err != nil {
+			t.Fatal(err)
+		}
+		if want := 100 + (id-100)/3*3; beginId(file) != want {
+			t.Fatalf("After %d saved BeginId %d, want %d", id, beginId(file), want)
+		}
+	}
+	if err := store.Close(); err != nil {
+		t.Fatal(err)
+	}
+	if beginId(file) != 107 || beginId(file+".1") != 106 || beginId(file+".2") != 103 {
+		t.Fatalf("Saved %d, backups %d and %d", beginId(file), beginId(file+".1"), beginId(file+".2"))
+	}
+	if _, err := os.Stat(file + ".3"); !os.IsNotExist(err) {
+		t.Fatalf("Kept more than 2 backups: %v", err)
+	}
+
+	// A corrupted task file falls back to the newest backup.
+	if err := ioutil.WriteFile(file, []byte(`{"Tasks":[{"Ty`), 0666); err != nil {
+		t.Fatal(err)
+	}
+	recovered, err := NewTaskStore(file)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got := recovered.Tasks()[0].GetSocialImageTask().GetIdProfileTask().BeginId; got != 106 {
+		t.Fatalf("Recovered BeginId %d, want 106", got)
+	}
+}
+
+func TestTaskStoreMigratesLegacyTasks(t *testing.T) {
+	dir, err := ioutil.TempDir("", "config")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	file := path.Join(dir, "jiayuan.task")
+	legacy := `{"Tasks":[{"Type":1,"Data":"{\"Type\":1,\"IdProfileTask\":{\"BeginId\":100,\"EndId\":200}}"},` +
+		`{"Type":2,"Data":"{\"IdProfileTask\":{\"BeginId\":300,\"EndId\":400}}"}]}`
+	if err := ioutil.WriteFile(file, []byte(legacy), 0666); err != nil {
+		t.Fatal(err)
+	}
+	store, err := NewTaskStore(file)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := store.Migrate(); err != nil {
+		t.Fatal(err)
+	}
+
+	if kept, err := ioutil.ReadFile(file + ".legacy"); err != nil || string(kept) != legacy {
+		t.Fatalf("Legacy file kept as %q, %v", kept, err)
+	}
+	tasks, _, stillLegacy, err := readTasks(file)
+	if err != nil || stillLegacy {
+		t.Fatalf("Migrated file has legacy tasks %v, %v", stillLegacy, err)
+	}
+	if _, ok := tasks[0].(*model.JiayuanTask); !ok || tasks[0].GetSocialImageTask().GetIdProfileTask().BeginId != 100 {
+		t.Fatalf("Task 0 is %T %v, want the Jiayuan task", tasks[0], tasks[0])
+	}
+	if _, ok := tasks[1].(*model.BaiheTask); !ok || tasks[1].GetSocialImageTask().GetIdProfileTask().EndId != 400 {
+		t.Fatalf("Task 1 is %T %v, want the Baihe task", tasks[1], tasks[1])
+	}
+}
+
+func TestReadTasksRejectsTypeMismatch(t *testing.T) {
+	dir, err := ioutil.TempDir("", "config")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	file := path.Join(dir, "jiayuan.task")
+	mismatch := `{"Tasks":[{"JiayuanTask":{"SocialImageTask":{"Type":"BAIHE","IdProfileTask":{"BeginId":"1","EndId":"100"}}}}]}`
+	if err := ioutil.WriteFile(file, []byte(mismatch), 0666); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := ReadTasks(file); err == nil {
+		t.Fatal("Read a Jiayuan task of type BAIHE")
+	}
+}
+
+func TestTaskStoreSavesStateRightAway(t *testing.T) {
+	dir, err := ioutil.TempDir("", "config")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	file := path.Join(dir, "jiayuan.task")
+	task := &model.JiayuanTask{SocialImageTask: &model.SocialImageTask{
+		IdProfileTask: &model.IdProfileTask{BeginId: 100, EndId: 200},
+	}}
+	store := &TaskStore{File: file, tasks: []model.Task{task}}
+	store.Configure(&model.ScraperConfig{TaskSaveSec: 3600, TaskSaveIds: 100, TaskBackups: 0})
+	if err := store.SetState(task, model.TaskState_FAILED, fmt.Errorf("no route")); err != nil {
+		t.Fatal(err)
+	}
+	tasks, err := ReadTasks(file)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if tasks[0].GetSocialImageTask().GetState() != model.TaskState_FAILED || tasks[0].GetSocialImageTask().GetError() != "no route" {
+		t.Fatalf("Saved state %v, error %q", tasks[0].GetSocialImageTask().GetState(), tasks[0].GetSocialImageTask().GetError())
+	}
+
+	if err := store.SetState(task, model.TaskState_COMPLETED, nil); err != nil {
+		t.Fatal(err)
+	}
+	if tasks, err = ReadTasks(file); err != nil || tasks[0].GetSocialImageTask().GetError() != "" {
+		t.Fatalf("Completed task kept error %q, %v", tasks[0].GetSocialImageTask().GetError(), err)
+	}
+}
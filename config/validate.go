@@ -0,0 +1,361 @@
+package config
+
+import (
+	"flag"
+	"fmt"
+	"github.com/charleswong/scraper/archive"
+	"github.com/charleswong/scraper/frontier"
+	"github.com/charleswong/scraper/model"
+	"log"
+	"net/url"
+	"os"
+	"path/filepath"
+	"regexp"
+	"strings"
+	"syscall"
+)
+
+// Defaults of the fields left empty in the config file.
+var (
+	DefaultThreadNum     = int32(6)
+	DefaultTaskSaveSec   = int32(10)
+	DefaultTaskSaveIds   = int32(100)
+	DefaultTaskBackups   = int32(3)
+	DefaultLeaseIds      = int32(10000)
+	DefaultLeaseSec      = int32(60)
+	DefaultDataFolder    = "deepavatar/"
+	DefaultArchiveFolder = "avatar_tars/"
+	DefaultTmpFolder     = "deep_tmp/"
+)
+
+// unset marks TaskSaveSec, TaskSaveIds and TaskBackups left empty. 0 is a
+// valid value of theirs, so readLayered starts them from unset instead.
+const unset = -1
+
+// ValidationError lists every problem found in a config and its tasks.
+type ValidationError struct {
+	Problems []string
+}
+
+func (e *ValidationError) Error() string {
+	return "Invalid config:\n  " + strings.Join(e.Problems, "\n  ")
+}
+
+func (e *ValidationError) add(format string, a ...interface{}) {
+	e.Problems = append(e.Problems, fmt.Sprintf(format, a...))
+}
+
+// ApplyDefaults fills the fields of c left empty, and TaskSaveSec,
+// TaskSaveIds and TaskBackups when unset.
+func ApplyDefaults(c *model.ScraperConfig) {
+	if c.ThreadNum == 0 {
+		c.ThreadNum = DefaultThreadNum
+	}
+	if c.TaskSaveSec == unset {
+		c.TaskSaveSec = DefaultTaskSaveSec
+	}
+	if c.TaskSaveIds == unset {
+		c.TaskSaveIds = DefaultTaskSaveIds
+	}
+	if c.TaskBackups == unset {
+		c.TaskBackups = DefaultTaskBackups
+	}
+	if c.LeaseIds == 0 {
+		c.LeaseIds = DefaultLeaseIds
+	}
+	if c.LeaseSec == 0 {
+		c.LeaseSec = DefaultLeaseSec
+	}
+	if len(c.DataFolder) == 0 {
+		c.DataFolder = DefaultDataFolder
+	}
+	if len(c.ArchiveFolder) == 0 {
+		c.ArchiveFolder = DefaultArchiveFolder
+	}
+	if len(c.TmpFolder) == 0 {
+		c.TmpFolder = DefaultTmpFolder
+	}
+}
+
+// writeOk is W_OK of access(2).
+const writeOk = 0x2
+
+// checkWritable checks that folder, or else its nearest existing parent where
+// the scraper will create it, is a folder files can be written in. It
+// creates nothing, so that checking a config has no side effect.
+func checkWritable(folder string) error {
+	p := filepath.Clean(folder)
+	for {
+		info, err := os.Stat(p)
+		if err == nil {
+			if !info.IsDir() {
+				return fmt.Errorf("%s is not a folder", p)
+			}
+			return syscall.Access(p, writeOk)
+		}
+		if !os.IsNotExist(err) {
+			return err
+		}
+		parent := filepath.Dir(p)
+		if parent == p {
+			return err
+		}
+		p = parent
+	}
+}
+
+// MakeFolders creates DataFolder, ArchiveFolder and TmpFolder of c.
+func MakeFolders(c *model.ScraperConfig) error {
+	for _, folder := range []string{c.DataFolder, c.ArchiveFolder, c.TmpFolder} {
+		if err := os.MkdirAll(folder, 0777); err != nil {
+			log.Println(err)
+			return err
+		}
+	}
+	return nil
+}
+
+// Validate checks c and tasks and returns a *ValidationError listing all
+// problems, or nil. Only task types in siteNames can be crawled.
+func Validate(c *model.ScraperConfig, tasks []model.Task, siteNames map[model.TaskType]string) error {
+	e := &ValidationError{}
+	// Workers of a coordinator need no task file.
+	if len(c.TaskFile) == 0 && len(c.Coordinator) == 0 {
+		e.add("TaskFile is not set")
+	}
+	if c.ThreadNum <= 0 {
+		e.add("ThreadNum is %d, want > 0", c.ThreadNum)
+	}
+	if c.ValidImgNum < 0 {
+		e.add("ValidImgNum is %d, want >= 0", c.ValidImgNum)
+	}
+	if c.TaskSaveSec < 0 {
+		e.add("TaskSaveSec is %d, want >= 0", c.TaskSaveSec)
+	}
+	if c.TaskSaveIds < 0 {
+		e.add("TaskSaveIds is %d, want >= 0", c.TaskSaveIds)
+	}
+	if c.TaskBackups < 0 {
+		e.add("TaskBackups is %d, want >= 0", c.TaskBackups)
+	}
+	if c.TaskConcurrency < 0 {
+		e.add("TaskConcurrency is %d, want >= 0", c.TaskConcurrency)
+	}
+	if c.LeaseIds <= 0 {
+		e.add("LeaseIds is %d, want > 0", c.LeaseIds)
+	} else if int(c.LeaseIds)%archive.ArchiveSize != 0 {
+		// Workers archive the ranges of their leases only.
+		e.add("LeaseIds is %d, want a multiple of %d, the Ids of an archive", c.LeaseIds, archive.ArchiveSize)
+	}
+	if c.LeaseSec <= 0 {
+		e.add("LeaseSec is %d, want > 0", c.LeaseSec)
+	}
+	for _, p := range c.Proxies {
+		u := p
+		if !strings.Contains(u, "://") {
+			u = "http://" + u
+		}
+		if parsed, err := url.Parse(u); err != nil || len(parsed.Host) == 0 {
+			e.add("Invalid proxy %q", p)
+		}
+	}
+	for name, folder := range map[string]string{
+		"DataFolder":    c.DataFolder,
+		"ArchiveFolder": c.ArchiveFolder,
+		"TmpFolder":     c.TmpFolder,
+	} {
+		if err := checkWritable(folder); err != nil {
+			e.add("%s %q is not writable: %v", name, folder, err)
+		}
+	}
+
+	// Link tasks keep their frontier in their folder.
+	linkFolders := make(map[string]int)
+	for i, t := range tasks {
+		if _, ok := siteNames[t.GetType()]; !ok {
+			e.add("Task %d: unknown TaskType %v", i, t.GetType())
+		}
+		if err := model.CheckType(t); err != nil {
+			e.add("Task %d: %v", i, err)
+			continue
+		}
+		s := t.GetSocialImageTask()
+		if _, ok := model.TaskState_name[int32(s.GetState())]; !ok {
+			e.add("Task %d: unknown State %v", i, s.GetState())
+		}
+		if l := s.GetLimits(); l != nil && (l.Threads < 0 || l.Weight < 0) {
+			e.add("Task %d: Threads %d and Weight %d must be >= 0", i, l.Threads, l.Weight)
+		}
+		p, images, sitemap, links := s.GetIdProfileTask(), s.GetImageTask(), s.GetSitemapTask(), s.GetLinkTask()
+		kinds := 0
+		for _, set := range []bool{p != nil, images != nil, sitemap != nil, links != nil} {
+			if set {
+				kinds++
+			}
+		}
+		if kinds != 1 {
+			e.add("Task %d: has %d of IdProfileTask, ImageTask, SitemapTask and LinkTask, want 1", i, kinds)
+			continue
+		}
+		if links != nil {
+			validateLinkTask(e, i, links)
+			folder := links.Folder
+			if len(folder) == 0 {
+				folder = siteNames[t.GetType()] + "Links"
+			}
+			if j, ok := linkFolders[folder]; ok {
+				e.add("Task %d: LinkTask Folder %q is used by task %d too", i, folder, j)
+			}
+			linkFolders[folder] = i
+			continue
+		}
+		if images != nil {
+			validateImageTask(e, i, images)
+			continue
+		}
+		if sitemap != nil {
+			validateSitemapTask(e, i, sitemap)
+			continue
+		}
+		if p.BeginId <= 0 {
+			e.add("Task %d: BeginId is %d, want > 0", i, p.BeginId)
+		}
+		if p.BeginId >= p.EndId {
+			e.add("Task %d: BeginId %d is not below EndId %d", i, p.BeginId, p.EndId)
+		}
+	}
+
+	if len(e.Problems) > 0 {
+		return e
+	}
+	return nil
+}
+
+// ValidUrl tells whether u is an http or https URL, as the images of an
+// ImageTask and sitemaps must be.
+func ValidUrl(u string) bool {
+	parsed, err := url.Parse(u)
+	return err == nil && (parsed.Scheme == "http" || parsed.Scheme == "https") && len(parsed.Host) > 0
+}
+
+func validateImageTask(e *ValidationError, i int, t *model.ImageTask) {
+	if len(t.Images) == 0 && len(t.UrlFile) == 0 {
+		e.add("Task %d: ImageTask has no Images or UrlFile", i)
+	}
+	for j, image := range t.Images {
+		if !ValidUrl(image.Url) {
+			e.add("Task %d: invalid image %d URL %q", i, j, image.Url)
+		}
+	}
+	if len(t.UrlFile) > 0 {
+		if _, err := os.Stat(t.UrlFile); err != nil {
+			e.add("Task %d: cannot read UrlFile: %v", i, err)
+		}
+	}
+	if t.FirstId < 0 || t.Next < 0 {
+		e.add("Task %d: FirstId %d and Next %d must be >= 0", i, t.FirstId, t.Next)
+	}
+}
+
+func validateSitemapTask(e *ValidationError, i int, t *model.SitemapTask) {
+	if !ValidUrl(t.Url) {
+		e.add("Task %d: invalid sitemap URL %q", i, t.Url)
+	}
+	if _, err := regexp.Compile(t.UrlPattern); err != nil {
+		e.add("Task %d: invalid UrlPattern: %v", i, err)
+	}
+	if t.Sitemap < 0 || t.Next < 0 {
+		e.add("Task %d: Sitemap %d and Next %d must be >= 0", i, t.Sitemap, t.Next)
+	}
+}
+
+func validateLinkTask(e *ValidationError, i int, t *model.LinkTask) {
+	if len(t.Seeds) == 0 {
+		e.add("Task %d: LinkTask has no Seeds", i)
+	}
+	for _, seed := range t.Seeds {
+		if !ValidUrl(seed) {
+			e.add("Task %d: invalid seed %q", i, seed)
+		}
+	}
+	if _, err := frontier.NewScope(t.Seeds, t.Hosts, t.AllowPaths, t.DenyPaths); err != nil {
+		e.add("Task %d: invalid scope: %v", i, err)
+	}
+	if _, err := regexp.Compile(t.ImagePattern); err != nil {
+		e.add("Task %d: invalid ImagePattern: %v", i, err)
+	}
+	if t.MaxDepth < 0 || t.Next < 0 {
+		e.add("Task %d: MaxDepth %d and Next %d must be >= 0", i, t.MaxDepth, t.Next)
+	}
+}
+
+// Load reads the config from file with its overrides and the task file it
+// names, and validates them, so the scraper fails before crawling anything.
+func Load(file string, fs *flag.FlagSet, siteNames map[model.TaskType]string) (*Config, *TaskStore, error) {
+	if len(file) == 0 {
+		return nil, nil, &ValidationError{Problems: []string{"No config file"}}
+	}
+	c, _, err := readLayered(file, fs)
+	if err != nil {
+		if e, ok := err.(*ValidationError); ok {
+			return nil, nil, e
+		}
+		return nil, nil, &ValidationError{Problems: []string{err.Error()}}
+	}
+
+	e := &ValidationError{}
+	var store *TaskStore
+	var tasks []model.Task
+	if len(c.TaskFile) > 0 {
+		store, err = NewTaskStore(c.TaskFile)
+		if err != nil {
+			e.add("Cannot read tasks from %s: %v", c.TaskFile, err)
+		} else if tasks = store.Tasks(); len(tasks) == 0 {
+			e.add("No task in %s", c.TaskFile)
+		}
+	}
+	if err = Validate(c, tasks, siteNames); err != nil {
+		e.Problems = append(e.Problems, err.(*ValidationError).Problems...)
+	}
+	if len(e.Problems) > 0 {
+		return nil, nil, e
+	}
+	if store != nil {
+		store.Configure(c)
+	}
+	return &Config{File: file, flags: fs, current: c}, store, nil
+}
+
+// Reload re-reads the config file, still overridden by the environment and
+// flags, and puts it in use. The files and folders the scraper works in
+// cannot change while it runs; changes to them are logged and the running
+// values kept. The running config stays when the new one is invalid.
+func (cfg *Config) Reload() (*model.ScraperConfig, error) {
+	c, _, err := readLayered(cfg.File, cfg.flags)
+	if err != nil {
+		return nil, err
+	}
+	cfg.lock.Lock()
+	defer cfg.lock.Unlock()
+	if old := cfg.current; old != nil {
+		for name, fields := range map[string][2]*string{
+			"TaskFile":      {&old.TaskFile, &c.TaskFile},
+			"Coordinator":   {&old.Coordinator, &c.Coordinator},
+			"Control":       {&old.Control, &c.Control},
+			"DataFolder":    {&old.DataFolder, &c.DataFolder},
+			"ArchiveFolder": {&old.ArchiveFolder, &c.ArchiveFolder},
+			"TmpFolder":     {&old.TmpFolder, &c.TmpFolder},
+		} {
+			if *fields[0] != *fields[1] {
+				log.Printf("Cannot change %s from %q to %q while running, restart to apply.\n", name, *fields[0], *fields[1])
+				*fields[1] = *fields[0]
+			}
+		}
+	}
+	err = Validate(c, nil, nil)
+	if err != nil {
+		return nil, err
+	}
+	cfg.current = c
+	return c, nil
+}
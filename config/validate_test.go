@@ -0,0 +1,103 @@
+package config
+
+import (
+	"github.com/charleswong/scraper/model"
+	"io/ioutil"
+	"os"
+	"path"
+	"testing"
+)
+
+func TestValidateReportsAllProblems(t *testing.T) {
+	dir, err := ioutil.TempDir("", "config")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	c := &model.ScraperConfig{
+		TaskFile:  path.Join(dir, "jiayuan.task"),
+		ThreadNum: -1,
+		LeaseIds:  15000,
+		Proxies:   []string{"localhost:1081", "http://"},
+	}
+	ApplyDefaults(c)
+	c.DataFolder = path.Join(dir, "deepavatar")
+	c.ArchiveFolder = path.Join(dir, "avatar_tars")
+	c.TmpFolder = path.Join(dir, "deep_tmp")
+	tasks := []model.Task{
+		&model.SocialImageTask{
+			Type:          model.TaskType_JIAYUAN,
+			IdProfileTask: &model.IdProfileTask{BeginId: 200, EndId: 100},
+		},
+		&model.SocialImageTask{Type: model.TaskType_RENREN},
+		&model.SocialImageTask{
+			Type:      model.TaskType_JIAYUAN,
+			ImageTask: &model.ImageTask{Images: []*model.ImageUrl{{Url: "http://a.com/1.jpg"}, {Url: "ftp://a.com/2.jpg"}}},
+		},
+		&model.JiayuanTask{SocialImageTask: &model.SocialImageTask{
+			Type:          model.TaskType_BAIHE,
+			IdProfileTask: &model.IdProfileTask{BeginId: 1, EndId: 100},
+		}},
+	}
+	siteNames := map[model.TaskType]string{model.TaskType_JIAYUAN: "Jiayuan"}
+
+	err = Validate(c, tasks, siteNames)
+	e, ok := err.(*ValidationError)
+	if !ok {
+		t.Fatalf("Validate returned %v, want a ValidationError", err)
+	}
+	// ThreadNum, LeaseIds, the second proxy, the range of task 0, the type
+	// and IdProfileTask of task 1, the second image of task 2 and the type of
+	// the SocialImageTask of task 3.
+	if len(e.Problems) != 8 {
+		t.Fatalf("Got problems:\n%v", e)
+	}
+
+	c.ThreadNum = 0
+	c.LeaseIds = 0
+	c.Proxies = nil
+	ApplyDefaults(c)
+	tasks[0].GetSocialImageTask().GetIdProfileTask().BeginId = 1
+	if err := Validate(c, tasks[:1], siteNames); err != nil {
+		t.Fatal(err)
+	}
+	if c.ThreadNum != DefaultThreadNum {
+		t.Fatalf("ThreadNum is %d, want the default %d", c.ThreadNum, DefaultThreadNum)
+	}
+}
+
+func TestValidateCreatesNoFolders(t *testing.T) {
+	dir, err := ioutil.TempDir("", "config")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	file := path.Join(dir, "file")
+	if err := ioutil.WriteFile(file, nil, 0666); err != nil {
+		t.Fatal(err)
+	}
+
+	c := &model.ScraperConfig{TaskFile: path.Join(dir, "jiayuan.task")}
+	ApplyDefaults(c)
+	c.DataFolder = path.Join(dir, "deepavatar", "Jiayuan")
+	c.ArchiveFolder = path.Join(dir, "avatar_tars")
+	c.TmpFolder = path.Join(file, "deep_tmp")
+	err = Validate(c, nil, nil)
+	if e, ok := err.(*ValidationError); !ok || len(e.Problems) != 1 {
+		t.Fatalf("Validate returned %v, want TmpFolder under a file only", err)
+	}
+	if _, err := os.Stat(path.Join(dir, "deepavatar")); !os.IsNotExist(err) {
+		t.Fatalf("Validate created DataFolder: %v", err)
+	}
+
+	c.TmpFolder = path.Join(dir, "deep_tmp")
+	if err := MakeFolders(c); err != nil {
+		t.Fatal(err)
+	}
+	for _, folder := range []string{c.DataFolder, c.ArchiveFolder, c.TmpFolder} {
+		if info, err := os.Stat(folder); err != nil || !info.IsDir() {
+			t.Fatalf("MakeFolders left %s out: %v", folder, err)
+		}
+	}
+}
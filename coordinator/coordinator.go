@@ -0,0 +1,68 @@
+package main
+
+import (
+	"flag"
+	"github.com/charleswong/scraper/config"
+	"github.com/charleswong/scraper/lease"
+	"github.com/charleswong/scraper/model"
+	"google.golang.org/grpc"
+	"log"
+	"net"
+	"os"
+	"os/signal"
+	"syscall"
+	"time"
+)
+
+// The coordinator leases the Id ranges of the task file to scrapers run
+// with -coordinator, and listens on the Coordinator address of the config.
+func main() {
+	log.SetFlags(log.Lshortfile | log.LstdFlags)
+	configFile := flag.String("config", "scraper.conf", "Config file.")
+	config.RegisterFlags(flag.CommandLine)
+	flag.Parse()
+
+	conf, store, err := config.Load(*configFile, flag.CommandLine, model.SiteName)
+	if err != nil {
+		log.Fatal(err)
+	}
+	c := conf.Get()
+	if len(c.Coordinator) == 0 || store == nil {
+		log.Fatal("The coordinator needs a TaskFile and the Coordinator address to listen on.")
+	}
+	if err := store.LockFile(); err != nil {
+		log.Fatal(err)
+	}
+	if err := store.Migrate(); err != nil {
+		log.Fatal(err)
+	}
+	lis, err := net.Listen("tcp", c.Coordinator)
+	if err != nil {
+		log.Fatal(err)
+	}
+	s := grpc.NewServer()
+	model.RegisterCoordinatorServer(s, lease.NewCoordinator(store, conf))
+	go func() {
+		if err := s.Serve(lis); err != nil {
+			log.Fatal(err)
+		}
+	}()
+	log.Println("Coordinating", c.TaskFile, "on", c.Coordinator)
+
+	sigChan := make(chan os.Signal, 1)
+	signal.Notify(sigChan, syscall.SIGINT, syscall.SIGTERM)
+	for {
+		select {
+		case <-sigChan:
+			s.Stop()
+			if err := store.Close(); err != nil {
+				log.Println(err)
+			}
+			return
+		case <-time.After(time.Second):
+			if err := store.SaveIfDue(); err != nil {
+				log.Println(err)
+			}
+		}
+	}
+}
@@ -0,0 +1,112 @@
+package frontier
+
+import (
+	"bufio"
+	"bytes"
+	"fmt"
+	"io/ioutil"
+	"log"
+	"os"
+	"strconv"
+	"strings"
+	"sync"
+)
+
+// Entry is a page to crawl and its distance in links from a seed.
+type Entry struct {
+	Url   string
+	Depth int
+}
+
+// Frontier is the queue of a breadth first crawl. Every URL is queued once.
+// The queue is kept in File, one "url<TAB>depth" line per entry, so a crawl
+// resumes with the same entries at the same positions after a restart.
+type Frontier struct {
+	File string
+
+	lock    sync.Mutex
+	entries []Entry
+	seen    map[string]bool
+	out     *os.File
+}
+
+// Open reads the entries already in file and appends new ones to it.
+func Open(file string) (*Frontier, error) {
+	f := &Frontier{File: file, seen: make(map[string]bool)}
+	data, err := ioutil.ReadFile(file)
+	if err != nil && !os.IsNotExist(err) {
+		log.Println(err)
+		return nil, err
+	}
+	// A crash may leave a partial last line.
+	if i := bytes.LastIndexByte(data, '\n'); i+1 < len(data) {
+		data = data[:i+1]
+		if err := os.Truncate(file, int64(len(data))); err != nil {
+			log.Println(err)
+			return nil, err
+		}
+	}
+	scanner := bufio.NewScanner(bytes.NewReader(data))
+	scanner.Buffer(make([]byte, 64*1024), 1024*1024)
+	for scanner.Scan() {
+		parts := strings.Split(scanner.Text(), "\t")
+		if len(parts) != 2 {
+			return nil, fmt.Errorf("%s: invalid line %q", file, scanner.Text())
+		}
+		depth, err := strconv.Atoi(parts[1])
+		if err != nil {
+			return nil, fmt.Errorf("%s: invalid line %q", file, scanner.Text())
+		}
+		f.entries = append(f.entries, Entry{Url: parts[0], Depth: depth})
+		f.seen[parts[0]] = true
+	}
+	if err := scanner.Err(); err != nil {
+		return nil, err
+	}
+	f.out, err = os.OpenFile(file, os.O_WRONLY|os.O_APPEND|os.O_CREATE, 0666)
+	if err != nil {
+		log.Println(err)
+		return nil, err
+	}
+	return f, nil
+}
+
+// Add queues url at depth unless it was queued before, and tells whether it
+// was added.
+func (f *Frontier) Add(url string, depth int) (bool, error) {
+	f.lock.Lock()
+	defer f.lock.Unlock()
+	if f.seen[url] {
+		return false, nil
+	}
+	_, err := fmt.Fprintf(f.out, "%s\t%d\n", url, depth)
+	if err != nil {
+		log.Println(err)
+		return false, err
+	}
+	f.seen[url] = true
+	f.entries = append(f.entries, Entry{Url: url, Depth: depth})
+	return true, nil
+}
+
+// Get returns the entry at position i, if queued yet.
+func (f *Frontier) Get(i int) (Entry, bool) {
+	f.lock.Lock()
+	defer f.lock.Unlock()
+	if i < 0 || i >= len(f.entries) {
+		return Entry{}, false
+	}
+	return f.entries[i], true
+}
+
+func (f *Frontier) Len() int {
+	f.lock.Lock()
+	defer f.lock.Unlock()
+	return len(f.entries)
+}
+
+func (f *Frontier) Close() error {
+	f.lock.Lock()
+	defer f.lock.Unlock()
+	return f.out.Close()
+}
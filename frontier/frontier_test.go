@@ -0,0 +1,92 @@
+package frontier
+
+import (
+	"io/ioutil"
+	"os"
+	"path"
+	"testing"
+)
+
+func TestCanonicalize(t *testing.T) {
+	for u, want := range map[string]string{
+		"HTTP://Www.A.com:80":                      "http://www.a.com/",
+		"http://a.com/x/../y/./z?b=2&a=1#top":      "http://a.com/y/z?a=1&b=2",
+		"https://a.com:443/p?utm_source=x&id=3":    "https://a.com/p?id=3",
+		"https://user@a.com:8443/%E4%BD%A0?":       "https://a.com:8443/%E4%BD%A0",
+		"http://a.com/profile?oppId=1&oppId=0#pic": "http://a.com/profile?oppId=0&oppId=1",
+	} {
+		got, err := Canonicalize(u)
+		if err != nil || got != want {
+			t.Errorf("Canonicalize(%q) = %q, %v, want %q", u, got, err, want)
+		}
+	}
+	for _, u := range []string{"mailto:a@a.com", "javascript:void(0)", "/relative"} {
+		if got, err := Canonicalize(u); err == nil {
+			t.Errorf("Canonicalize(%q) = %q, want an error", u, got)
+		}
+	}
+}
+
+func TestScope(t *testing.T) {
+	s, err := NewScope([]string{"http://www.a.com/"}, []string{"www.a.com", "*.img.a.com"}, []string{"^/u/"}, []string{"/logout$"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	for u, want := range map[string]bool{
+		"http://www.a.com/u/1":        true,
+		"http://img.a.com/u/1":        true,
+		"http://cdn.img.a.com/u/1":    true,
+		"http://b.com/u/1":            false,
+		"http://www.a.com/about":      false,
+		"http://www.a.com/u/1/logout": false,
+	} {
+		if got := s.Contains(u); got != want {
+			t.Errorf("Contains(%q) = %v, want %v", u, got, want)
+		}
+	}
+	s, err = NewScope([]string{"http://www.a.com/"}, nil, nil, nil)
+	if err != nil || !s.Contains("http://www.a.com/x") || s.Contains("http://a.com/x") {
+		t.Fatalf("Seed hosts scope %v, %v", s, err)
+	}
+}
+
+func TestFrontierResumes(t *testing.T) {
+	dir, err := ioutil.TempDir("", "frontier")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	file := path.Join(dir, "links.frontier")
+
+	f, err := Open(file)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, u := range []string{"http://a.com/", "http://a.com/1", "http://a.com/"} {
+		f.Add(u, 1)
+	}
+	if f.Len() != 2 {
+		t.Fatalf("Queued %d entries, want 2", f.Len())
+	}
+	f.Close()
+
+	// A partial line left by a crash is dropped.
+	out, _ := os.OpenFile(file, os.O_WRONLY|os.O_APPEND, 0666)
+	out.WriteString("http://a.com/2\t")
+	out.Close()
+
+	f, err = Open(file)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer f.Close()
+	if added, _ := f.Add("http://a.com/1", 2); added {
+		t.Fatal("Queued a URL twice")
+	}
+	if added, _ := f.Add("http://a.com/2", 2); !added {
+		t.Fatal("Did not queue a new URL")
+	}
+	if e, ok := f.Get(2); !ok || e.Url != "http://a.com/2" || e.Depth != 2 {
+		t.Fatalf("Entry 2 is %v, %v", e, ok)
+	}
+}
@@ -0,0 +1,129 @@
+package frontier
+
+import (
+	"fmt"
+	"net/url"
+	"regexp"
+	"sort"
+	"strings"
+)
+
+// Canonicalize normalizes u so that the URLs of a page compare equal: it
+// lowercases the scheme and host, drops default ports, fragments, empty
+// queries and utm_* parameters, sorts the query and cleans the path.
+func Canonicalize(u string) (string, error) {
+	parsed, err := url.Parse(strings.TrimSpace(u))
+	if err != nil {
+		return "", err
+	}
+	if parsed.Scheme != "http" && parsed.Scheme != "https" {
+		return "", fmt.Errorf("Not an http URL: %q", u)
+	}
+	parsed.Scheme = strings.ToLower(parsed.Scheme)
+	host := strings.ToLower(parsed.Host)
+	if parsed.Scheme == "http" {
+		host = strings.TrimSuffix(host, ":80")
+	} else {
+		host = strings.TrimSuffix(host, ":443")
+	}
+	if len(host) == 0 {
+		return "", fmt.Errorf("No host in %q", u)
+	}
+	parsed.Host = host
+	parsed.User = nil
+	parsed.Fragment = ""
+	parsed.RawFragment = ""
+	// Resolving against the URL itself removes . and .. segments.
+	parsed = parsed.ResolveReference(&url.URL{Path: parsed.Path, RawPath: parsed.RawPath, RawQuery: parsed.RawQuery})
+	if len(parsed.Path) == 0 {
+		parsed.Path = "/"
+	}
+
+	query := parsed.Query()
+	for key := range query {
+		if strings.HasPrefix(strings.ToLower(key), "utm_") {
+			delete(query, key)
+		}
+	}
+	for _, values := range query {
+		sort.Strings(values)
+	}
+	// Encode sorts by key.
+	parsed.RawQuery = query.Encode()
+	return parsed.String(), nil
+}
+
+// Scope decides which URLs a crawl follows: those on its hosts, with a path
+// matching one of Allow, if any, and none of Deny.
+type Scope struct {
+	Hosts []string
+	Allow []*regexp.Regexp
+	Deny  []*regexp.Regexp
+}
+
+// NewScope makes a scope for hosts, or the hosts of seeds when hosts is
+// empty. A host "*.a.com" matches a.com and its subdomains. allow and deny
+// are regular expressions of paths.
+func NewScope(seeds, hosts, allow, deny []string) (*Scope, error) {
+	s := &Scope{}
+	for _, h := range hosts {
+		s.Hosts = append(s.Hosts, strings.ToLower(h))
+	}
+	if len(s.Hosts) == 0 {
+		for _, seed := range seeds {
+			parsed, err := url.Parse(seed)
+			if err != nil {
+				return nil, err
+			}
+			s.Hosts = append(s.Hosts, strings.ToLower(parsed.Hostname()))
+		}
+	}
+	for _, p := range allow {
+		r, err := regexp.Compile(p)
+		if err != nil {
+			return nil, err
+		}
+		s.Allow = append(s.Allow, r)
+	}
+	for _, p := range deny {
+		r, err := regexp.Compile(p)
+		if err != nil {
+			return nil, err
+		}
+		s.Deny = append(s.Deny, r)
+	}
+	return s, nil
+}
+
+// Contains tells whether the crawl follows the canonical URL u.
+func (s *Scope) Contains(u string) bool {
+	parsed, err := url.Parse(u)
+	if err != nil {
+		return false
+	}
+	host := parsed.Hostname()
+	inHosts := false
+	for _, h := range s.Hosts {
+		if host == h || (strings.HasPrefix(h, "*.") && (host == h[2:] || strings.HasSuffix(host, h[1:]))) {
+			inHosts = true
+			break
+		}
+	}
+	if !inHosts {
+		return false
+	}
+	for _, r := range s.Deny {
+		if r.MatchString(parsed.Path) {
+			return false
+		}
+	}
+	if len(s.Allow) == 0 {
+		return true
+	}
+	for _, r := range s.Allow {
+		if r.MatchString(parsed.Path) {
+			return true
+		}
+	}
+	return false
+}
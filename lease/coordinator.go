@@ -0,0 +1,217 @@
+package lease
+
+import (
+	"github.com/charleswong/scraper/config"
+	"github.com/charleswong/scraper/model"
+	"golang.org/x/net/context"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+	"log"
+	"sync"
+	"time"
+)
+
+// Coordinator serves model.CoordinatorServer. It leases the Id ranges of
+// the IdProfileTasks of a TaskStore to workers, LeaseIds Ids at a time and
+// in task order. The ranges leased and not completed yet are kept in the
+// task file, so they go to workers again after a restart.
+type Coordinator struct {
+	store *config.TaskStore
+	conf  *config.Config
+
+	lock sync.Mutex
+	// lastId starts from the time the coordinator started, so leases from
+	// before a restart are never taken for new ones.
+	lastId int64
+	leases map[int64]*lease
+	// now is time.Now but in tests.
+	now func() time.Time
+}
+
+type lease struct {
+	worker  string
+	task    model.Task
+	r       *model.IdRange
+	expires time.Time
+}
+
+func NewCoordinator(store *config.TaskStore, conf *config.Config) *Coordinator {
+	return &Coordinator{
+		store:  store,
+		conf:   conf,
+		lastId: time.Now().UnixNano(),
+		leases: make(map[int64]*lease),
+		now:    time.Now,
+	}
+}
+
+func (c *Coordinator) leaseSec() time.Duration {
+	return time.Duration(c.conf.Get().LeaseSec) * time.Second
+}
+
+// expire drops the leases without heartbeat for LeaseSec. c.lock must be
+// held.
+func (c *Coordinator) expire() {
+	now := c.now()
+	for id, l := range c.leases {
+		if now.After(l.expires) {
+			log.Printf("Lease %d of %s on %d-%d expired.\n", id, l.worker, l.r.BeginId, l.r.EndId)
+			delete(c.leases, id)
+		}
+	}
+}
+
+func (c *Coordinator) leased(r *model.IdRange) bool {
+	for _, l := range c.leases {
+		if l.r == r {
+			return true
+		}
+	}
+	return false
+}
+
+// nextLease is the first Id of t not leased yet.
+func nextLease(t *model.IdProfileTask) int64 {
+	if t.NextLease > 0 {
+		return t.NextLease
+	}
+	return t.BeginId - 1
+}
+
+// free returns a range of t to lease: one whose lease expired, or else a
+// new one. c.lock must be held.
+func (c *Coordinator) free(t *model.IdProfileTask) (*model.IdRange, error) {
+	for _, r := range t.Leased {
+		if !c.leased(r) {
+			return r, nil
+		}
+	}
+	next := nextLease(t)
+	if next >= t.EndId {
+		return nil, nil
+	}
+	size := int64(c.conf.Get().LeaseIds)
+	r := &model.IdRange{BeginId: next, EndId: (next/size + 1) * size}
+	if r.EndId > t.EndId {
+		r.EndId = t.EndId
+	}
+	err := c.store.Update(func() {
+		t.Leased = append(t.Leased, r)
+		t.NextLease = r.EndId
+	})
+	return r, err
+}
+
+// done tells whether every Id of t was leased and completed.
+func done(t *model.IdProfileTask) bool {
+	return nextLease(t) >= t.EndId && len(t.Leased) == 0
+}
+
+func (c *Coordinator) Lease(ctx context.Context, req *model.LeaseRequest) (*model.IdLease, error) {
+	c.lock.Lock()
+	defer c.lock.Unlock()
+	c.expire()
+	finished := len(c.leases) == 0
+	for _, task := range c.store.Tasks() {
+		t := task.GetSocialImageTask().GetIdProfileTask()
+		if t == nil || !task.GetSocialImageTask().GetState().Runnable() {
+			continue
+		}
+		r, err := c.free(t)
+		if err != nil {
+			log.Println(err)
+			return nil, err
+		}
+		if r == nil {
+			finished = finished && done(t)
+			continue
+		}
+		if task.GetSocialImageTask().GetState() != model.TaskState_RUNNING {
+			if err := c.store.SetState(task, model.TaskState_RUNNING, nil); err != nil {
+				log.Println(err)
+			}
+		}
+		c.lastId++
+		c.leases[c.lastId] = &lease{
+			worker:  req.Worker,
+			task:    task,
+			r:       r,
+			expires: c.now().Add(c.leaseSec()),
+		}
+		log.Printf("Lease %d: %d-%d of %v to %s.\n", c.lastId, r.BeginId, r.EndId, task.GetType(), req.Worker)
+		return &model.IdLease{
+			Id:       c.lastId,
+			Type:     task.GetType(),
+			BeginId:  r.BeginId,
+			EndId:    r.EndId,
+			LeaseSec: c.conf.Get().LeaseSec,
+		}, nil
+	}
+	return &model.IdLease{Finished: finished}, nil
+}
+
+// get returns lease id of worker, or an error when it expired or is not
+// leased to worker. c.lock must be held.
+func (c *Coordinator) get(id int64, worker string) (*lease, error) {
+	c.expire()
+	l, ok := c.leases[id]
+	if !ok {
+		return nil, status.Errorf(codes.NotFound, "Lease %d expired.", id)
+	}
+	if l.worker != worker {
+		return nil, status.Errorf(codes.NotFound, "Lease %d is not leased to %s.", id, worker)
+	}
+	return l, nil
+}
+
+func (c *Coordinator) Heartbeat(ctx context.Context, req *model.HeartbeatRequest) (*model.HeartbeatReply, error) {
+	c.lock.Lock()
+	defer c.lock.Unlock()
+	l, err := c.get(req.Lease, req.Worker)
+	if err != nil {
+		return nil, err
+	}
+	if req.Next < l.r.BeginId || req.Next > l.r.EndId {
+		return nil, status.Errorf(codes.InvalidArgument, "Next %d is out of lease %d, %d-%d.", req.Next, req.Lease, l.r.BeginId, l.r.EndId)
+	}
+	l.expires = c.now().Add(c.leaseSec())
+	if req.Next > l.r.BeginId {
+		err = c.store.Update(func() {
+			l.r.BeginId = req.Next
+		})
+		if err != nil {
+			log.Println(err)
+		}
+	}
+	return &model.HeartbeatReply{}, nil
+}
+
+func (c *Coordinator) Complete(ctx context.Context, req *model.CompleteRequest) (*model.CompleteReply, error) {
+	c.lock.Lock()
+	defer c.lock.Unlock()
+	l, err := c.get(req.Lease, req.Worker)
+	if err != nil {
+		return nil, err
+	}
+	delete(c.leases, req.Lease)
+	t := l.task.GetSocialImageTask().GetIdProfileTask()
+	err = c.store.Update(func() {
+		for i, r := range t.Leased {
+			if r == l.r {
+				t.Leased = append(t.Leased[:i], t.Leased[i+1:]...)
+				break
+			}
+		}
+	})
+	if err != nil {
+		log.Println(err)
+	}
+	log.Printf("Lease %d: %s completed %d-%d.\n", req.Lease, l.worker, l.r.BeginId, l.r.EndId)
+	if done(t) {
+		if err := c.store.SetState(l.task, model.TaskState_COMPLETED, nil); err != nil {
+			log.Println(err)
+		}
+		log.Printf("%v task %d-%d completed.\n", l.task.GetType(), t.BeginId, t.EndId)
+	}
+	return &model.CompleteReply{}, nil
+}
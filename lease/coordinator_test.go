@@ -0,0 +1,101 @@
+package lease
+
+import (
+	"github.com/charleswong/scraper/config"
+	"github.com/charleswong/scraper/model"
+	"golang.org/x/net/context"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+	"io/ioutil"
+	"os"
+	"path"
+	"testing"
+	"time"
+)
+
+func TestCoordinatorLeasesAndReassigns(t *testing.T) {
+	dir, err := ioutil.TempDir("", "lease")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	taskFile := path.Join(dir, "jiayuan.task")
+	err = ioutil.WriteFile(taskFile, []byte(`{"Tasks":[{"JiayuanTask":{"SocialImageTask":{"IdProfileTask":{"BeginId":"121","EndId":"250"}}}}]}`), 0666)
+	if err != nil {
+		t.Fatal(err)
+	}
+	configFile := path.Join(dir, "scraper.conf")
+	err = ioutil.WriteFile(configFile, []byte(`{"TaskFile":"`+taskFile+`","LeaseIds":100,"LeaseSec":60}`), 0666)
+	if err != nil {
+		t.Fatal(err)
+	}
+	conf, err := config.NewConfig(configFile, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	store, err := config.NewTaskStore(taskFile)
+	if err != nil {
+		t.Fatal(err)
+	}
+	c := NewCoordinator(store, conf)
+	now := time.Unix(1000, 0)
+	c.now = func() time.Time { return now }
+
+	lease := func(want *model.IdLease) *model.IdLease {
+		l, err := c.Lease(context.Background(), &model.LeaseRequest{Worker: "w"})
+		if err != nil {
+			t.Fatal(err)
+		}
+		if l.BeginId != want.BeginId || l.EndId != want.EndId || l.Finished != want.Finished || (l.Id == 0) != (want.EndId == 0) {
+			t.Fatalf("Leased %v, want %v", l, want)
+		}
+		return l
+	}
+	// Leases end on multiples of LeaseIds, starting from BeginId-1.
+	a := lease(&model.IdLease{BeginId: 120, EndId: 200})
+	b := lease(&model.IdLease{BeginId: 200, EndId: 250})
+	lease(&model.IdLease{})
+
+	if _, err := c.Heartbeat(context.Background(), &model.HeartbeatRequest{Lease: a.Id, Next: 150, Worker: "w"}); err != nil {
+		t.Fatal(err)
+	}
+	// Only the worker holding a lease keeps it.
+	if _, err := c.Heartbeat(context.Background(), &model.HeartbeatRequest{Lease: a.Id, Next: 190, Worker: "x"}); status.Code(err) != codes.NotFound {
+		t.Fatalf("Heartbeat of another worker returned %v", err)
+	}
+	if _, err := c.Complete(context.Background(), &model.CompleteRequest{Lease: a.Id, Worker: "x"}); status.Code(err) != codes.NotFound {
+		t.Fatalf("Complete of another worker returned %v", err)
+	}
+	if err := store.Flush(); err != nil {
+		t.Fatal(err)
+	}
+	restarted, err := config.ReadTasks(taskFile)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if leased := restarted[0].GetSocialImageTask().GetIdProfileTask().Leased; len(leased) != 2 || leased[0].BeginId != 150 {
+		t.Fatalf("Saved leases %v, want 150-200 and 200-250", leased)
+	}
+	// A restarted coordinator does not take old leases for its own.
+	if id := NewCoordinator(store, conf).lastId; id <= b.Id {
+		t.Fatalf("Restarted coordinator leases from %d, want above %d", id, b.Id)
+	}
+
+	// Without heartbeat the ranges go to other workers, from their progress.
+	now = now.Add(2 * time.Minute)
+	if _, err := c.Heartbeat(context.Background(), &model.HeartbeatRequest{Lease: b.Id, Next: 210, Worker: "w"}); status.Code(err) != codes.NotFound {
+		t.Fatalf("Heartbeat of an expired lease returned %v", err)
+	}
+	a = lease(&model.IdLease{BeginId: 150, EndId: 200})
+	b = lease(&model.IdLease{BeginId: 200, EndId: 250})
+	for _, l := range []*model.IdLease{a, b} {
+		if _, err := c.Complete(context.Background(), &model.CompleteRequest{Lease: l.Id, Worker: "w"}); err != nil {
+			t.Fatal(err)
+		}
+	}
+	lease(&model.IdLease{Finished: true})
+	if state := store.Tasks()[0].GetSocialImageTask().GetState(); state != model.TaskState_COMPLETED {
+		t.Fatalf("Task is %v once every range completed", state)
+	}
+}
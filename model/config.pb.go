@@ -7,13 +7,32 @@ Package model is a generated protocol buffer package.
 
 It is generated from these files:
 	config.proto
+	control.proto
+	coordinator.proto
 	task.proto
 
 It has these top-level messages:
 	ScraperConfig
+	SubmitRequest
+	ListRequest
+	TaskRequest
+	TaskStatus
+	TaskList
+	TaskStats
+	LeaseRequest
+	IdLease
+	HeartbeatRequest
+	HeartbeatReply
+	CompleteRequest
+	CompleteReply
 	SocialImageTask
+	TaskLimits
 	IdProfileTask
+	IdRange
 	ImageTask
+	ImageUrl
+	SitemapTask
+	LinkTask
 	JiayuanTask
 	BaiheTask
 	RenrenTask
@@ -36,13 +55,28 @@ var _ = math.Inf
 const _ = proto.ProtoPackageIsVersion1
 
 type ScraperConfig struct {
-	TaskFile      string   `protobuf:"bytes,1,opt,name=TaskFile,json=taskFile" json:"TaskFile,omitempty"`
-	Proxies       []string `protobuf:"bytes,2,rep,name=Proxies,json=proxies" json:"Proxies,omitempty"`
-	ThreadNum     int32    `protobuf:"varint,3,opt,name=ThreadNum,json=threadNum" json:"ThreadNum,omitempty"`
-	ValidImgNum   int32    `protobuf:"varint,4,opt,name=ValidImgNum,json=validImgNum" json:"ValidImgNum,omitempty"`
-	DataFolder    string   `protobuf:"bytes,32,opt,name=DataFolder,json=dataFolder" json:"DataFolder,omitempty"`
-	ArchiveFolder string   `protobuf:"bytes,33,opt,name=ArchiveFolder,json=archiveFolder" json:"ArchiveFolder,omitempty"`
-	TmpFolder     string   `protobuf:"bytes,34,opt,name=TmpFolder,json=tmpFolder" json:"TmpFolder,omitempty"`
+	TaskFile    string   `protobuf:"bytes,1,opt,name=TaskFile,json=taskFile" json:"TaskFile,omitempty"`
+	Proxies     []string `protobuf:"bytes,2,rep,name=Proxies,json=proxies" json:"Proxies,omitempty"`
+	ThreadNum   int32    `protobuf:"varint,3,opt,name=ThreadNum,json=threadNum" json:"ThreadNum,omitempty"`
+	ValidImgNum int32    `protobuf:"varint,4,opt,name=ValidImgNum,json=validImgNum" json:"ValidImgNum,omitempty"`
+	TaskSaveSec int32    `protobuf:"varint,5,opt,name=TaskSaveSec,json=taskSaveSec" json:"TaskSaveSec,omitempty"`
+	TaskSaveIds int32    `protobuf:"varint,6,opt,name=TaskSaveIds,json=taskSaveIds" json:"TaskSaveIds,omitempty"`
+	TaskBackups int32    `protobuf:"varint,7,opt,name=TaskBackups,json=taskBackups" json:"TaskBackups,omitempty"`
+	// Tasks run at once, in the order of the task file. 0 runs them all.
+	TaskConcurrency int32 `protobuf:"varint,8,opt,name=TaskConcurrency,json=taskConcurrency" json:"TaskConcurrency,omitempty"`
+	// Address of the coordinator: the scraper crawls the ranges it leases
+	// instead of a task file, and the coordinator listens on it.
+	Coordinator string `protobuf:"bytes,9,opt,name=Coordinator,json=coordinator" json:"Coordinator,omitempty"`
+	// Ids per lease. Leases end on multiples of LeaseIds.
+	LeaseIds int32 `protobuf:"varint,10,opt,name=LeaseIds,json=leaseIds" json:"LeaseIds,omitempty"`
+	// Seconds a lease lasts without heartbeat.
+	LeaseSec int32 `protobuf:"varint,11,opt,name=LeaseSec,json=leaseSec" json:"LeaseSec,omitempty"`
+	// Address the scraper serves the Control API on. The scraper then keeps
+	// running once its tasks are done, waiting for more.
+	Control       string `protobuf:"bytes,12,opt,name=Control,json=control" json:"Control,omitempty"`
+	DataFolder    string `protobuf:"bytes,32,opt,name=DataFolder,json=dataFolder" json:"DataFolder,omitempty"`
+	ArchiveFolder string `protobuf:"bytes,33,opt,name=ArchiveFolder,json=archiveFolder" json:"ArchiveFolder,omitempty"`
+	TmpFolder     string `protobuf:"bytes,34,opt,name=TmpFolder,json=tmpFolder" json:"TmpFolder,omitempty"`
 }
 
 func (m *ScraperConfig) Reset()                    { *m = ScraperConfig{} }
@@ -55,18 +89,25 @@ func init() {
 }
 
 var fileDescriptor0 = []byte{
-	// 207 bytes of a gzipped FileDescriptorProto
-	0x1f, 0x8b, 0x08, 0x00, 0x00, 0x09, 0x6e, 0x88, 0x02, 0xff, 0xe2, 0xe2, 0x49, 0xce, 0xcf, 0x4b,
-	0xcb, 0x4c, 0xd7, 0x2b, 0x28, 0xca, 0x2f, 0xc9, 0x17, 0x62, 0xcd, 0xcd, 0x4f, 0x49, 0xcd, 0x51,
-	0x7a, 0xc9, 0xc8, 0xc5, 0x1b, 0x9c, 0x5c, 0x94, 0x58, 0x90, 0x5a, 0xe4, 0x0c, 0x96, 0x16, 0x92,
-	0xe2, 0xe2, 0x08, 0x49, 0x2c, 0xce, 0x76, 0xcb, 0xcc, 0x49, 0x95, 0x60, 0x54, 0x60, 0xd4, 0xe0,
-	0x0c, 0xe2, 0x28, 0x81, 0xf2, 0x85, 0x24, 0xb8, 0xd8, 0x03, 0x8a, 0xf2, 0x2b, 0x32, 0x53, 0x8b,
-	0x25, 0x98, 0x14, 0x98, 0x81, 0x52, 0xec, 0x05, 0x10, 0xae, 0x90, 0x0c, 0x17, 0x67, 0x48, 0x46,
-	0x51, 0x6a, 0x62, 0x8a, 0x5f, 0x69, 0xae, 0x04, 0x33, 0x50, 0x1b, 0x6b, 0x10, 0x67, 0x09, 0x4c,
-	0x40, 0x48, 0x81, 0x8b, 0x3b, 0x2c, 0x31, 0x27, 0x33, 0xc5, 0x33, 0x37, 0x1d, 0x24, 0xcf, 0x02,
-	0x96, 0xe7, 0x2e, 0x43, 0x08, 0x09, 0xc9, 0x71, 0x71, 0xb9, 0x24, 0x96, 0x24, 0xba, 0xe5, 0xe7,
-	0xa4, 0xa4, 0x16, 0x49, 0x28, 0x80, 0xed, 0xe5, 0x4a, 0x81, 0x8b, 0x08, 0xa9, 0x70, 0xf1, 0x3a,
-	0x16, 0x25, 0x67, 0x64, 0x96, 0xa5, 0x42, 0x95, 0x28, 0x82, 0x95, 0xf0, 0x26, 0x22, 0x0b, 0x82,
-	0x5d, 0x91, 0x5b, 0x00, 0x55, 0xa1, 0x04, 0x56, 0xc1, 0x59, 0x02, 0x13, 0x48, 0x62, 0x03, 0xfb,
-	0xdc, 0x18, 0x10, 0x00, 0x00, 0xff, 0xff, 0x10, 0x33, 0xc0, 0x0d, 0x09, 0x01, 0x00, 0x00,
+	// 311 bytes of a gzipped FileDescriptorProto
+	0x1f, 0x8b, 0x08, 0x00, 0x00, 0x09, 0x6e, 0x88, 0x02, 0xff, 0x54, 0x91, 0xc1, 0x6a, 0xc2, 0x40,
+	0x10, 0x86, 0xb1, 0x56, 0x93, 0x4c, 0x14, 0x61, 0x4f, 0x4b, 0x29, 0x25, 0x95, 0x1e, 0x72, 0xea,
+	0xa5, 0x4f, 0xd0, 0xa6, 0x08, 0x42, 0x29, 0x45, 0xa5, 0xf7, 0xed, 0xee, 0x56, 0x83, 0x49, 0x26,
+	0x4c, 0x56, 0x69, 0x1f, 0xba, 0xef, 0x50, 0x76, 0x8c, 0x46, 0x8f, 0xff, 0xf7, 0x7f, 0x4c, 0xb2,
+	0x33, 0x30, 0xd2, 0x58, 0x7d, 0xe7, 0xeb, 0xc7, 0x9a, 0xd0, 0xa1, 0x18, 0x94, 0x68, 0x6c, 0x31,
+	0xfd, 0xeb, 0xc3, 0x78, 0xa9, 0x49, 0xd5, 0x96, 0x32, 0xae, 0xc5, 0x0d, 0x84, 0x2b, 0xd5, 0x6c,
+	0x67, 0x79, 0x61, 0x65, 0x2f, 0xe9, 0xa5, 0xd1, 0x22, 0x74, 0x6d, 0x16, 0x12, 0x82, 0x0f, 0xc2,
+	0x9f, 0xdc, 0x36, 0xf2, 0x2a, 0xe9, 0xa7, 0xd1, 0x22, 0xa8, 0x0f, 0x51, 0xdc, 0x42, 0xb4, 0xda,
+	0x90, 0x55, 0xe6, 0x7d, 0x57, 0xca, 0x7e, 0xd2, 0x4b, 0x07, 0x8b, 0xc8, 0x1d, 0x81, 0x48, 0x20,
+	0xfe, 0x54, 0x45, 0x6e, 0xe6, 0xe5, 0xda, 0xf7, 0xd7, 0xdc, 0xc7, 0xfb, 0x0e, 0x79, 0xc3, 0x7f,
+	0x75, 0xa9, 0xf6, 0x76, 0x69, 0xb5, 0x1c, 0x1c, 0x0c, 0xd7, 0xa1, 0x73, 0x63, 0x6e, 0x1a, 0x39,
+	0xbc, 0x34, 0xe6, 0xa6, 0x39, 0x1a, 0x2f, 0x4a, 0x6f, 0x77, 0x75, 0x23, 0x83, 0xce, 0x68, 0x91,
+	0x48, 0x61, 0xe2, 0x8d, 0x0c, 0x2b, 0xbd, 0x23, 0xb2, 0x95, 0xfe, 0x95, 0x21, 0x5b, 0x13, 0x77,
+	0x89, 0xfd, 0xac, 0x0c, 0x91, 0x4c, 0x5e, 0x29, 0x87, 0x24, 0x23, 0x5e, 0x44, 0xac, 0x3b, 0xe4,
+	0xf7, 0xf4, 0x66, 0x55, 0xc3, 0x3f, 0x03, 0x3c, 0x24, 0x2c, 0xda, 0x7c, 0xea, 0xfc, 0x53, 0xe2,
+	0xb3, 0xce, 0xbf, 0x43, 0x42, 0x90, 0x61, 0xe5, 0x08, 0x0b, 0x39, 0xe2, 0xa9, 0x81, 0x3e, 0x44,
+	0x71, 0x07, 0xf0, 0xaa, 0x9c, 0x9a, 0x61, 0x61, 0x2c, 0xc9, 0x84, 0x4b, 0x30, 0x27, 0x22, 0x1e,
+	0x60, 0xfc, 0x4c, 0x7a, 0x93, 0xef, 0x6d, 0xab, 0xdc, 0xb3, 0x32, 0x56, 0xe7, 0x90, 0x2f, 0x51,
+	0xd6, 0xad, 0x31, 0x65, 0x23, 0x72, 0x47, 0xf0, 0x35, 0xe4, 0xeb, 0x3f, 0xfd, 0x0f, 0x00, 0x66,
+	0x84, 0x14, 0xda, 0x0d, 0x02, 0x00, 0x00,
 }
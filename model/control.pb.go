@@ -0,0 +1,390 @@
+// Code generated by protoc-gen-go.
+// source: control.proto
+// DO NOT EDIT!
+
+package model
+
+import proto "github.com/golang/protobuf/proto"
+import fmt "fmt"
+import math "math"
+
+import (
+	context "golang.org/x/net/context"
+	grpc "google.golang.org/grpc"
+)
+
+// Reference imports to suppress errors if they are not otherwise used.
+var _ = proto.Marshal
+var _ = fmt.Errorf
+var _ = math.Inf
+
+type SubmitRequest struct {
+	Task *ScraperTask `protobuf:"bytes,1,opt,name=Task,json=task" json:"Task,omitempty"`
+}
+
+func (m *SubmitRequest) Reset()                    { *m = SubmitRequest{} }
+func (m *SubmitRequest) String() string            { return proto.CompactTextString(m) }
+func (*SubmitRequest) ProtoMessage()               {}
+func (*SubmitRequest) Descriptor() ([]byte, []int) { return fileDescriptor1, []int{0} }
+
+func (m *SubmitRequest) GetTask() *ScraperTask {
+	if m != nil {
+		return m.Task
+	}
+	return nil
+}
+
+type ListRequest struct {
+}
+
+func (m *ListRequest) Reset()                    { *m = ListRequest{} }
+func (m *ListRequest) String() string            { return proto.CompactTextString(m) }
+func (*ListRequest) ProtoMessage()               {}
+func (*ListRequest) Descriptor() ([]byte, []int) { return fileDescriptor1, []int{1} }
+
+type TaskRequest struct {
+	Task int32 `protobuf:"varint,1,opt,name=Task,json=task" json:"Task,omitempty"`
+}
+
+func (m *TaskRequest) Reset()                    { *m = TaskRequest{} }
+func (m *TaskRequest) String() string            { return proto.CompactTextString(m) }
+func (*TaskRequest) ProtoMessage()               {}
+func (*TaskRequest) Descriptor() ([]byte, []int) { return fileDescriptor1, []int{2} }
+
+type TaskStatus struct {
+	Task  int32     `protobuf:"varint,1,opt,name=Task,json=task" json:"Task,omitempty"`
+	Type  TaskType  `protobuf:"varint,2,opt,name=Type,json=type,enum=model.TaskType" json:"Type,omitempty"`
+	State TaskState `protobuf:"varint,3,opt,name=State,json=state,enum=model.TaskState" json:"State,omitempty"`
+	Error string    `protobuf:"bytes,4,opt,name=Error,json=error" json:"Error,omitempty"`
+	// Where the task is, e.g. "Id 150 of 100-200".
+	Progress string `protobuf:"bytes,5,opt,name=Progress,json=progress" json:"Progress,omitempty"`
+}
+
+func (m *TaskStatus) Reset()                    { *m = TaskStatus{} }
+func (m *TaskStatus) String() string            { return proto.CompactTextString(m) }
+func (*TaskStatus) ProtoMessage()               {}
+func (*TaskStatus) Descriptor() ([]byte, []int) { return fileDescriptor1, []int{3} }
+
+type TaskList struct {
+	Tasks []*TaskStatus `protobuf:"bytes,1,rep,name=Tasks,json=tasks" json:"Tasks,omitempty"`
+}
+
+func (m *TaskList) Reset()                    { *m = TaskList{} }
+func (m *TaskList) String() string            { return proto.CompactTextString(m) }
+func (*TaskList) ProtoMessage()               {}
+func (*TaskList) Descriptor() ([]byte, []int) { return fileDescriptor1, []int{4} }
+
+func (m *TaskList) GetTasks() []*TaskStatus {
+	if m != nil {
+		return m.Tasks
+	}
+	return nil
+}
+
+type TaskStats struct {
+	Task int32 `protobuf:"varint,1,opt,name=Task,json=task" json:"Task,omitempty"`
+	// Pages and images fetched, those saved, and those that failed.
+	Crawled int64 `protobuf:"varint,2,opt,name=Crawled,json=crawled" json:"Crawled,omitempty"`
+	Saved   int64 `protobuf:"varint,3,opt,name=Saved,json=saved" json:"Saved,omitempty"`
+	Failed  int64 `protobuf:"varint,4,opt,name=Failed,json=failed" json:"Failed,omitempty"`
+	// When the task last started, and last crawled, in Unix seconds.
+	StartedTs int64 `protobuf:"varint,5,opt,name=StartedTs,json=startedTs" json:"StartedTs,omitempty"`
+	UpdatedTs int64 `protobuf:"varint,6,opt,name=UpdatedTs,json=updatedTs" json:"UpdatedTs,omitempty"`
+}
+
+func (m *TaskStats) Reset()                    { *m = TaskStats{} }
+func (m *TaskStats) String() string            { return proto.CompactTextString(m) }
+func (*TaskStats) ProtoMessage()               {}
+func (*TaskStats) Descriptor() ([]byte, []int) { return fileDescriptor1, []int{5} }
+
+func init() {
+	proto.RegisterType((*SubmitRequest)(nil), "model.SubmitRequest")
+	proto.RegisterType((*ListRequest)(nil), "model.ListRequest")
+	proto.RegisterType((*TaskRequest)(nil), "model.TaskRequest")
+	proto.RegisterType((*TaskStatus)(nil), "model.TaskStatus")
+	proto.RegisterType((*TaskList)(nil), "model.TaskList")
+	proto.RegisterType((*TaskStats)(nil), "model.TaskStats")
+}
+
+// Reference imports to suppress errors if they are not otherwise used.
+var _ context.Context
+var _ grpc.ClientConn
+
+// This is a compile-time assertion to ensure that this generated file
+// is compatible with the grpc package it is being compiled against.
+const _ = grpc.SupportPackageIsVersion3
+
+// Client API for Control service
+
+// Control manages the tasks of a running scraper. Tasks are numbered by
+// their position in the task file.
+type ControlClient interface {
+	// Submit adds a task to the task file and runs it.
+	Submit(ctx context.Context, in *SubmitRequest, opts ...grpc.CallOption) (*TaskStatus, error)
+	// List returns every task with its progress.
+	List(ctx context.Context, in *ListRequest, opts ...grpc.CallOption) (*TaskList, error)
+	// Pause stops a task until it is resumed.
+	Pause(ctx context.Context, in *TaskRequest, opts ...grpc.CallOption) (*TaskStatus, error)
+	// Resume runs a paused or failed task again; canceled tasks stay canceled.
+	Resume(ctx context.Context, in *TaskRequest, opts ...grpc.CallOption) (*TaskStatus, error)
+	// Cancel stops a task for good as CANCELED.
+	Cancel(ctx context.Context, in *TaskRequest, opts ...grpc.CallOption) (*TaskStatus, error)
+	// Stats returns what a task crawled since the scraper started.
+	Stats(ctx context.Context, in *TaskRequest, opts ...grpc.CallOption) (*TaskStats, error)
+}
+
+type controlClient struct {
+	cc *grpc.ClientConn
+}
+
+func NewControlClient(cc *grpc.ClientConn) ControlClient {
+	return &controlClient{cc}
+}
+
+func (c *controlClient) Submit(ctx context.Context, in *SubmitRequest, opts ...grpc.CallOption) (*TaskStatus, error) {
+	out := new(TaskStatus)
+	err := grpc.Invoke(ctx, "/model.Control/Submit", in, out, c.cc, opts...)
+	if err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
+func (c *controlClient) List(ctx context.Context, in *ListRequest, opts ...grpc.CallOption) (*TaskList, error) {
+	out := new(TaskList)
+	err := grpc.Invoke(ctx, "/model.Control/List", in, out, c.cc, opts...)
+	if err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
+func (c *controlClient) Pause(ctx context.Context, in *TaskRequest, opts ...grpc.CallOption) (*TaskStatus, error) {
+	out := new(TaskStatus)
+	err := grpc.Invoke(ctx, "/model.Control/Pause", in, out, c.cc, opts...)
+	if err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
+func (c *controlClient) Resume(ctx context.Context, in *TaskRequest, opts ...grpc.CallOption) (*TaskStatus, error) {
+	out := new(TaskStatus)
+	err := grpc.Invoke(ctx, "/model.Control/Resume", in, out, c.cc, opts...)
+	if err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
+func (c *controlClient) Cancel(ctx context.Context, in *TaskRequest, opts ...grpc.CallOption) (*TaskStatus, error) {
+	out := new(TaskStatus)
+	err := grpc.Invoke(ctx, "/model.Control/Cancel", in, out, c.cc, opts...)
+	if err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
+func (c *controlClient) Stats(ctx context.Context, in *TaskRequest, opts ...grpc.CallOption) (*TaskStats, error) {
+	out := new(TaskStats)
+	err := grpc.Invoke(ctx, "/model.Control/Stats", in, out, c.cc, opts...)
+	if err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
+// Server API for Control service
+
+// Control manages the tasks of a running scraper. Tasks are numbered by
+// their position in the task file.
+type ControlServer interface {
+	// Submit adds a task to the task file and runs it.
+	Submit(context.Context, *SubmitRequest) (*TaskStatus, error)
+	// List returns every task with its progress.
+	List(context.Context, *ListRequest) (*TaskList, error)
+	// Pause stops a task until it is resumed.
+	Pause(context.Context, *TaskRequest) (*TaskStatus, error)
+	// Resume runs a paused or failed task again; canceled tasks stay canceled.
+	Resume(context.Context, *TaskRequest) (*TaskStatus, error)
+	// Cancel stops a task for good as CANCELED.
+	Cancel(context.Context, *TaskRequest) (*TaskStatus, error)
+	// Stats returns what a task crawled since the scraper started.
+	Stats(context.Context, *TaskRequest) (*TaskStats, error)
+}
+
+func RegisterControlServer(s *grpc.Server, srv ControlServer) {
+	s.RegisterService(&_Control_serviceDesc, srv)
+}
+
+func _Control_Submit_Handler(srv interface{}, ctx context.Context, dec func(interface{}) error, interceptor grpc.UnaryServerInterceptor) (interface{}, error) {
+	in := new(SubmitRequest)
+	if err := dec(in); err != nil {
+		return nil, err
+	}
+	if interceptor == nil {
+		return srv.(ControlServer).Submit(ctx, in)
+	}
+	info := &grpc.UnaryServerInfo{
+		Server:     srv,
+		FullMethod: "/model.Control/Submit",
+	}
+	handler := func(ctx context.Context, req interface{}) (interface{}, error) {
+		return srv.(ControlServer).Submit(ctx, req.(*SubmitRequest))
+	}
+	return interceptor(ctx, in, info, handler)
+}
+
+func _Control_List_Handler(srv interface{}, ctx context.Context, dec func(interface{}) error, interceptor grpc.UnaryServerInterceptor) (interface{}, error) {
+	in := new(ListRequest)
+	if err := dec(in); err != nil {
+		return nil, err
+	}
+	if interceptor == nil {
+		return srv.(ControlServer).List(ctx, in)
+	}
+	info := &grpc.UnaryServerInfo{
+		Server:     srv,
+		FullMethod: "/model.Control/List",
+	}
+	handler := func(ctx context.Context, req interface{}) (interface{}, error) {
+		return srv.(ControlServer).List(ctx, req.(*ListRequest))
+	}
+	return interceptor(ctx, in, info, handler)
+}
+
+func _Control_Pause_Handler(srv interface{}, ctx context.Context, dec func(interface{}) error, interceptor grpc.UnaryServerInterceptor) (interface{}, error) {
+	in := new(TaskRequest)
+	if err := dec(in); err != nil {
+		return nil, err
+	}
+	if interceptor == nil {
+		return srv.(ControlServer).Pause(ctx, in)
+	}
+	info := &grpc.UnaryServerInfo{
+		Server:     srv,
+		FullMethod: "/model.Control/Pause",
+	}
+	handler := func(ctx context.Context, req interface{}) (interface{}, error) {
+		return srv.(ControlServer).Pause(ctx, req.(*TaskRequest))
+	}
+	return interceptor(ctx, in, info, handler)
+}
+
+func _Control_Resume_Handler(srv interface{}, ctx context.Context, dec func(interface{}) error, interceptor grpc.UnaryServerInterceptor) (interface{}, error) {
+	in := new(TaskRequest)
+	if err := dec(in); err != nil {
+		return nil, err
+	}
+	if interceptor == nil {
+		return srv.(ControlServer).Resume(ctx, in)
+	}
+	info := &grpc.UnaryServerInfo{
+		Server:     srv,
+		FullMethod: "/model.Control/Resume",
+	}
+	handler := func(ctx context.Context, req interface{}) (interface{}, error) {
+		return srv.(ControlServer).Resume(ctx, req.(*TaskRequest))
+	}
+	return interceptor(ctx, in, info, handler)
+}
+
+func _Control_Cancel_Handler(srv interface{}, ctx context.Context, dec func(interface{}) error, interceptor grpc.UnaryServerInterceptor) (interface{}, error) {
+	in := new(TaskRequest)
+	if err := dec(in); err != nil {
+		return nil, err
+	}
+	if interceptor == nil {
+		return srv.(ControlServer).Cancel(ctx, in)
+	}
+	info := &grpc.UnaryServerInfo{
+		Server:     srv,
+		FullMethod: "/model.Control/Cancel",
+	}
+	handler := func(ctx context.Context, req interface{}) (interface{}, error) {
+		return srv.(ControlServer).Cancel(ctx, req.(*TaskRequest))
+	}
+	return interceptor(ctx, in, info, handler)
+}
+
+func _Control_Stats_Handler(srv interface{}, ctx context.Context, dec func(interface{}) error, interceptor grpc.UnaryServerInterceptor) (interface{}, error) {
+	in := new(TaskRequest)
+	if err := dec(in); err != nil {
+		return nil, err
+	}
+	if interceptor == nil {
+		return srv.(ControlServer).Stats(ctx, in)
+	}
+	info := &grpc.UnaryServerInfo{
+		Server:     srv,
+		FullMethod: "/model.Control/Stats",
+	}
+	handler := func(ctx context.Context, req interface{}) (interface{}, error) {
+		return srv.(ControlServer).Stats(ctx, req.(*TaskRequest))
+	}
+	return interceptor(ctx, in, info, handler)
+}
+
+var _Control_serviceDesc = grpc.ServiceDesc{
+	ServiceName: "model.Control",
+	HandlerType: (*ControlServer)(nil),
+	Methods: []grpc.MethodDesc{
+		{
+			MethodName: "Submit",
+			Handler:    _Control_Submit_Handler,
+		},
+		{
+			MethodName: "List",
+			Handler:    _Control_List_Handler,
+		},
+		{
+			MethodName: "Pause",
+			Handler:    _Control_Pause_Handler,
+		},
+		{
+			MethodName: "Resume",
+			Handler:    _Control_Resume_Handler,
+		},
+		{
+			MethodName: "Cancel",
+			Handler:    _Control_Cancel_Handler,
+		},
+		{
+			MethodName: "Stats",
+			Handler:    _Control_Stats_Handler,
+		},
+	},
+	Streams:  []grpc.StreamDesc{},
+	Metadata: fileDescriptor1,
+}
+
+var fileDescriptor1 = []byte{
+	// 407 bytes of a gzipped FileDescriptorProto
+	0x1f, 0x8b, 0x08, 0x00, 0x00, 0x09, 0x6e, 0x88, 0x02, 0xff, 0x94, 0x53, 0xcd, 0x8e, 0x94, 0x40,
+	0x10, 0x0e, 0x0b, 0xcd, 0xcc, 0xd4, 0x64, 0xfc, 0xa9, 0x6c, 0x0c, 0x99, 0x78, 0x40, 0x4c, 0x56,
+	0x12, 0x23, 0x46, 0xf6, 0xe0, 0x03, 0x4c, 0xf4, 0xe4, 0x61, 0xd3, 0x8c, 0x0f, 0xd0, 0x0b, 0xad,
+	0x99, 0x2c, 0xb3, 0x60, 0x57, 0xa3, 0xd9, 0xa7, 0xf1, 0xe0, 0xcd, 0xa7, 0x34, 0xd5, 0x0d, 0x09,
+	0x59, 0x27, 0xc6, 0x3d, 0x41, 0x7d, 0x3f, 0xd5, 0x5d, 0xd4, 0x07, 0x6c, 0xea, 0xee, 0xd6, 0x9a,
+	0xae, 0x2d, 0x7a, 0xd3, 0xd9, 0x0e, 0xc5, 0xb1, 0x6b, 0x74, 0xbb, 0x05, 0xab, 0xe8, 0xc6, 0x43,
+	0xd9, 0x7b, 0xd8, 0x54, 0xc3, 0xf5, 0xf1, 0x60, 0xa5, 0xfe, 0x36, 0x68, 0xb2, 0x78, 0x01, 0xd1,
+	0x5e, 0xd1, 0x4d, 0x12, 0xa4, 0x41, 0xbe, 0x2e, 0xb1, 0x70, 0x96, 0xa2, 0xaa, 0x8d, 0xea, 0xb5,
+	0x61, 0x46, 0x46, 0x6c, 0xcf, 0x36, 0xb0, 0xfe, 0x74, 0xa0, 0xc9, 0x96, 0xbd, 0x80, 0xb5, 0x23,
+	0xc7, 0x2e, 0x38, 0xeb, 0x22, 0x46, 0xc7, 0xcf, 0x00, 0x80, 0xc1, 0xca, 0x2a, 0x3b, 0xd0, 0x29,
+	0x09, 0xbe, 0x84, 0x68, 0x7f, 0xd7, 0xeb, 0xe4, 0x2c, 0x0d, 0xf2, 0x47, 0xe5, 0xe3, 0xf1, 0x70,
+	0x96, 0x31, 0x2c, 0x23, 0x7b, 0xd7, 0x6b, 0xbc, 0x00, 0xc1, 0x2d, 0x74, 0x12, 0x3a, 0xd5, 0x93,
+	0x99, 0xca, 0xe1, 0x52, 0x10, 0x3f, 0xf0, 0x1c, 0xc4, 0x07, 0x63, 0x3a, 0x93, 0x44, 0x69, 0x90,
+	0xaf, 0xa4, 0xd0, 0x5c, 0xe0, 0x16, 0x96, 0x57, 0xa6, 0xfb, 0x6a, 0x34, 0x51, 0x22, 0x1c, 0xb1,
+	0xec, 0xc7, 0x3a, 0xbb, 0x84, 0x25, 0x77, 0xe1, 0xb9, 0xf0, 0x15, 0x08, 0x7e, 0xa7, 0x24, 0x48,
+	0xc3, 0x7c, 0x5d, 0x3e, 0xbd, 0x77, 0xca, 0x40, 0x52, 0xf0, 0x95, 0x29, 0xfb, 0x15, 0xc0, 0x6a,
+	0x42, 0x4f, 0x4f, 0x95, 0xc0, 0x62, 0x67, 0xd4, 0x8f, 0x56, 0x37, 0x6e, 0xb0, 0x50, 0x2e, 0x6a,
+	0x5f, 0xf2, 0x15, 0x2b, 0xf5, 0x5d, 0x37, 0x6e, 0x94, 0x50, 0x0a, 0xe2, 0x02, 0x9f, 0x41, 0xfc,
+	0x51, 0x1d, 0x58, 0x1e, 0x39, 0x38, 0xfe, 0xe2, 0x2a, 0x7c, 0x0e, 0xab, 0xca, 0x2a, 0x63, 0x75,
+	0xb3, 0xf7, 0x77, 0x0f, 0xe5, 0x8a, 0x26, 0x80, 0xd9, 0xcf, 0x7d, 0xa3, 0x3c, 0x1b, 0x7b, 0x76,
+	0x98, 0x80, 0xf2, 0xf7, 0x19, 0x2c, 0x76, 0x3e, 0x0c, 0xf8, 0x0e, 0x62, 0xbf, 0x73, 0x3c, 0x9f,
+	0xd6, 0x3b, 0x8f, 0xc0, 0xf6, 0xef, 0x59, 0xf1, 0x35, 0x44, 0xee, 0xab, 0x4c, 0x79, 0x98, 0xad,
+	0x7e, 0x3b, 0x5f, 0x93, 0x13, 0x15, 0x20, 0xae, 0xd4, 0x40, 0x1a, 0x71, 0xc6, 0xfc, 0xa3, 0xf9,
+	0x5b, 0x88, 0xa5, 0xa6, 0xe1, 0xf8, 0x10, 0xc3, 0x4e, 0xdd, 0xd6, 0xba, 0xfd, 0x5f, 0xc3, 0x1b,
+	0x1f, 0x19, 0x3a, 0xa9, 0xbf, 0x1f, 0x20, 0xba, 0x8e, 0xdd, 0xbf, 0x71, 0xf9, 0x67, 0x00, 0x32,
+	0xb3, 0x41, 0x30, 0x3f, 0x03, 0x00, 0x00,
+}
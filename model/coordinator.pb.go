@@ -0,0 +1,272 @@
+// Code generated by protoc-gen-go.
+// source: coordinator.proto
+// DO NOT EDIT!
+
+package model
+
+import proto "github.com/golang/protobuf/proto"
+import fmt "fmt"
+import math "math"
+
+import (
+	context "golang.org/x/net/context"
+	grpc "google.golang.org/grpc"
+)
+
+// Reference imports to suppress errors if they are not otherwise used.
+var _ = proto.Marshal
+var _ = fmt.Errorf
+var _ = math.Inf
+
+type LeaseRequest struct {
+	// Name of the worker. Only it can keep and complete the lease.
+	Worker string `protobuf:"bytes,1,opt,name=Worker,json=worker" json:"Worker,omitempty"`
+}
+
+func (m *LeaseRequest) Reset()                    { *m = LeaseRequest{} }
+func (m *LeaseRequest) String() string            { return proto.CompactTextString(m) }
+func (*LeaseRequest) ProtoMessage()               {}
+func (*LeaseRequest) Descriptor() ([]byte, []int) { return fileDescriptor2, []int{0} }
+
+// IdLease is a range of Ids leased to a worker. Id is 0 when nothing can be
+// leased right now; Finished tells that nothing will be anymore.
+type IdLease struct {
+	Id   int64    `protobuf:"varint,1,opt,name=Id,json=id" json:"Id,omitempty"`
+	Type TaskType `protobuf:"varint,2,opt,name=Type,json=type,enum=model.TaskType" json:"Type,omitempty"`
+	// Ids from BeginId to EndId-1 are to be crawled.
+	BeginId  int64 `protobuf:"varint,3,opt,name=BeginId,json=beginId" json:"BeginId,omitempty"`
+	EndId    int64 `protobuf:"varint,4,opt,name=EndId,json=endId" json:"EndId,omitempty"`
+	LeaseSec int32 `protobuf:"varint,5,opt,name=LeaseSec,json=leaseSec" json:"LeaseSec,omitempty"`
+	Finished bool  `protobuf:"varint,6,opt,name=Finished,json=finished" json:"Finished,omitempty"`
+}
+
+func (m *IdLease) Reset()                    { *m = IdLease{} }
+func (m *IdLease) String() string            { return proto.CompactTextString(m) }
+func (*IdLease) ProtoMessage()               {}
+func (*IdLease) Descriptor() ([]byte, []int) { return fileDescriptor2, []int{1} }
+
+type HeartbeatRequest struct {
+	Lease int64 `protobuf:"varint,1,opt,name=Lease,json=lease" json:"Lease,omitempty"`
+	// Every Id of the lease below Next was crawled.
+	Next int64 `protobuf:"varint,2,opt,name=Next,json=next" json:"Next,omitempty"`
+	// Worker holding the lease.
+	Worker string `protobuf:"bytes,3,opt,name=Worker,json=worker" json:"Worker,omitempty"`
+}
+
+func (m *HeartbeatRequest) Reset()                    { *m = HeartbeatRequest{} }
+func (m *HeartbeatRequest) String() string            { return proto.CompactTextString(m) }
+func (*HeartbeatRequest) ProtoMessage()               {}
+func (*HeartbeatRequest) Descriptor() ([]byte, []int) { return fileDescriptor2, []int{2} }
+
+type HeartbeatReply struct {
+}
+
+func (m *HeartbeatReply) Reset()                    { *m = HeartbeatReply{} }
+func (m *HeartbeatReply) String() string            { return proto.CompactTextString(m) }
+func (*HeartbeatReply) ProtoMessage()               {}
+func (*HeartbeatReply) Descriptor() ([]byte, []int) { return fileDescriptor2, []int{3} }
+
+type CompleteRequest struct {
+	Lease int64 `protobuf:"varint,1,opt,name=Lease,json=lease" json:"Lease,omitempty"`
+	// Worker holding the lease.
+	Worker string `protobuf:"bytes,2,opt,name=Worker,json=worker" json:"Worker,omitempty"`
+}
+
+func (m *CompleteRequest) Reset()                    { *m = CompleteRequest{} }
+func (m *CompleteRequest) String() string            { return proto.CompactTextString(m) }
+func (*CompleteRequest) ProtoMessage()               {}
+func (*CompleteRequest) Descriptor() ([]byte, []int) { return fileDescriptor2, []int{4} }
+
+type CompleteReply struct {
+}
+
+func (m *CompleteReply) Reset()                    { *m = CompleteReply{} }
+func (m *CompleteReply) String() string            { return proto.CompactTextString(m) }
+func (*CompleteReply) ProtoMessage()               {}
+func (*CompleteReply) Descriptor() ([]byte, []int) { return fileDescriptor2, []int{5} }
+
+func init() {
+	proto.RegisterType((*LeaseRequest)(nil), "model.LeaseRequest")
+	proto.RegisterType((*IdLease)(nil), "model.IdLease")
+	proto.RegisterType((*HeartbeatRequest)(nil), "model.HeartbeatRequest")
+	proto.RegisterType((*HeartbeatReply)(nil), "model.HeartbeatReply")
+	proto.RegisterType((*CompleteRequest)(nil), "model.CompleteRequest")
+	proto.RegisterType((*CompleteReply)(nil), "model.CompleteReply")
+}
+
+// Reference imports to suppress errors if they are not otherwise used.
+var _ context.Context
+var _ grpc.ClientConn
+
+// This is a compile-time assertion to ensure that this generated file
+// is compatible with the grpc package it is being compiled against.
+const _ = grpc.SupportPackageIsVersion3
+
+// Client API for Coordinator service
+
+// Coordinator leases the Id ranges of the IdProfileTasks of its task file
+// to worker scrapers.
+type CoordinatorClient interface {
+	// Lease hands out the next range to crawl.
+	Lease(ctx context.Context, in *LeaseRequest, opts ...grpc.CallOption) (*IdLease, error)
+	// Heartbeat keeps a lease and reports its progress. A lease without
+	// heartbeat for LeaseSec expires and its range goes to another worker.
+	Heartbeat(ctx context.Context, in *HeartbeatRequest, opts ...grpc.CallOption) (*HeartbeatReply, error)
+	// Complete reports that every Id of a lease was crawled.
+	Complete(ctx context.Context, in *CompleteRequest, opts ...grpc.CallOption) (*CompleteReply, error)
+}
+
+type coordinatorClient struct {
+	cc *grpc.ClientConn
+}
+
+func NewCoordinatorClient(cc *grpc.ClientConn) CoordinatorClient {
+	return &coordinatorClient{cc}
+}
+
+func (c *coordinatorClient) Lease(ctx context.Context, in *LeaseRequest, opts ...grpc.CallOption) (*IdLease, error) {
+	out := new(IdLease)
+	err := grpc.Invoke(ctx, "/model.Coordinator/Lease", in, out, c.cc, opts...)
+	if err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
+func (c *coordinatorClient) Heartbeat(ctx context.Context, in *HeartbeatRequest, opts ...grpc.CallOption) (*HeartbeatReply, error) {
+	out := new(HeartbeatReply)
+	err := grpc.Invoke(ctx, "/model.Coordinator/Heartbeat", in, out, c.cc, opts...)
+	if err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
+func (c *coordinatorClient) Complete(ctx context.Context, in *CompleteRequest, opts ...grpc.CallOption) (*CompleteReply, error) {
+	out := new(CompleteReply)
+	err := grpc.Invoke(ctx, "/model.Coordinator/Complete", in, out, c.cc, opts...)
+	if err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
+// Server API for Coordinator service
+
+// Coordinator leases the Id ranges of the IdProfileTasks of its task file
+// to worker scrapers.
+type CoordinatorServer interface {
+	// Lease hands out the next range to crawl.
+	Lease(context.Context, *LeaseRequest) (*IdLease, error)
+	// Heartbeat keeps a lease and reports its progress. A lease without
+	// heartbeat for LeaseSec expires and its range goes to another worker.
+	Heartbeat(context.Context, *HeartbeatRequest) (*HeartbeatReply, error)
+	// Complete reports that every Id of a lease was crawled.
+	Complete(context.Context, *CompleteRequest) (*CompleteReply, error)
+}
+
+func RegisterCoordinatorServer(s *grpc.Server, srv CoordinatorServer) {
+	s.RegisterService(&_Coordinator_serviceDesc, srv)
+}
+
+func _Coordinator_Lease_Handler(srv interface{}, ctx context.Context, dec func(interface{}) error, interceptor grpc.UnaryServerInterceptor) (interface{}, error) {
+	in := new(LeaseRequest)
+	if err := dec(in); err != nil {
+		return nil, err
+	}
+	if interceptor == nil {
+		return srv.(CoordinatorServer).Lease(ctx, in)
+	}
+	info := &grpc.UnaryServerInfo{
+		Server:     srv,
+		FullMethod: "/model.Coordinator/Lease",
+	}
+	handler := func(ctx context.Context, req interface{}) (interface{}, error) {
+		return srv.(CoordinatorServer).Lease(ctx, req.(*LeaseRequest))
+	}
+	return interceptor(ctx, in, info, handler)
+}
+
+func _Coordinator_Heartbeat_Handler(srv interface{}, ctx context.Context, dec func(interface{}) error, interceptor grpc.UnaryServerInterceptor) (interface{}, error) {
+	in := new(HeartbeatRequest)
+	if err := dec(in); err != nil {
+		return nil, err
+	}
+	if interceptor == nil {
+		return srv.(CoordinatorServer).Heartbeat(ctx, in)
+	}
+	info := &grpc.UnaryServerInfo{
+		Server:     srv,
+		FullMethod: "/model.Coordinator/Heartbeat",
+	}
+	handler := func(ctx context.Context, req interface{}) (interface{}, error) {
+		return srv.(CoordinatorServer).Heartbeat(ctx, req.(*HeartbeatRequest))
+	}
+	return interceptor(ctx, in, info, handler)
+}
+
+func _Coordinator_Complete_Handler(srv interface{}, ctx context.Context, dec func(interface{}) error, interceptor grpc.UnaryServerInterceptor) (interface{}, error) {
+	in := new(CompleteRequest)
+	if err := dec(in); err != nil {
+		return nil, err
+	}
+	if interceptor == nil {
+		return srv.(CoordinatorServer).Complete(ctx, in)
+	}
+	info := &grpc.UnaryServerInfo{
+		Server:     srv,
+		FullMethod: "/model.Coordinator/Complete",
+	}
+	handler := func(ctx context.Context, req interface{}) (interface{}, error) {
+		return srv.(CoordinatorServer).Complete(ctx, req.(*CompleteRequest))
+	}
+	return interceptor(ctx, in, info, handler)
+}
+
+var _Coordinator_serviceDesc = grpc.ServiceDesc{
+	ServiceName: "model.Coordinator",
+	HandlerType: (*CoordinatorServer)(nil),
+	Methods: []grpc.MethodDesc{
+		{
+			MethodName: "Lease",
+			Handler:    _Coordinator_Lease_Handler,
+		},
+		{
+			MethodName: "Heartbeat",
+			Handler:    _Coordinator_Heartbeat_Handler,
+		},
+		{
+			MethodName: "Complete",
+			Handler:    _Coordinator_Complete_Handler,
+		},
+	},
+	Streams:  []grpc.StreamDesc{},
+	Metadata: fileDescriptor2,
+}
+
+var fileDescriptor2 = []byte{
+	// 355 bytes of a gzipped FileDescriptorProto
+	0x1f, 0x8b, 0x08, 0x00, 0x00, 0x09, 0x6e, 0x88, 0x02, 0xff, 0x7c, 0x52, 0x4d, 0x4b, 0xeb, 0x40,
+	0x14, 0x25, 0x9f, 0x4d, 0xef, 0x7b, 0x2f, 0xed, 0x9b, 0xd7, 0x57, 0x43, 0x56, 0x21, 0x82, 0x64,
+	0x21, 0x5d, 0xd4, 0x8d, 0xe0, 0x42, 0xb0, 0x28, 0x06, 0xc4, 0x45, 0x2c, 0xb8, 0x4e, 0x3b, 0x57,
+	0x0d, 0x9d, 0x66, 0xc6, 0x64, 0xc4, 0xe6, 0x0f, 0xf9, 0x03, 0xfc, 0x85, 0xd2, 0xe9, 0xd4, 0x7e,
+	0x81, 0xcb, 0x73, 0xce, 0xe4, 0xdc, 0x73, 0xee, 0x0d, 0xfc, 0x9d, 0x72, 0x5e, 0xd1, 0xa2, 0xcc,
+	0x25, 0xaf, 0x06, 0xa2, 0xe2, 0x92, 0x13, 0x67, 0xce, 0x29, 0xb2, 0x10, 0x64, 0x5e, 0xcf, 0x56,
+	0x54, 0x7c, 0x02, 0xbf, 0xef, 0x30, 0xaf, 0x31, 0xc3, 0xd7, 0x37, 0xac, 0x25, 0xe9, 0x83, 0xfb,
+	0xc8, 0xab, 0x19, 0x56, 0x81, 0x11, 0x19, 0x49, 0x3b, 0x73, 0xdf, 0x15, 0x8a, 0x3f, 0x0c, 0x68,
+	0xa5, 0x54, 0x3d, 0x25, 0x3e, 0x98, 0x29, 0x55, 0xba, 0x95, 0x99, 0x05, 0x25, 0xc7, 0x60, 0x8f,
+	0x1b, 0x81, 0x81, 0x19, 0x19, 0x89, 0x3f, 0xec, 0x0c, 0xd4, 0x94, 0xc1, 0x38, 0xaf, 0x67, 0x4b,
+	0x3a, 0xb3, 0x65, 0x23, 0x90, 0x04, 0xd0, 0xba, 0xc2, 0xe7, 0xa2, 0x4c, 0x69, 0x60, 0xa9, 0x2f,
+	0x5b, 0x93, 0x15, 0x24, 0x3d, 0x70, 0xae, 0x4b, 0x9a, 0xd2, 0xc0, 0x56, 0xbc, 0x83, 0x4b, 0x40,
+	0x42, 0xf0, 0xd4, 0xb4, 0x07, 0x9c, 0x06, 0x4e, 0x64, 0x24, 0x4e, 0xe6, 0x31, 0x8d, 0x97, 0xda,
+	0x4d, 0x51, 0x16, 0xf5, 0x0b, 0xd2, 0xc0, 0x8d, 0x8c, 0xc4, 0xcb, 0xbc, 0x27, 0x8d, 0xe3, 0x31,
+	0x74, 0x6f, 0x31, 0xaf, 0xe4, 0x04, 0x73, 0xb9, 0x2e, 0xd5, 0x03, 0x47, 0x79, 0xe9, 0xcc, 0x8e,
+	0x32, 0x22, 0x04, 0xec, 0x7b, 0x5c, 0x48, 0x15, 0xdb, 0xca, 0xec, 0x12, 0x17, 0xdb, 0xf5, 0xad,
+	0x9d, 0xfa, 0x5d, 0xf0, 0xb7, 0x5c, 0x05, 0x6b, 0xe2, 0x4b, 0xe8, 0x8c, 0xf8, 0x5c, 0x30, 0x94,
+	0xf8, 0xf3, 0x98, 0x8d, 0xa5, 0xb9, 0x63, 0xd9, 0x81, 0x3f, 0x1b, 0x03, 0xc1, 0x9a, 0xe1, 0xa7,
+	0x01, 0xbf, 0x46, 0x9b, 0x9b, 0x91, 0x53, 0x6d, 0x47, 0xfe, 0xe9, 0x8d, 0x6e, 0x1f, 0x2a, 0xf4,
+	0x35, 0xb9, 0x3e, 0xca, 0x05, 0xb4, 0xbf, 0x13, 0x92, 0x23, 0x2d, 0xee, 0x6f, 0x22, 0xfc, 0x7f,
+	0x28, 0x08, 0xd6, 0x90, 0x73, 0xf0, 0xd6, 0x59, 0x48, 0x5f, 0x3f, 0xd9, 0x6b, 0x17, 0xf6, 0x0e,
+	0x78, 0xc1, 0x9a, 0x89, 0xab, 0x7e, 0xa3, 0xb3, 0xaf, 0x01, 0x00, 0xc4, 0xde, 0xb8, 0x9b, 0x6e,
+	0x02, 0x00, 0x00,
+}
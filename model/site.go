@@ -0,0 +1,14 @@
+package model
+
+// SiteName is the folder the crawled files and the archives of each site
+// are kept in.
+var SiteName = map[TaskType]string{
+	TaskType_JIAYUAN: "Jiayuan",
+	TaskType_BAIHE:   "Baihe",
+}
+
+// ProfileTemplate is the URL of the profile of an Id on each site.
+var ProfileTemplate = map[TaskType]string{
+	TaskType_JIAYUAN: "http://www.jiayuan.com/%d",
+	TaskType_BAIHE:   "http://profile1.baihe.com/?oppId=%d",
+}
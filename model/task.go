@@ -2,58 +2,142 @@ package model
 
 import (
 	"encoding/json"
-	"errors"
+	"fmt"
+	"github.com/golang/protobuf/proto"
 	"log"
 )
 
+// Task is a typed task of a task file, one of the messages of the
+// ScraperTask oneof. Typed tasks only differ in their type, the rest of a
+// task is in its SocialImageTask.
 type Task interface {
+	proto.Message
 	GetType() TaskType
-	GetIdProfileTask() *IdProfileTask
+	GetSocialImageTask() *SocialImageTask
+}
+
+// Finished tells whether a task in state is done, one way or another.
+func (state TaskState) Finished() bool {
+	return state == TaskState_COMPLETED || state == TaskState_FAILED || state == TaskState_CANCELED
+}
+
+// Runnable tells whether a task in state is to be run.
+func (state TaskState) Runnable() bool {
+	return state == TaskState_PENDING || state == TaskState_RUNNING
 }
 
 func (t *SocialImageTask) GetType() TaskType {
 	return t.Type
 }
 
-func UnpackScraperTask(scraperTask *ScraperTask) (Task, error) {
-	switch scraperTask.Type {
+func (t *SocialImageTask) GetState() TaskState {
+	return t.State
+}
+
+func (t *SocialImageTask) GetError() string {
+	return t.Error
+}
+
+func (t *SocialImageTask) SetState(state TaskState, err error) {
+	t.State = state
+	t.Error = ""
+	if err != nil {
+		t.Error = err.Error()
+	}
+}
+
+func (t *SocialImageTask) GetSocialImageTask() *SocialImageTask {
+	return t
+}
+
+func (t *JiayuanTask) GetType() TaskType {
+	return TaskType_JIAYUAN
+}
+
+func (t *BaiheTask) GetType() TaskType {
+	return TaskType_BAIHE
+}
+
+func (t *RenrenTask) GetType() TaskType {
+	return TaskType_RENREN
+}
+
+// CheckType checks that t has a SocialImageTask of its own type, or of no
+// type.
+func CheckType(t Task) error {
+	s := t.GetSocialImageTask()
+	if s == nil {
+		return fmt.Errorf("No SocialImageTask.")
+	}
+	if s.Type != TaskType_UNKNOWN_TASK && s.Type != t.GetType() {
+		return fmt.Errorf("%v task has a SocialImageTask of type %v.", t.GetType(), s.Type)
+	}
+	return nil
+}
+
+// NewTask returns the typed task of the site of t.Type.
+func NewTask(t *SocialImageTask) (Task, error) {
+	switch t.Type {
 	case TaskType_JIAYUAN:
-		t := &SocialImageTask{}
-		err := json.Unmarshal([]byte(scraperTask.Data), t)
-		if err != nil {
-			log.Println(err)
-			return nil, err
-		}
-		return t, nil
+		return &JiayuanTask{SocialImageTask: t}, nil
 	case TaskType_BAIHE:
-		t := &SocialImageTask{}
-		err := json.Unmarshal([]byte(scraperTask.Data), t)
-		if err != nil {
-			log.Println(err)
-			return nil, err
-		}
-		return t, nil
+		return &BaiheTask{SocialImageTask: t}, nil
 	case TaskType_RENREN:
-		t := &SocialImageTask{}
-		err := json.Unmarshal([]byte(scraperTask.Data), t)
-		if err != nil {
-			log.Println(err)
-			return nil, err
-		}
-		return t, nil
+		return &RenrenTask{SocialImageTask: t}, nil
 	}
-	return nil, errors.New("Invalid task type to unpack.")
+	return nil, fmt.Errorf("Invalid task type %v.", t.Type)
+}
 
+// IsLegacy tells whether scraperTask keeps its task as JSON in Data.
+func (scraperTask *ScraperTask) IsLegacy() bool {
+	return scraperTask.Task == nil && len(scraperTask.Data) > 0
 }
 
-func PackScraperTask(t Task) (*ScraperTask, error) {
-	bytes, err := json.Marshal(t)
+func UnpackScraperTask(scraperTask *ScraperTask) (Task, error) {
+	var typed Task
+	switch t := scraperTask.Task.(type) {
+	case *ScraperTask_JiayuanTask:
+		typed = t.JiayuanTask
+	case *ScraperTask_BaiheTask:
+		typed = t.BaiheTask
+	case *ScraperTask_RenrenTask:
+		typed = t.RenrenTask
+	}
+	if typed != nil {
+		if err := CheckType(typed); err != nil {
+			return nil, err
+		}
+		return typed, nil
+	}
+	if !scraperTask.IsLegacy() {
+		return nil, fmt.Errorf("Empty task.")
+	}
+	t := &SocialImageTask{}
+	err := json.Unmarshal([]byte(scraperTask.Data), t)
 	if err != nil {
 		log.Println(err)
 		return nil, err
 	}
-	return &ScraperTask{
-		Type: t.GetType(),
-		Data: string(bytes),
-	}, nil
+	if t.Type == TaskType_UNKNOWN_TASK {
+		t.Type = scraperTask.Type
+	}
+	return NewTask(t)
+}
+
+func PackScraperTask(t Task) (*ScraperTask, error) {
+	switch t := t.(type) {
+	case *JiayuanTask:
+		return &ScraperTask{Task: &ScraperTask_JiayuanTask{t}}, nil
+	case *BaiheTask:
+		return &ScraperTask{Task: &ScraperTask_BaiheTask{t}}, nil
+	case *RenrenTask:
+		return &ScraperTask{Task: &ScraperTask_RenrenTask{t}}, nil
+	case *SocialImageTask:
+		typed, err := NewTask(t)
+		if err != nil {
+			return nil, err
+		}
+		return PackScraperTask(typed)
+	}
+	return nil, fmt.Errorf("Invalid task %T to pack.", t)
 }
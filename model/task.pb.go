@@ -38,18 +38,61 @@ var TaskType_value = map[string]int32{
 func (x TaskType) String() string {
 	return proto.EnumName(TaskType_name, int32(x))
 }
-func (TaskType) EnumDescriptor() ([]byte, []int) { return fileDescriptor1, []int{0} }
+func (TaskType) EnumDescriptor() ([]byte, []int) { return fileDescriptor3, []int{0} }
+
+// TaskState is where a task is in its lifecycle. Pending and running tasks
+// are run when the scraper starts; running ones were interrupted. Paused,
+// completed, failed and canceled tasks are skipped until set back to PENDING.
+type TaskState int32
+
+const (
+	TaskState_PENDING   TaskState = 0
+	TaskState_RUNNING   TaskState = 1
+	TaskState_PAUSED    TaskState = 2
+	TaskState_COMPLETED TaskState = 3
+	TaskState_FAILED    TaskState = 4
+	// Stopped for good through the Control API.
+	TaskState_CANCELED TaskState = 5
+)
+
+var TaskState_name = map[int32]string{
+	0: "PENDING",
+	1: "RUNNING",
+	2: "PAUSED",
+	3: "COMPLETED",
+	4: "FAILED",
+	5: "CANCELED",
+}
+var TaskState_value = map[string]int32{
+	"PENDING":   0,
+	"RUNNING":   1,
+	"PAUSED":    2,
+	"COMPLETED": 3,
+	"FAILED":    4,
+	"CANCELED":  5,
+}
+
+func (x TaskState) String() string {
+	return proto.EnumName(TaskState_name, int32(x))
+}
+func (TaskState) EnumDescriptor() ([]byte, []int) { return fileDescriptor3, []int{1} }
 
 type SocialImageTask struct {
 	Type          TaskType       `protobuf:"varint,1,opt,name=Type,json=type,enum=model.TaskType" json:"Type,omitempty"`
 	IdProfileTask *IdProfileTask `protobuf:"bytes,2,opt,name=IdProfileTask,json=idProfileTask" json:"IdProfileTask,omitempty"`
 	ImageTask     *ImageTask     `protobuf:"bytes,3,opt,name=ImageTask,json=imageTask" json:"ImageTask,omitempty"`
+	SitemapTask   *SitemapTask   `protobuf:"bytes,4,opt,name=SitemapTask,json=sitemapTask" json:"SitemapTask,omitempty"`
+	LinkTask      *LinkTask      `protobuf:"bytes,5,opt,name=LinkTask,json=linkTask" json:"LinkTask,omitempty"`
+	State         TaskState      `protobuf:"varint,6,opt,name=State,json=state,enum=model.TaskState" json:"State,omitempty"`
+	// Why the task failed.
+	Error  string      `protobuf:"bytes,7,opt,name=Error,json=error" json:"Error,omitempty"`
+	Limits *TaskLimits `protobuf:"bytes,8,opt,name=Limits,json=limits" json:"Limits,omitempty"`
 }
 
 func (m *SocialImageTask) Reset()                    { *m = SocialImageTask{} }
 func (m *SocialImageTask) String() string            { return proto.CompactTextString(m) }
 func (*SocialImageTask) ProtoMessage()               {}
-func (*SocialImageTask) Descriptor() ([]byte, []int) { return fileDescriptor1, []int{0} }
+func (*SocialImageTask) Descriptor() ([]byte, []int) { return fileDescriptor3, []int{0} }
 
 func (m *SocialImageTask) GetIdProfileTask() *IdProfileTask {
 	if m != nil {
@@ -65,24 +108,157 @@ func (m *SocialImageTask) GetImageTask() *ImageTask {
 	return nil
 }
 
+func (m *SocialImageTask) GetSitemapTask() *SitemapTask {
+	if m != nil {
+		return m.SitemapTask
+	}
+	return nil
+}
+
+func (m *SocialImageTask) GetLinkTask() *LinkTask {
+	if m != nil {
+		return m.LinkTask
+	}
+	return nil
+}
+
+func (m *SocialImageTask) GetLimits() *TaskLimits {
+	if m != nil {
+		return m.Limits
+	}
+	return nil
+}
+
+// TaskLimits sets how many pages or images of a task are fetched at once.
+type TaskLimits struct {
+	// Threads of the task's own, on top of ThreadNum.
+	Threads int32 `protobuf:"varint,1,opt,name=Threads,json=threads" json:"Threads,omitempty"`
+	// Without Threads the running tasks share ThreadNum in proportion to
+	// their Weight, 1 by default.
+	Weight int32 `protobuf:"varint,2,opt,name=Weight,json=weight" json:"Weight,omitempty"`
+}
+
+func (m *TaskLimits) Reset()                    { *m = TaskLimits{} }
+func (m *TaskLimits) String() string            { return proto.CompactTextString(m) }
+func (*TaskLimits) ProtoMessage()               {}
+func (*TaskLimits) Descriptor() ([]byte, []int) { return fileDescriptor3, []int{1} }
+
 type IdProfileTask struct {
 	BeginId    int64  `protobuf:"varint,1,opt,name=BeginId,json=beginId" json:"BeginId,omitempty"`
 	EndId      int64  `protobuf:"varint,2,opt,name=EndId,json=endId" json:"EndId,omitempty"`
 	UrlPattern string `protobuf:"bytes,3,opt,name=UrlPattern,json=urlPattern" json:"UrlPattern,omitempty"`
+	// Ranges a coordinator leased out and that are not completed yet, from
+	// the first Id not known to be crawled.
+	Leased []*IdRange `protobuf:"bytes,4,rep,name=Leased,json=leased" json:"Leased,omitempty"`
+	// First Id a coordinator has not leased yet, 0 before it leased any. A
+	// coordinator, like the scraper, starts from BeginId-1.
+	NextLease int64 `protobuf:"varint,5,opt,name=NextLease,json=nextLease" json:"NextLease,omitempty"`
 }
 
 func (m *IdProfileTask) Reset()                    { *m = IdProfileTask{} }
 func (m *IdProfileTask) String() string            { return proto.CompactTextString(m) }
 func (*IdProfileTask) ProtoMessage()               {}
-func (*IdProfileTask) Descriptor() ([]byte, []int) { return fileDescriptor1, []int{1} }
+func (*IdProfileTask) Descriptor() ([]byte, []int) { return fileDescriptor3, []int{2} }
 
+func (m *IdProfileTask) GetLeased() []*IdRange {
+	if m != nil {
+		return m.Leased
+	}
+	return nil
+}
+
+type IdRange struct {
+	BeginId int64 `protobuf:"varint,1,opt,name=BeginId,json=beginId" json:"BeginId,omitempty"`
+	EndId   int64 `protobuf:"varint,2,opt,name=EndId,json=endId" json:"EndId,omitempty"`
+}
+
+func (m *IdRange) Reset()                    { *m = IdRange{} }
+func (m *IdRange) String() string            { return proto.CompactTextString(m) }
+func (*IdRange) ProtoMessage()               {}
+func (*IdRange) Descriptor() ([]byte, []int) { return fileDescriptor3, []int{3} }
+
+// ImageTask downloads listed images instead of crawling profiles.
 type ImageTask struct {
+	Images []*ImageUrl `protobuf:"bytes,1,rep,name=Images,json=images" json:"Images,omitempty"`
+	// File of more images, one per line: the URL, then optionally the Id and
+	// the label, separated by tabs.
+	UrlFile string `protobuf:"bytes,2,opt,name=UrlFile,json=urlFile" json:"UrlFile,omitempty"`
+	// Images without an Id get FirstId plus their position.
+	FirstId int64 `protobuf:"varint,3,opt,name=FirstId,json=firstId" json:"FirstId,omitempty"`
+	// Position of the next image to download, counting Images then the
+	// lines of UrlFile.
+	Next int64 `protobuf:"varint,4,opt,name=Next,json=next" json:"Next,omitempty"`
+	// Folder of the images in DataFolder, the site folder by default.
+	Folder string `protobuf:"bytes,5,opt,name=Folder,json=folder" json:"Folder,omitempty"`
 }
 
 func (m *ImageTask) Reset()                    { *m = ImageTask{} }
 func (m *ImageTask) String() string            { return proto.CompactTextString(m) }
 func (*ImageTask) ProtoMessage()               {}
-func (*ImageTask) Descriptor() ([]byte, []int) { return fileDescriptor1, []int{2} }
+func (*ImageTask) Descriptor() ([]byte, []int) { return fileDescriptor3, []int{4} }
+
+func (m *ImageTask) GetImages() []*ImageUrl {
+	if m != nil {
+		return m.Images
+	}
+	return nil
+}
+
+type ImageUrl struct {
+	Url   string `protobuf:"bytes,1,opt,name=Url,json=url" json:"Url,omitempty"`
+	Id    int64  `protobuf:"varint,2,opt,name=Id,json=id" json:"Id,omitempty"`
+	Label string `protobuf:"bytes,3,opt,name=Label,json=label" json:"Label,omitempty"`
+}
+
+func (m *ImageUrl) Reset()                    { *m = ImageUrl{} }
+func (m *ImageUrl) String() string            { return proto.CompactTextString(m) }
+func (*ImageUrl) ProtoMessage()               {}
+func (*ImageUrl) Descriptor() ([]byte, []int) { return fileDescriptor3, []int{5} }
+
+// SitemapTask crawls the profiles listed in a sitemap or sitemap index.
+type SitemapTask struct {
+	// Sitemap or sitemap index, gzipped or not.
+	Url string `protobuf:"bytes,1,opt,name=Url,json=url" json:"Url,omitempty"`
+	// Only URLs matching this regular expression are crawled. The profile id
+	// is its first group, or else the last number of the URL.
+	UrlPattern string `protobuf:"bytes,2,opt,name=UrlPattern,json=urlPattern" json:"UrlPattern,omitempty"`
+	// Position to resume from: the sitemap in the index, 0 without index,
+	// and the URL in that sitemap.
+	Sitemap int64 `protobuf:"varint,3,opt,name=Sitemap,json=sitemap" json:"Sitemap,omitempty"`
+	Next    int64 `protobuf:"varint,4,opt,name=Next,json=next" json:"Next,omitempty"`
+}
+
+func (m *SitemapTask) Reset()                    { *m = SitemapTask{} }
+func (m *SitemapTask) String() string            { return proto.CompactTextString(m) }
+func (*SitemapTask) ProtoMessage()               {}
+func (*SitemapTask) Descriptor() ([]byte, []int) { return fileDescriptor3, []int{6} }
+
+// LinkTask follows links breadth first from Seeds and saves the pages and
+// their images. Pages are numbered by their position in the frontier.
+type LinkTask struct {
+	Seeds []string `protobuf:"bytes,1,rep,name=Seeds,json=seeds" json:"Seeds,omitempty"`
+	// Pages more than MaxDepth links away from a seed are not crawled.
+	MaxDepth int32 `protobuf:"varint,2,opt,name=MaxDepth,json=maxDepth" json:"MaxDepth,omitempty"`
+	// Hosts to crawl, the hosts of the seeds when empty. "*.a.com" is a.com
+	// and its subdomains.
+	Hosts []string `protobuf:"bytes,3,rep,name=Hosts,json=hosts" json:"Hosts,omitempty"`
+	// Regular expressions of the paths to crawl, all when empty, and of the
+	// paths not to.
+	AllowPaths []string `protobuf:"bytes,4,rep,name=AllowPaths,json=allowPaths" json:"AllowPaths,omitempty"`
+	DenyPaths  []string `protobuf:"bytes,5,rep,name=DenyPaths,json=denyPaths" json:"DenyPaths,omitempty"`
+	// Images whose URL matches ImagePattern are saved, or else the images
+	// the site's extractor finds.
+	ImagePattern string `protobuf:"bytes,6,opt,name=ImagePattern,json=imagePattern" json:"ImagePattern,omitempty"`
+	// Folder of the pages in DataFolder, <site>Links by default.
+	Folder string `protobuf:"bytes,7,opt,name=Folder,json=folder" json:"Folder,omitempty"`
+	// Position of the next page in the frontier.
+	Next int64 `protobuf:"varint,8,opt,name=Next,json=next" json:"Next,omitempty"`
+}
+
+func (m *LinkTask) Reset()                    { *m = LinkTask{} }
+func (m *LinkTask) String() string            { return proto.CompactTextString(m) }
+func (*LinkTask) ProtoMessage()               {}
+func (*LinkTask) Descriptor() ([]byte, []int) { return fileDescriptor3, []int{7} }
 
 type JiayuanTask struct {
 	SocialImageTask *SocialImageTask `protobuf:"bytes,1,opt,name=SocialImageTask,json=socialImageTask" json:"SocialImageTask,omitempty"`
@@ -91,7 +267,7 @@ type JiayuanTask struct {
 func (m *JiayuanTask) Reset()                    { *m = JiayuanTask{} }
 func (m *JiayuanTask) String() string            { return proto.CompactTextString(m) }
 func (*JiayuanTask) ProtoMessage()               {}
-func (*JiayuanTask) Descriptor() ([]byte, []int) { return fileDescriptor1, []int{3} }
+func (*JiayuanTask) Descriptor() ([]byte, []int) { return fileDescriptor3, []int{8} }
 
 func (m *JiayuanTask) GetSocialImageTask() *SocialImageTask {
 	if m != nil {
@@ -107,7 +283,7 @@ type BaiheTask struct {
 func (m *BaiheTask) Reset()                    { *m = BaiheTask{} }
 func (m *BaiheTask) String() string            { return proto.CompactTextString(m) }
 func (*BaiheTask) ProtoMessage()               {}
-func (*BaiheTask) Descriptor() ([]byte, []int) { return fileDescriptor1, []int{4} }
+func (*BaiheTask) Descriptor() ([]byte, []int) { return fileDescriptor3, []int{9} }
 
 func (m *BaiheTask) GetSocialImageTask() *SocialImageTask {
 	if m != nil {
@@ -123,7 +299,7 @@ type RenrenTask struct {
 func (m *RenrenTask) Reset()                    { *m = RenrenTask{} }
 func (m *RenrenTask) String() string            { return proto.CompactTextString(m) }
 func (*RenrenTask) ProtoMessage()               {}
-func (*RenrenTask) Descriptor() ([]byte, []int) { return fileDescriptor1, []int{5} }
+func (*RenrenTask) Descriptor() ([]byte, []int) { return fileDescriptor3, []int{10} }
 
 func (m *RenrenTask) GetSocialImageTask() *SocialImageTask {
 	if m != nil {
@@ -133,6 +309,13 @@ func (m *RenrenTask) GetSocialImageTask() *SocialImageTask {
 }
 
 type ScraperTask struct {
+	// Types that are valid to be assigned to Task:
+	//	*ScraperTask_JiayuanTask
+	//	*ScraperTask_BaiheTask
+	//	*ScraperTask_RenrenTask
+	Task isScraperTask_Task `protobuf_oneof:"Task"`
+	// Legacy tasks keep the task as JSON in Data. They are only read, to
+	// migrate old task files.
 	Type TaskType `protobuf:"varint,1,opt,name=Type,json=type,enum=model.TaskType" json:"Type,omitempty"`
 	Data string   `protobuf:"bytes,2,opt,name=Data,json=data" json:"Data,omitempty"`
 }
@@ -140,7 +323,146 @@ type ScraperTask struct {
 func (m *ScraperTask) Reset()                    { *m = ScraperTask{} }
 func (m *ScraperTask) String() string            { return proto.CompactTextString(m) }
 func (*ScraperTask) ProtoMessage()               {}
-func (*ScraperTask) Descriptor() ([]byte, []int) { return fileDescriptor1, []int{6} }
+func (*ScraperTask) Descriptor() ([]byte, []int) { return fileDescriptor3, []int{11} }
+
+type isScraperTask_Task interface {
+	isScraperTask_Task()
+}
+
+type ScraperTask_JiayuanTask struct {
+	JiayuanTask *JiayuanTask `protobuf:"bytes,3,opt,name=JiayuanTask,json=jiayuanTask,oneof"`
+}
+type ScraperTask_BaiheTask struct {
+	BaiheTask *BaiheTask `protobuf:"bytes,4,opt,name=BaiheTask,json=baiheTask,oneof"`
+}
+type ScraperTask_RenrenTask struct {
+	RenrenTask *RenrenTask `protobuf:"bytes,5,opt,name=RenrenTask,json=renrenTask,oneof"`
+}
+
+func (*ScraperTask_JiayuanTask) isScraperTask_Task() {}
+func (*ScraperTask_BaiheTask) isScraperTask_Task()   {}
+func (*ScraperTask_RenrenTask) isScraperTask_Task()  {}
+
+func (m *ScraperTask) GetTask() isScraperTask_Task {
+	if m != nil {
+		return m.Task
+	}
+	return nil
+}
+
+func (m *ScraperTask) GetJiayuanTask() *JiayuanTask {
+	if x, ok := m.GetTask().(*ScraperTask_JiayuanTask); ok {
+		return x.JiayuanTask
+	}
+	return nil
+}
+
+func (m *ScraperTask) GetBaiheTask() *BaiheTask {
+	if x, ok := m.GetTask().(*ScraperTask_BaiheTask); ok {
+		return x.BaiheTask
+	}
+	return nil
+}
+
+func (m *ScraperTask) GetRenrenTask() *RenrenTask {
+	if x, ok := m.GetTask().(*ScraperTask_RenrenTask); ok {
+		return x.RenrenTask
+	}
+	return nil
+}
+
+// XXX_OneofFuncs is for the internal use of the proto package.
+func (*ScraperTask) XXX_OneofFuncs() (func(msg proto.Message, b *proto.Buffer) error, func(msg proto.Message, tag, wire int, b *proto.Buffer) (bool, error), func(msg proto.Message) (n int), []interface{}) {
+	return _ScraperTask_OneofMarshaler, _ScraperTask_OneofUnmarshaler, _ScraperTask_OneofSizer, []interface{}{
+		(*ScraperTask_JiayuanTask)(nil),
+		(*ScraperTask_BaiheTask)(nil),
+		(*ScraperTask_RenrenTask)(nil),
+	}
+}
+
+func _ScraperTask_OneofMarshaler(msg proto.Message, b *proto.Buffer) error {
+	m := msg.(*ScraperTask)
+	// Task
+	switch x := m.Task.(type) {
+	case *ScraperTask_JiayuanTask:
+		b.EncodeVarint(3<<3 | proto.WireBytes)
+		if err := b.EncodeMessage(x.JiayuanTask); err != nil {
+			return err
+		}
+	case *ScraperTask_BaiheTask:
+		b.EncodeVarint(4<<3 | proto.WireBytes)
+		if err := b.EncodeMessage(x.BaiheTask); err != nil {
+			return err
+		}
+	case *ScraperTask_RenrenTask:
+		b.EncodeVarint(5<<3 | proto.WireBytes)
+		if err := b.EncodeMessage(x.RenrenTask); err != nil {
+			return err
+		}
+	case nil:
+	default:
+		return fmt.Errorf("ScraperTask.Task has unexpected type %T", x)
+	}
+	return nil
+}
+
+func _ScraperTask_OneofUnmarshaler(msg proto.Message, tag, wire int, b *proto.Buffer) (bool, error) {
+	m := msg.(*ScraperTask)
+	switch tag {
+	case 3: // Task.JiayuanTask
+		if wire != proto.WireBytes {
+			return true, proto.ErrInternalBadWireType
+		}
+		msg := new(JiayuanTask)
+		err := b.DecodeMessage(msg)
+		m.Task = &ScraperTask_JiayuanTask{msg}
+		return true, err
+	case 4: // Task.BaiheTask
+		if wire != proto.WireBytes {
+			return true, proto.ErrInternalBadWireType
+		}
+		msg := new(BaiheTask)
+		err := b.DecodeMessage(msg)
+		m.Task = &ScraperTask_BaiheTask{msg}
+		return true, err
+	case 5: // Task.RenrenTask
+		if wire != proto.WireBytes {
+			return true, proto.ErrInternalBadWireType
+		}
+		msg := new(RenrenTask)
+		err := b.DecodeMessage(msg)
+		m.Task = &ScraperTask_RenrenTask{msg}
+		return true, err
+	default:
+		return false, nil
+	}
+}
+
+func _ScraperTask_OneofSizer(msg proto.Message) (n int) {
+	m := msg.(*ScraperTask)
+	// Task
+	switch x := m.Task.(type) {
+	case *ScraperTask_JiayuanTask:
+		s := proto.Size(x.JiayuanTask)
+		n += proto.SizeVarint(3<<3 | proto.WireBytes)
+		n += proto.SizeVarint(uint64(s))
+		n += s
+	case *ScraperTask_BaiheTask:
+		s := proto.Size(x.BaiheTask)
+		n += proto.SizeVarint(4<<3 | proto.WireBytes)
+		n += proto.SizeVarint(uint64(s))
+		n += s
+	case *ScraperTask_RenrenTask:
+		s := proto.Size(x.RenrenTask)
+		n += proto.SizeVarint(5<<3 | proto.WireBytes)
+		n += proto.SizeVarint(uint64(s))
+		n += s
+	case nil:
+	default:
+		panic(fmt.Sprintf("proto: unexpected type %T in oneof", x))
+	}
+	return n
+}
 
 type ScraperTasks struct {
 	Tasks []*ScraperTask `protobuf:"bytes,1,rep,name=Tasks,json=tasks" json:"Tasks,omitempty"`
@@ -149,7 +471,7 @@ type ScraperTasks struct {
 func (m *ScraperTasks) Reset()                    { *m = ScraperTasks{} }
 func (m *ScraperTasks) String() string            { return proto.CompactTextString(m) }
 func (*ScraperTasks) ProtoMessage()               {}
-func (*ScraperTasks) Descriptor() ([]byte, []int) { return fileDescriptor1, []int{7} }
+func (*ScraperTasks) Descriptor() ([]byte, []int) { return fileDescriptor3, []int{12} }
 
 func (m *ScraperTasks) GetTasks() []*ScraperTask {
 	if m != nil {
@@ -160,39 +482,77 @@ func (m *ScraperTasks) GetTasks() []*ScraperTask {
 
 func init() {
 	proto.RegisterType((*SocialImageTask)(nil), "model.SocialImageTask")
+	proto.RegisterType((*TaskLimits)(nil), "model.TaskLimits")
 	proto.RegisterType((*IdProfileTask)(nil), "model.IdProfileTask")
+	proto.RegisterType((*IdRange)(nil), "model.IdRange")
 	proto.RegisterType((*ImageTask)(nil), "model.ImageTask")
+	proto.RegisterType((*ImageUrl)(nil), "model.ImageUrl")
+	proto.RegisterType((*SitemapTask)(nil), "model.SitemapTask")
+	proto.RegisterType((*LinkTask)(nil), "model.LinkTask")
 	proto.RegisterType((*JiayuanTask)(nil), "model.JiayuanTask")
 	proto.RegisterType((*BaiheTask)(nil), "model.BaiheTask")
 	proto.RegisterType((*RenrenTask)(nil), "model.RenrenTask")
 	proto.RegisterType((*ScraperTask)(nil), "model.ScraperTask")
 	proto.RegisterType((*ScraperTasks)(nil), "model.ScraperTasks")
 	proto.RegisterEnum("model.TaskType", TaskType_name, TaskType_value)
+	proto.RegisterEnum("model.TaskState", TaskState_name, TaskState_value)
 }
 
-var fileDescriptor1 = []byte{
-	// 362 bytes of a gzipped FileDescriptorProto
-	0x1f, 0x8b, 0x08, 0x00, 0x00, 0x09, 0x6e, 0x88, 0x02, 0xff, 0xac, 0x52, 0xc1, 0x4e, 0xc2, 0x40,
-	0x10, 0xb5, 0xb4, 0x05, 0x3b, 0x05, 0x69, 0x26, 0xc4, 0xf4, 0x64, 0x4c, 0xbd, 0x10, 0x0f, 0x3d,
-	0xe0, 0xc5, 0x78, 0xa2, 0x44, 0x8c, 0x85, 0x58, 0xc8, 0x02, 0x31, 0x9e, 0xc8, 0x42, 0x57, 0x6c,
-	0x2c, 0x2d, 0x69, 0xcb, 0x81, 0xdf, 0xf1, 0x4b, 0xdd, 0xae, 0x14, 0x01, 0x2f, 0x1e, 0x48, 0x9a,
-	0x66, 0xe6, 0xcd, 0x9b, 0xf7, 0x5e, 0x76, 0x17, 0x20, 0xa3, 0xe9, 0xa7, 0xbd, 0x4a, 0xe2, 0x2c,
-	0x46, 0x75, 0x19, 0xfb, 0x2c, 0xb4, 0xbe, 0x24, 0xa8, 0x8f, 0xe2, 0x79, 0x40, 0x43, 0x77, 0x49,
-	0x17, 0x6c, 0xcc, 0x09, 0x78, 0x03, 0xca, 0x78, 0xb3, 0x62, 0xa6, 0x74, 0x2d, 0x35, 0x2f, 0x5a,
-	0x75, 0x5b, 0x30, 0xed, 0x7c, 0x94, 0xc3, 0x44, 0xc9, 0xf8, 0x1f, 0x1f, 0xa0, 0xe6, 0xfa, 0xc3,
-	0x24, 0x7e, 0x0f, 0x42, 0xb1, 0x65, 0x96, 0x38, 0x5b, 0x6f, 0x35, 0xb6, 0xec, 0x83, 0x19, 0xa9,
-	0x05, 0xfb, 0x2d, 0xda, 0xa0, 0xed, 0xdc, 0x4c, 0x59, 0xec, 0x19, 0xc5, 0x5e, 0x81, 0x13, 0x2d,
-	0x28, 0x4a, 0x6b, 0x7a, 0xe4, 0x85, 0x26, 0x54, 0x3a, 0x6c, 0x11, 0x44, 0xae, 0x2f, 0x42, 0xca,
-	0xa4, 0x32, 0xfb, 0x69, 0xb1, 0x01, 0x6a, 0x37, 0xf2, 0x39, 0x5e, 0x12, 0xb8, 0xca, 0xf2, 0x06,
-	0xaf, 0x00, 0x26, 0x49, 0x38, 0xa4, 0x59, 0xc6, 0x92, 0x48, 0x38, 0x6a, 0x04, 0xd6, 0x3b, 0xc4,
-	0xd2, 0xf7, 0x02, 0x59, 0x03, 0xd0, 0x7b, 0x01, 0xdd, 0xac, 0x69, 0x24, 0xbc, 0xda, 0x7f, 0x0e,
-	0x48, 0x78, 0xea, 0xad, 0xcb, 0x6d, 0xe4, 0xa3, 0x29, 0xa9, 0xa7, 0x87, 0x80, 0xf5, 0x02, 0x5a,
-	0x87, 0x06, 0x1f, 0xec, 0x44, 0x72, 0x1e, 0x00, 0x61, 0x51, 0xc2, 0x4e, 0x15, 0xef, 0x09, 0xf4,
-	0xd1, 0x3c, 0xa1, 0x2b, 0x96, 0xfc, 0xff, 0xf6, 0x11, 0x94, 0x47, 0x9a, 0x51, 0x71, 0xca, 0x1a,
-	0x51, 0x7c, 0x5e, 0x5b, 0xf7, 0x50, 0xdd, 0xd3, 0x49, 0xb1, 0x09, 0xaa, 0x28, 0xb8, 0x92, 0xcc,
-	0xf3, 0x60, 0x91, 0xe7, 0x97, 0x43, 0xd4, 0xfc, 0x41, 0xa6, 0xb7, 0x6d, 0x38, 0x2f, 0xf4, 0xd1,
-	0x80, 0xea, 0xc4, 0xeb, 0x7b, 0x83, 0x57, 0x6f, 0x3a, 0x76, 0x46, 0x7d, 0xe3, 0x0c, 0x75, 0xa8,
-	0xf4, 0x5c, 0xe7, 0x6d, 0xe2, 0x78, 0x86, 0x84, 0x1a, 0xa8, 0x1d, 0xc7, 0x7d, 0xee, 0x1a, 0x25,
-	0x04, 0x28, 0x93, 0xae, 0xc7, 0x3f, 0x43, 0x9e, 0x95, 0xc5, 0xa3, 0xbe, 0xfb, 0x0e, 0x00, 0x00,
-	0xff, 0xff, 0x87, 0xa3, 0x6a, 0x40, 0xe2, 0x02, 0x00, 0x00,
+var fileDescriptor3 = []byte{
+	// 880 bytes of a gzipped FileDescriptorProto
+	0x1f, 0x8b, 0x08, 0x00, 0x00, 0x09, 0x6e, 0x88, 0x02, 0xff, 0xac, 0x55, 0xdb, 0x6e, 0xdb, 0x46,
+	0x10, 0x35, 0xc5, 0x9b, 0x38, 0x94, 0x6d, 0x76, 0x11, 0x04, 0x44, 0x51, 0x14, 0x06, 0x0b, 0xa4,
+	0x6a, 0x0a, 0x18, 0x85, 0x53, 0x14, 0x6d, 0x1f, 0x8a, 0x48, 0x16, 0x5d, 0x31, 0x91, 0x69, 0x61,
+	0x25, 0x21, 0x68, 0x5f, 0x8a, 0x75, 0xb8, 0xb6, 0x58, 0x53, 0xa4, 0xb0, 0x5c, 0x23, 0xf1, 0x7f,
+	0xf4, 0x17, 0xfa, 0x5f, 0xfd, 0x81, 0xf6, 0x1b, 0x8a, 0x1d, 0x5e, 0x44, 0x35, 0x79, 0x68, 0x80,
+	0x3c, 0x89, 0xe7, 0xcc, 0x9e, 0xd9, 0x3d, 0xb3, 0xa3, 0x59, 0x00, 0xc9, 0xca, 0xbb, 0xd3, 0xad,
+	0x28, 0x64, 0x41, 0xcc, 0x4d, 0x91, 0xf0, 0x2c, 0xf8, 0xa7, 0x07, 0xc7, 0x8b, 0xe2, 0x75, 0xca,
+	0xb2, 0x68, 0xc3, 0x6e, 0xf9, 0x92, 0x95, 0x77, 0xe4, 0x0b, 0x30, 0x96, 0x0f, 0x5b, 0xee, 0x6b,
+	0x27, 0xda, 0xf0, 0xe8, 0xec, 0xf8, 0x14, 0x57, 0x9e, 0xaa, 0x90, 0xa2, 0xa9, 0x21, 0x1f, 0xb6,
+	0x9c, 0xfc, 0x08, 0x87, 0x51, 0x32, 0x17, 0xc5, 0x4d, 0x9a, 0xa1, 0xca, 0xef, 0x9d, 0x68, 0x43,
+	0xf7, 0xec, 0x51, 0xbd, 0x7a, 0x2f, 0x46, 0x0f, 0xd3, 0x2e, 0x24, 0xa7, 0xe0, 0xb4, 0xbb, 0xf9,
+	0x3a, 0xea, 0xbc, 0x46, 0xd7, 0xf0, 0xd4, 0x49, 0xdb, 0x03, 0x7d, 0x0b, 0xee, 0x22, 0x95, 0x7c,
+	0xc3, 0xb6, 0xa8, 0x30, 0x50, 0x41, 0x6a, 0x45, 0x27, 0x42, 0xdd, 0x72, 0x07, 0xc8, 0xd7, 0xd0,
+	0x9f, 0xa5, 0xf9, 0x1d, 0x4a, 0x4c, 0x94, 0x34, 0x56, 0x1a, 0x9a, 0xf6, 0xb3, 0xfa, 0x8b, 0x3c,
+	0x01, 0x73, 0x21, 0x99, 0xe4, 0xbe, 0x85, 0xa6, 0xbd, 0x8e, 0x69, 0xe4, 0xa9, 0x59, 0xaa, 0x1f,
+	0xf2, 0x08, 0xcc, 0x50, 0x88, 0x42, 0xf8, 0xf6, 0x89, 0x36, 0x74, 0xa8, 0xc9, 0x15, 0x20, 0x5f,
+	0x81, 0x35, 0x4b, 0x37, 0xa9, 0x2c, 0xfd, 0x3e, 0x6e, 0xf4, 0x49, 0x47, 0x5e, 0x05, 0xa8, 0x95,
+	0xe1, 0x6f, 0xf0, 0x13, 0xc0, 0x8e, 0x25, 0x3e, 0xd8, 0xcb, 0xb5, 0xe0, 0x2c, 0x29, 0xb1, 0xda,
+	0x26, 0xb5, 0x65, 0x05, 0xc9, 0x63, 0xb0, 0x5e, 0xf1, 0xf4, 0x76, 0x2d, 0xb1, 0xb0, 0x26, 0xb5,
+	0xde, 0x20, 0x0a, 0xfe, 0xd4, 0xfe, 0x53, 0x78, 0x95, 0x63, 0xcc, 0x6f, 0xd3, 0x3c, 0x4a, 0x30,
+	0x87, 0x4e, 0xed, 0xeb, 0x0a, 0xe2, 0x61, 0xf3, 0x24, 0x4a, 0x30, 0x85, 0x4e, 0x4d, 0xae, 0x00,
+	0xf9, 0x1c, 0x60, 0x25, 0xb2, 0x39, 0x93, 0x92, 0x8b, 0x1c, 0xcb, 0xef, 0x50, 0xb8, 0x6f, 0x19,
+	0xf2, 0x04, 0xac, 0x19, 0x67, 0x25, 0x4f, 0x7c, 0xe3, 0x44, 0x1f, 0xba, 0x67, 0x47, 0xed, 0x95,
+	0x52, 0x96, 0xdf, 0x72, 0x6a, 0x65, 0x18, 0x25, 0x9f, 0x81, 0x13, 0xf3, 0xb7, 0x12, 0xd7, 0x62,
+	0x81, 0x75, 0xea, 0xe4, 0x0d, 0x11, 0xfc, 0x00, 0x76, 0x2d, 0xf8, 0xd0, 0x03, 0x06, 0x7f, 0x68,
+	0x9d, 0xfe, 0x20, 0x5f, 0x82, 0x85, 0x40, 0x55, 0x48, 0xef, 0x5c, 0x22, 0x92, 0x2b, 0x91, 0x51,
+	0x0b, 0x1b, 0x05, 0x6b, 0xb9, 0x12, 0xd9, 0x45, 0x9a, 0x71, 0x4c, 0xe7, 0x50, 0xfb, 0xbe, 0x82,
+	0x2a, 0x72, 0x91, 0x8a, 0x52, 0x46, 0x09, 0xda, 0xd5, 0xa9, 0x7d, 0x53, 0x41, 0x42, 0xc0, 0x50,
+	0x1e, 0xb0, 0xa5, 0x74, 0x6a, 0xa8, 0xe3, 0xab, 0xca, 0x5f, 0x14, 0x59, 0xc2, 0x05, 0x9a, 0x72,
+	0xa8, 0x75, 0x83, 0x28, 0x18, 0x43, 0xbf, 0xd9, 0x93, 0x78, 0xa0, 0xaf, 0x44, 0x86, 0x76, 0x1c,
+	0xaa, 0xdf, 0x8b, 0x8c, 0x1c, 0x41, 0xaf, 0xf5, 0xd1, 0x4b, 0xd1, 0xda, 0x8c, 0x5d, 0xf3, 0xac,
+	0x2e, 0xb0, 0x99, 0x29, 0x10, 0x6c, 0xf6, 0x3a, 0xf9, 0x3d, 0x69, 0xf6, 0x2f, 0xa7, 0xf7, 0xce,
+	0xe5, 0xf8, 0x60, 0xd7, 0x09, 0x1a, 0x2b, 0x75, 0xcb, 0xbf, 0xcf, 0x4a, 0xf0, 0x97, 0xb6, 0xfb,
+	0x0f, 0xa8, 0x13, 0x2d, 0x38, 0x4f, 0xaa, 0x3a, 0x3a, 0xd4, 0x2c, 0x15, 0x20, 0x9f, 0x42, 0xff,
+	0x92, 0xbd, 0x9d, 0xf0, 0xad, 0x5c, 0xd7, 0x9d, 0xd6, 0xdf, 0xd4, 0x58, 0x29, 0xa6, 0x45, 0x29,
+	0x4b, 0x5f, 0xaf, 0x14, 0x6b, 0x05, 0xd4, 0x11, 0x47, 0x59, 0x56, 0xbc, 0x99, 0x33, 0xb9, 0x2e,
+	0xb1, 0x47, 0x1c, 0x0a, 0xac, 0x65, 0x54, 0x5f, 0x4c, 0x78, 0xfe, 0x50, 0x85, 0x4d, 0x0c, 0x3b,
+	0x49, 0x43, 0x90, 0x00, 0x06, 0x58, 0xc5, 0xc6, 0xa2, 0x85, 0x16, 0x07, 0x69, 0x87, 0xeb, 0xdc,
+	0x80, 0xdd, 0xbd, 0x81, 0xd6, 0x62, 0xbf, 0x63, 0xf1, 0x0a, 0xdc, 0x17, 0x29, 0x7b, 0xb8, 0x67,
+	0x39, 0x9a, 0x7c, 0xfe, 0xce, 0x38, 0xc3, 0xea, 0xba, 0x67, 0x8f, 0x9b, 0x71, 0xb1, 0x1f, 0xa5,
+	0xc7, 0xe5, 0x3e, 0x11, 0x5c, 0x82, 0x33, 0x66, 0xe9, 0x9a, 0x7f, 0xa4, 0x74, 0x31, 0x00, 0xe5,
+	0xb9, 0xe0, 0x1f, 0xeb, 0x78, 0x7f, 0x6b, 0xe0, 0x2e, 0x5e, 0x0b, 0xb6, 0xe5, 0x02, 0x33, 0x7e,
+	0xb7, 0xe7, 0xdf, 0xd7, 0xf7, 0x66, 0x63, 0x27, 0x32, 0x3d, 0xa0, 0xee, 0xef, 0x3b, 0x48, 0xbe,
+	0xe9, 0xd8, 0xac, 0x27, 0x6a, 0x33, 0xf4, 0x5a, 0x7e, 0x7a, 0x40, 0x9d, 0xeb, 0x06, 0x90, 0x67,
+	0x5d, 0x27, 0xbe, 0xb9, 0x37, 0xe8, 0x76, 0x81, 0xe9, 0x01, 0x05, 0xb1, 0x33, 0xfc, 0xbf, 0xde,
+	0x12, 0x02, 0xc6, 0x84, 0x49, 0x56, 0xb7, 0xbb, 0x91, 0x30, 0xc9, 0xc6, 0x16, 0x18, 0xe8, 0xf7,
+	0x7b, 0x18, 0x74, 0xec, 0x96, 0x64, 0x08, 0x26, 0x7e, 0xd4, 0xd3, 0xa0, 0x7d, 0x05, 0x76, 0x6b,
+	0xa8, 0xa9, 0x9e, 0xb9, 0xf2, 0xe9, 0x73, 0xe8, 0x37, 0xfb, 0x10, 0x0f, 0x06, 0xab, 0xf8, 0x65,
+	0x7c, 0xf5, 0x2a, 0xfe, 0x6d, 0x39, 0x5a, 0xbc, 0xf4, 0x0e, 0x88, 0x0b, 0xf6, 0x8b, 0x68, 0xf4,
+	0xcb, 0x6a, 0x14, 0x7b, 0x1a, 0x71, 0xc0, 0x1c, 0x8f, 0xa2, 0x69, 0xe8, 0xf5, 0x08, 0x80, 0x45,
+	0xc3, 0x98, 0x86, 0xb1, 0xa7, 0x3f, 0xfd, 0x15, 0x9c, 0xf6, 0x01, 0x50, 0x82, 0x79, 0x18, 0x4f,
+	0xa2, 0xf8, 0xe7, 0x4a, 0x4d, 0x57, 0x71, 0xac, 0x80, 0xa6, 0x24, 0xf3, 0xd1, 0x6a, 0x11, 0x4e,
+	0xbc, 0x1e, 0x39, 0x04, 0xe7, 0xfc, 0xea, 0x72, 0x3e, 0x0b, 0x97, 0xe1, 0xc4, 0xd3, 0x55, 0xe8,
+	0x62, 0x14, 0xcd, 0xc2, 0x89, 0x67, 0x90, 0x01, 0xf4, 0xcf, 0x47, 0xf1, 0x79, 0xa8, 0x90, 0x79,
+	0x6d, 0xe1, 0x33, 0xfc, 0xec, 0xdf, 0x01, 0x00, 0x37, 0x83, 0xe8, 0x77, 0x94, 0x07, 0x00, 0x00,
 }
@@ -0,0 +1,64 @@
+package main
+
+import (
+	"flag"
+	"github.com/charleswong/scraper/archive"
+	"github.com/charleswong/scraper/config"
+	"log"
+	"os"
+	"path"
+)
+
+func main() {
+	log.SetFlags(log.Lshortfile | log.LstdFlags)
+	configFile := flag.String("config", "scraper.conf", "Config file.")
+	site := flag.String("site", "Jiayuan", "Site name, e.g. Jiayuan or Baihe.")
+	beginId := flag.Int("begin", 0, "First Id to restore.")
+	endId := flag.Int("end", 0, "Last Id to restore, inclusive.")
+	id := flag.Int("id", 0, "Restore a single profile through the archive index.")
+	file := flag.String("file", "", "Write a single archived file, e.g. /100/210/541/x.jpg, to -out.")
+	out := flag.String("out", "", "Output file of -file. Defaults to stdout.")
+	dest := flag.String("dest", "", "Folder to restore into. Defaults to the site folder under DataFolder.")
+	flag.Parse()
+
+	conf, err := config.NewConfig(*configFile, nil)
+	if err != nil {
+		log.Fatal(err)
+	}
+	c := conf.Get()
+
+	basePath := *dest
+	if len(basePath) == 0 {
+		basePath = path.Join(c.DataFolder, *site)
+	}
+
+	switch {
+	case len(*file) > 0:
+		w := os.Stdout
+		if len(*out) > 0 {
+			f, err := os.Create(*out)
+			if err != nil {
+				log.Fatal(err)
+			}
+			defer f.Close()
+			w = f
+		}
+		err := archive.FetchFile(*file, c.ArchiveFolder, *site, w)
+		if err != nil {
+			log.Fatal(err)
+		}
+	case *id > 0:
+		_, err := archive.FetchProfile(*id, c.ArchiveFolder, *site, basePath)
+		if err != nil {
+			log.Fatal(err)
+		}
+	default:
+		if *endId < *beginId {
+			log.Fatal("Invalid Id range to restore.")
+		}
+		_, err := archive.Restore(*beginId, *endId+1, c.ArchiveFolder, *site, basePath)
+		if err != nil {
+			log.Fatal(err)
+		}
+	}
+}
@@ -1,40 +1,48 @@
 package main
 
 import (
+	"bufio"
 	"bytes"
 	"flag"
 	"fmt"
 	"github.com/charleswong/scraper/archive"
 	"github.com/charleswong/scraper/config"
+	"github.com/charleswong/scraper/frontier"
 	"github.com/charleswong/scraper/model"
+	"github.com/charleswong/scraper/sitemap"
 	"github.com/charleswong/scraper/util"
+	"golang.org/x/net/context"
 	"golang.org/x/net/html"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
 	"io/ioutil"
 	"log"
+	"net"
 	"net/http"
+	"net/url"
 	"os"
 	"os/signal"
 	"path"
+	"regexp"
 	"strconv"
 	"strings"
 	"sync"
+	"sync/atomic"
 	"syscall"
 	"time"
 )
 
-var (
-	basePath = "./deepavatar/"
-)
-
-func downloadFile(url, path string) error {
-	res, err := http.Get(url)
+// fetch gets url, retrying failed requests.
+func (r *runner) fetch(url string) ([]byte, error) {
+	res, err := r.client.Get(url)
 	for i := 0; ; i++ {
 		if err != nil {
 			log.Printf("Error: http.Get -> %v\n", err)
 			if i > 10 {
-				return err
+				return nil, err
 			} else {
-				res, err = http.Get(url)
+				res, err = r.client.Get(url)
 			}
 		} else {
 			break
@@ -45,6 +53,14 @@ func downloadFile(url, path string) error {
 	data, err := ioutil.ReadAll(res.Body)
 	if err != nil {
 		log.Printf("Error: ioutil.ReadAll -> %v\n", err)
+		return nil, err
+	}
+	return data, nil
+}
+
+func (r *runner) downloadFile(url, path string) error {
+	data, err := r.fetch(url)
+	if err != nil {
 		return err
 	}
 
@@ -78,10 +94,16 @@ func saveBytes(data []byte, path string) error {
 	return nil
 }
 
-func getPath(id int, taskType model.TaskType) string {
+// dataDir is the folder in the DataFolder of conf the files of folder, e.g.
+// a site, are saved to.
+func dataDir(conf *config.Config, folder string) string {
+	return path.Join(conf.Get().DataFolder, folder)
+}
+
+// getPath is the folder of id in dir, e.g. the folder of a site.
+func getPath(id int, dir string) string {
 	pathes := []string{
-		basePath,
-		SiteName[taskType],
+		dir,
 		strconv.Itoa(id / 1000000),
 		strconv.Itoa(id / 1000 % 1000),
 		strconv.Itoa(id % 1000),
@@ -97,31 +119,36 @@ func getPath(id int, taskType model.TaskType) string {
 	return p
 }
 
-func getProfilePath(id int, taskType model.TaskType) string {
+func getProfilePath(id int, dir string) string {
 	pathes := []string{
-		getPath(id, taskType),
+		getPath(id, dir),
 		strconv.Itoa(id) + ".html",
 	}
 	return path.Join(pathes...)
 }
 
-func getImagePath(id int, url string, taskType model.TaskType) string {
+func getImagePath(id int, url string, dir string) string {
 	urlTokens := strings.Split(url, "/")
 	if l := len(urlTokens); l == 0 {
 		return ""
 	}
 	imageName := urlTokens[len(urlTokens)-1]
 	pathes := []string{
-		getPath(id, taskType),
+		getPath(id, dir),
 		imageName,
 	}
 	return path.Join(pathes...)
 }
 
-func getStatPath(id int, taskType model.TaskType) string {
+func getStatPath(id int, dir string) string {
+	return getFolderStatPath(id, dir, ".stats")
+}
+
+// getFolderStatPath is the file with extension ext in the stats of dir that
+// id is recorded in.
+func getFolderStatPath(id int, dir string, ext string) string {
 	pathes := []string{
-		basePath,
-		SiteName[taskType],
+		dir,
 		"stats",
 	}
 	p := path.Join(pathes...)
@@ -135,14 +162,14 @@ func getStatPath(id int, taskType model.TaskType) string {
 
 	pathes = []string{
 		p,
-		strconv.Itoa(id/1000) + ".stats",
+		strconv.Itoa(id/1000) + ext,
 	}
 	return path.Join(pathes...)
 }
 
-func saveProfilePage(id int, url string, taskType model.TaskType) error {
-	p := getProfilePath(id, taskType)
-	err := downloadFile(url, p)
+func (r *runner) saveProfilePage(id int, url string, dir string) error {
+	p := getProfilePath(id, dir)
+	err := r.downloadFile(url, p)
 	if err != nil {
 		log.Println(err)
 		return err
@@ -150,9 +177,9 @@ func saveProfilePage(id int, url string, taskType model.TaskType) error {
 	return nil
 }
 
-func saveImage(id int, url string, taskType model.TaskType) error {
-	p := getImagePath(id, url, taskType)
-	err := downloadFile(url, p)
+func (r *runner) saveImage(id int, url string, dir string) error {
+	p := getImagePath(id, url, dir)
+	err := r.downloadFile(url, p)
 	if err != nil {
 		log.Println(err)
 		return err
@@ -160,13 +187,13 @@ func saveImage(id int, url string, taskType model.TaskType) error {
 	return nil
 }
 
-func saveImageAsync(id int, url string, taskType model.TaskType, chFinished chan int) error {
+func (r *runner) saveImageAsync(id int, url string, dir string, chFinished chan int) error {
 	go func() {
 		defer func() {
 			chFinished <- 1
 		}()
-		p := getImagePath(id, url, taskType)
-		err := downloadFile(url, p)
+		p := getImagePath(id, url, dir)
+		err := r.downloadFile(url, p)
 		if err != nil {
 			log.Println(err)
 		}
@@ -175,14 +202,10 @@ func saveImageAsync(id int, url string, taskType model.TaskType, chFinished chan
 	return nil
 }
 
-var (
-	statsLock = &sync.Mutex{}
-)
-
-func saveStats(p *Profile, taskType model.TaskType) error {
-	statsLock.Lock()
-	defer statsLock.Unlock()
-	path := getStatPath(p.Id, taskType)
+func (r *runner) saveStats(p *Profile, dir string) error {
+	r.statsLock.Lock()
+	defer r.statsLock.Unlock()
+	path := getStatPath(p.Id, dir)
 	err := appendFile(p.ToString(), path)
 	if err != nil {
 		log.Println(err)
@@ -212,20 +235,12 @@ func (p *Profile) ToString() string {
 }
 
 var (
-	ImageUrlValidationFuncs = make(map[model.TaskType]func(*html.Node) []string)
-	ProfileTemplate         = make(map[model.TaskType]string)
-	SiteName                = make(map[model.TaskType]string)
+	ImageUrlValidationFuncs = map[model.TaskType]func(*html.Node) []string{
+		model.TaskType_JIAYUAN: ExtractJiayuanImage,
+		model.TaskType_BAIHE:   ExtractBaiheImage,
+	}
 )
 
-func InitMaps() {
-	ProfileTemplate[model.TaskType_JIAYUAN] = "http://www.jiayuan.com/%d"
-	ProfileTemplate[model.TaskType_BAIHE] = "http://profile1.baihe.com/?oppId=%d"
-	ImageUrlValidationFuncs[model.TaskType_JIAYUAN] = ExtractJiayuanImage
-	ImageUrlValidationFuncs[model.TaskType_BAIHE] = ExtractBaiheImage
-	SiteName[model.TaskType_JIAYUAN] = "Jiayuan"
-	SiteName[model.TaskType_BAIHE] = "Baihe"
-}
-
 func ExtractJiayuanImage(n *html.Node) []string {
 	images := make([]string, 0)
 	if n.Type == html.ElementNode && n.Data == "img" {
@@ -297,11 +312,7 @@ func parseProfile(id int, b []byte, taskType model.TaskType) (*Profile, error) {
 	return profile, nil
 }
 
-var (
-	client = &http.Client{}
-)
-
-func crawl(id int, url string, taskType model.TaskType) (*Profile, error) {
+func (r *runner) crawl(id int, url string, taskType model.TaskType) (*Profile, error) {
 	req, err := http.NewRequest("GET", url, nil)
 	if err != nil {
 		log.Println(err)
@@ -310,11 +321,11 @@ func crawl(id int, url string, taskType model.TaskType) (*Profile, error) {
 
 	req.Header.Set("User-Agent", "Mozilla/5.0 (compatible; Googlebot/2.1; +http://www.google.com/bot.html)")
 
-	resp, err := client.Do(req)
+	resp, err := r.client.Do(req)
 	for i := 0; i < 10; i++ {
 		if err != nil {
 			log.Println("Crawler Error: Failed to crawl \"" + url + "\"")
-			resp, err = client.Do(req)
+			resp, err = r.client.Do(req)
 		} else {
 			break
 		}
@@ -328,7 +339,7 @@ func crawl(id int, url string, taskType model.TaskType) (*Profile, error) {
 
 	data, err := ioutil.ReadAll(b)
 	if err != nil {
-		log.Println("Crawler Error: ioutil.ReadAll -> %v", err)
+		log.Printf("Crawler Error: ioutil.ReadAll -> %v\n", err)
 		return nil, err
 	}
 
@@ -337,14 +348,15 @@ func crawl(id int, url string, taskType model.TaskType) (*Profile, error) {
 	return profile, err
 }
 
-func save(profile *Profile, taskType model.TaskType) error {
+// save saves the images and page of profile in dir.
+func (r *runner) save(profile *Profile, dir string) error {
 
 	// Save images.
 	if len(profile.ImageURLs) > 0 {
 		chImg := make(chan int, len(profile.ImageURLs))
 		for _, imgUrl := range profile.ImageURLs {
 			// saveImage(profile.Id, imgUrl)
-			saveImageAsync(profile.Id, imgUrl, taskType, chImg)
+			r.saveImageAsync(profile.Id, imgUrl, dir, chImg)
 		}
 
 		finishedImg := 0
@@ -356,37 +368,1096 @@ func save(profile *Profile, taskType model.TaskType) error {
 		}
 	}
 	// Save profile page.
-	saveBytes(profile.RawData, getProfilePath(profile.Id, taskType))
-	saveStats(profile, taskType)
+	saveBytes(profile.RawData, getProfilePath(profile.Id, dir))
+	r.saveStats(profile, dir)
 
 	return nil
 }
 
+// imageFolder is the folder in DataFolder the images of t are saved to.
+func imageFolder(t *model.ImageTask, taskType model.TaskType) string {
+	if len(t.Folder) > 0 {
+		return t.Folder
+	}
+	return model.SiteName[taskType]
+}
+
+// parseImageLine parses a line of an ImageTask UrlFile: the URL, then
+// optionally the Id and the label, separated by tabs.
+func parseImageLine(line string) (*model.ImageUrl, error) {
+	parts := strings.SplitN(line, "\t", 3)
+	image := &model.ImageUrl{Url: strings.TrimSpace(parts[0])}
+	if len(parts) > 1 && len(strings.TrimSpace(parts[1])) > 0 {
+		id, err := strconv.ParseInt(strings.TrimSpace(parts[1]), 10, 64)
+		if err != nil {
+			return nil, fmt.Errorf("Invalid Id in %q: %v", line, err)
+		}
+		image.Id = id
+	}
+	if len(parts) > 2 {
+		image.Label = strings.TrimSpace(parts[2])
+	}
+	if !config.ValidUrl(image.Url) {
+		return nil, fmt.Errorf("Invalid image URL in %q", line)
+	}
+	return image, nil
+}
+
+// listImages calls f with the position and image of each image of t from
+// position next on, until f returns false. Images without an Id get FirstId
+// plus their position. Invalid lines of UrlFile are logged and skipped.
+func listImages(t *model.ImageTask, next int, f func(pos int, image *model.ImageUrl) bool) error {
+	pos := -1
+	visit := func(image *model.ImageUrl) bool {
+		pos++
+		if pos < next {
+			return true
+		}
+		if image.Id == 0 {
+			image.Id = t.FirstId + int64(pos)
+		}
+		return f(pos, image)
+	}
+	for _, image := range t.Images {
+		if !visit(&model.ImageUrl{Url: image.Url, Id: image.Id, Label: image.Label}) {
+			return nil
+		}
+	}
+	if len(t.UrlFile) == 0 {
+		return nil
+	}
+	file, err := os.Open(t.UrlFile)
+	if err != nil {
+		log.Println(err)
+		return err
+	}
+	defer file.Close()
+	scanner := bufio.NewScanner(file)
+	for scanner.Scan() {
+		line := strings.TrimSpace(scanner.Text())
+		if len(line) == 0 || strings.HasPrefix(line, "#") {
+			continue
+		}
+		image, err := parseImageLine(line)
+		if err != nil {
+			log.Println(err)
+			pos++
+			continue
+		}
+		if !visit(image) {
+			return nil
+		}
+	}
+	return scanner.Err()
+}
+
+// saveListedImage downloads an image of an ImageTask to dir and records it
+// in the manifest of dir, next to the stats.
+func (r *runner) saveListedImage(image *model.ImageUrl, dir string) error {
+	data, err := r.fetch(image.Url)
+	if err != nil {
+		log.Println(err)
+		return err
+	}
+	if contentType := http.DetectContentType(data); !strings.HasPrefix(contentType, "image/") {
+		err := fmt.Errorf("%s is %s, not an image", image.Url, contentType)
+		log.Println(err)
+		return err
+	}
+	id := int(image.Id)
+	idDir := getPath(id, dir)
+	if len(idDir) == 0 {
+		return fmt.Errorf("Cannot create the folder of image %d", id)
+	}
+	p := path.Join(idDir, path.Base(image.Url))
+	err = ioutil.WriteFile(p, data, 0666)
+	if err != nil {
+		log.Println(err)
+		return err
+	}
+	log.Printf("Downloaded %d bytes from %s -> %s\n", len(data), image.Url, p)
+
+	r.statsLock.Lock()
+	defer r.statsLock.Unlock()
+	line := strings.Join([]string{strconv.Itoa(id), path.Base(p), image.Label, image.Url}, "\t")
+	return appendFile(line, getFolderStatPath(id, dir, ".images"))
+}
+
+// crawlImages downloads the images of an ImageTask, ThreadNum at a time.
+// It tells whether every image was downloaded.
+func (r *runner) crawlImages(task model.Task, threads util.Limiter) (bool, error) {
+	t := task.GetSocialImageTask().GetImageTask()
+	dir := dataDir(r.conf, imageFolder(t, task.GetType()))
+	next, finished := int(t.Next), true
+	var wg sync.WaitGroup
+	defer wg.Wait()
+	err := listImages(t, next, func(pos int, image *model.ImageUrl) bool {
+		if stopped(task, r.store) {
+			finished = false
+			return false
+		}
+		next = pos + 1
+		threads.Acquire()
+		wg.Add(1)
+		go func() {
+			defer func() {
+				threads.Release()
+				wg.Done()
+			}()
+			log.Println("Downloading image: ", image.Id, image.Url)
+			err := r.saveListedImage(image, dir)
+			r.stats.record(task, err == nil, err)
+		}()
+		err := r.store.Update(func() {
+			t.Next = int64(pos)
+		})
+		if err != nil {
+			log.Println(err)
+		}
+		return true
+	})
+	if err != nil {
+		log.Println(err)
+		return false, err
+	}
+	if finished {
+		// Skip the last image on restart too.
+		err = r.store.Update(func() {
+			t.Next = int64(next)
+		})
+		if err != nil {
+			log.Println(err)
+		}
+	}
+	return finished, nil
+}
+
+// crawlProfile crawls the profile id at url and saves it when it has
+// enough images. It tells whether it saved the profile.
+func (r *runner) crawlProfile(id int, url string, taskType model.TaskType) (bool, error) {
+	log.Println("Crawling Id: ", id)
+	profile, err := r.crawl(id, url, taskType)
+	if err != nil {
+		log.Println(err)
+		return false, err
+	}
+	if profile != nil && len(profile.ImageURLs) >= int(r.conf.Get().ValidImgNum) {
+		return true, r.save(profile, dataDir(r.conf, model.SiteName[taskType]))
+	}
+	return false, nil
+}
+
+var lastNumber = regexp.MustCompile(`[0-9]+`)
+
+// sitemapProfileId is the id of the profile at url: the first group of
+// pattern, or else the last number of url.
+func sitemapProfileId(pattern *regexp.Regexp, url string) (int, bool) {
+	m := pattern.FindStringSubmatch(url)
+	if m == nil {
+		return 0, false
+	}
+	s := ""
+	if len(m) > 1 {
+		s = m[1]
+	} else if numbers := lastNumber.FindAllString(url, -1); len(numbers) > 0 {
+		s = numbers[len(numbers)-1]
+	}
+	id, err := strconv.Atoi(s)
+	if err != nil {
+		return 0, false
+	}
+	return id, true
+}
+
+// crawlSitemap crawls the profiles listed in the sitemaps of a SitemapTask,
+// ThreadNum at a time. It tells whether every sitemap was crawled.
+func (r *runner) crawlSitemap(task model.Task, threads util.Limiter) (bool, error) {
+	t := task.GetSocialImageTask().GetSitemapTask()
+	pattern := regexp.MustCompile(t.UrlPattern)
+	last, finished := -1, true
+	var wg sync.WaitGroup
+	defer wg.Wait()
+	err := sitemap.Walk(t.Url, r.fetch, int(t.Sitemap), int(t.Next), func(sm, next int, loc string) bool {
+		if stopped(task, r.store) {
+			finished = false
+			return false
+		}
+		last = sm
+		if id, ok := sitemapProfileId(pattern, loc); ok {
+			threads.Acquire()
+			wg.Add(1)
+			go func() {
+				defer func() {
+					threads.Release()
+					wg.Done()
+				}()
+				saved, err := r.crawlProfile(id, loc, task.GetType())
+				r.stats.record(task, saved, err)
+			}()
+		}
+		err := r.store.Update(func() {
+			t.Sitemap, t.Next = int64(sm), int64(next)
+		})
+		if err != nil {
+			log.Println(err)
+		}
+		return true
+	})
+	if err != nil {
+		log.Println(err)
+		return false, err
+	}
+	if finished && last >= 0 {
+		// Past the last sitemap, so that a restart finds nothing left.
+		err = r.store.Update(func() {
+			t.Sitemap, t.Next = int64(last+1), 0
+		})
+		if err != nil {
+			log.Println(err)
+		}
+	}
+	return finished, nil
+}
+
+// linkFolder is the folder in DataFolder the pages of t are saved to.
+func linkFolder(t *model.LinkTask, taskType model.TaskType) string {
+	if len(t.Folder) > 0 {
+		return t.Folder
+	}
+	return model.SiteName[taskType] + "Links"
+}
+
+// pageLinks returns the canonical URLs of the links and the URLs of the
+// images of the page at pageUrl.
+func pageLinks(pageUrl string, doc *html.Node) ([]string, []string) {
+	base, err := url.Parse(pageUrl)
+	if err != nil {
+		return nil, nil
+	}
+	links, images := make([]string, 0), make([]string, 0)
+	var walk func(n *html.Node)
+	walk = func(n *html.Node) {
+		if n.Type == html.ElementNode && (n.Data == "a" || n.Data == "img") {
+			for _, attr := range n.Attr {
+				if (n.Data == "a" && attr.Key != "href") || (n.Data == "img" && attr.Key != "src") {
+					continue
+				}
+				ref, err := url.Parse(strings.TrimSpace(attr.Val))
+				if err != nil {
+					break
+				}
+				abs := base.ResolveReference(ref).String()
+				if n.Data == "img" {
+					images = append(images, abs)
+				} else if canonical, err := frontier.Canonicalize(abs); err == nil {
+					links = append(links, canonical)
+				}
+				break
+			}
+		}
+		for c := n.FirstChild; c != nil; c = c.NextSibling {
+			walk(c)
+		}
+	}
+	walk(doc)
+	return links, images
+}
+
+// linkCrawl is a LinkTask being crawled.
+type linkCrawl struct {
+	task         model.Task
+	dir          string
+	scope        *frontier.Scope
+	imagePattern *regexp.Regexp
+	queue        *frontier.Frontier
+	r            *runner
+}
+
+// crawlPage crawls the page at position id of the frontier, queues its
+// links in scope and saves it when it has enough images. It tells whether
+// it saved the page.
+func (c *linkCrawl) crawlPage(id int, e frontier.Entry) (bool, error) {
+	log.Println("Crawling link: ", id, e.Url)
+	profile, err := c.r.crawl(id, e.Url, c.task.GetType())
+	if err != nil {
+		log.Println(err)
+		return false, err
+	}
+	doc, err := html.Parse(bytes.NewReader(profile.RawData))
+	if err != nil {
+		log.Println(err)
+		return false, err
+	}
+	links, images := pageLinks(e.Url, doc)
+	if e.Depth < int(c.task.GetSocialImageTask().GetLinkTask().MaxDepth) {
+		for _, link := range links {
+			if !c.scope.Contains(link) {
+				continue
+			}
+			if _, err := c.queue.Add(link, e.Depth+1); err != nil {
+				log.Println(err)
+			}
+		}
+	}
+	if c.imagePattern != nil {
+		profile.ImageURLs = make([]string, 0)
+		for _, image := range images {
+			if c.imagePattern.MatchString(image) {
+				profile.ImageURLs = append(profile.ImageURLs, image)
+			}
+		}
+	}
+	if len(profile.ImageURLs) >= int(c.r.conf.Get().ValidImgNum) {
+		return true, c.r.save(profile, c.dir)
+	}
+	return false, nil
+}
+
+// crawlLinks crawls the pages of a LinkTask breadth first, ThreadNum at a
+// time. The frontier is kept in links.frontier of the task folder, so page
+// ids and the URLs already seen survive restarts. It tells whether every
+// page found was crawled.
+func (r *runner) crawlLinks(task model.Task, threads util.Limiter) (bool, error) {
+	t := task.GetSocialImageTask().GetLinkTask()
+	c := &linkCrawl{task: task, dir: dataDir(r.conf, linkFolder(t, task.GetType())), r: r}
+	var err error
+	c.scope, err = frontier.NewScope(t.Seeds, t.Hosts, t.AllowPaths, t.DenyPaths)
+	if err != nil {
+		log.Println(err)
+		return false, err
+	}
+	if len(t.ImagePattern) > 0 {
+		c.imagePattern = regexp.MustCompile(t.ImagePattern)
+	}
+	if err := os.MkdirAll(c.dir, 0777); err != nil {
+		log.Println(err)
+		return false, err
+	}
+	c.queue, err = frontier.Open(path.Join(c.dir, "links.frontier"))
+	if err != nil {
+		log.Println(err)
+		return false, err
+	}
+	defer c.queue.Close()
+	for _, seed := range t.Seeds {
+		if u, err := frontier.Canonicalize(seed); err == nil {
+			c.queue.Add(u, 0)
+		}
+	}
+
+	var inflight int32
+	next, finished := int(t.Next), true
+	for ; ; next++ {
+		e, ok := c.queue.Get(next)
+		// Pages in flight may still queue links.
+		for !ok && atomic.LoadInt32(&inflight) > 0 {
+			time.Sleep(100 * time.Millisecond)
+			e, ok = c.queue.Get(next)
+		}
+		if !ok {
+			break
+		}
+		if stopped(task, r.store) {
+			finished = false
+			break
+		}
+		threads.Acquire()
+		atomic.AddInt32(&inflight, 1)
+		go func(id int, e frontier.Entry) {
+			defer func() {
+				atomic.AddInt32(&inflight, -1)
+				threads.Release()
+			}()
+			saved, err := c.crawlPage(id, e)
+			r.stats.record(task, saved, err)
+		}(next, e)
+		pos := next
+		err := r.store.Update(func() {
+			t.Next = int64(pos)
+		})
+		if err != nil {
+			log.Println(err)
+		}
+	}
+	for atomic.LoadInt32(&inflight) > 0 {
+		time.Sleep(100 * time.Millisecond)
+	}
+	if finished {
+		err = r.store.Update(func() {
+			t.Next = int64(next)
+		})
+		if err != nil {
+			log.Println(err)
+		}
+	}
+	return finished, nil
+}
+
+// stopped tells whether a running task has to stop: it was paused or
+// canceled, or the disk is full.
+func stopped(task model.Task, store *config.TaskStore) bool {
+	return store.State(task) != model.TaskState_RUNNING || util.IsLowDiskSpace()
+}
+
+// crawlIds crawls the profiles of an IdProfileTask, ThreadNum at a time,
+// and archives them with tracker. It tells whether every Id was crawled.
+func (r *runner) crawlIds(task model.Task, tracker *archive.Tracker, threads util.Limiter) (bool, error) {
+	t := task.GetSocialImageTask().GetIdProfileTask()
+	var wg sync.WaitGroup
+	for id := t.BeginId - 1; id < t.EndId; id++ {
+		if stopped(task, r.store) {
+			wg.Wait()
+			return false, nil
+		}
+		threads.Acquire()
+		taskId := int(id)
+		tracker.Start(taskId)
+		wg.Add(1)
+		go func() {
+			defer func() {
+				tracker.Done(taskId)
+				threads.Release()
+				wg.Done()
+			}()
+			url := fmt.Sprintf(model.ProfileTemplate[task.GetType()], taskId)
+			saved, err := r.crawlProfile(taskId, url, task.GetType())
+			r.stats.record(task, saved, err)
+		}()
+		err := r.store.Update(func() {
+			t.BeginId = int64(taskId)
+		})
+		if err != nil {
+			log.Println(err)
+		}
+	}
+	// Archiving starts when the last crawl of a range is done.
+	wg.Wait()
+	tracker.Wait()
+	return true, nil
+}
+
+// taskStats counts what each task crawled since the scraper started.
+type taskStats struct {
+	lock  sync.Mutex
+	tasks map[model.Task]*model.TaskStats
+}
+
+func newTaskStats() *taskStats {
+	return &taskStats{tasks: make(map[model.Task]*model.TaskStats)}
+}
+
+// of returns the stats of task. s.lock must be held.
+func (s *taskStats) of(task model.Task) *model.TaskStats {
+	stats, ok := s.tasks[task]
+	if !ok {
+		stats = &model.TaskStats{}
+		s.tasks[task] = stats
+	}
+	return stats
+}
+
+// start records that task started now.
+func (s *taskStats) start(task model.Task) {
+	s.lock.Lock()
+	defer s.lock.Unlock()
+	s.of(task).StartedTs = time.Now().Unix()
+}
+
+// record counts a page or image crawled by task, saved or failed with err.
+func (s *taskStats) record(task model.Task, saved bool, err error) {
+	s.lock.Lock()
+	defer s.lock.Unlock()
+	stats := s.of(task)
+	stats.Crawled++
+	if saved {
+		stats.Saved++
+	}
+	if err != nil {
+		stats.Failed++
+	}
+	stats.UpdatedTs = time.Now().Unix()
+}
+
+// get returns a copy of the stats of task.
+func (s *taskStats) get(task model.Task) model.TaskStats {
+	s.lock.Lock()
+	defer s.lock.Unlock()
+	return *s.of(task)
+}
+
+// runTask runs task i and records how it ended: completed, failed, or
+// pending again when it had to stop early, which it then tells. Tasks paused,
+// canceled or resumed meanwhile keep their state. The task fetches with its
+// own Threads, or else with its share of the pool of r.
+func (r *runner) runTask(i int, task model.Task, tracker *archive.Tracker) bool {
+	if err := r.store.SetState(task, model.TaskState_RUNNING, nil); err != nil {
+		log.Println(err)
+	}
+	r.stats.start(task)
+	s := task.GetSocialImageTask()
+	var threads util.Limiter
+	if l := s.GetLimits(); l != nil && l.Threads > 0 {
+		log.Printf("Task %d: running with %d threads.\n", i, l.Threads)
+		threads = util.NewSemaphore(int(l.Threads))
+	} else {
+		weight := 1
+		if l != nil && l.Weight > 0 {
+			weight = int(l.Weight)
+		}
+		log.Printf("Task %d: running with weight %d.\n", i, weight)
+		member := r.pool.Join(weight)
+		defer member.Leave()
+		threads = member
+	}
+	var finished bool
+	var err error
+	switch {
+	case s.GetImageTask() != nil:
+		finished, err = r.crawlImages(task, threads)
+	case s.GetSitemapTask() != nil:
+		finished, err = r.crawlSitemap(task, threads)
+	case s.GetLinkTask() != nil:
+		finished, err = r.crawlLinks(task, threads)
+	default:
+		finished, err = r.crawlIds(task, tracker, threads)
+	}
+	state := model.TaskState_COMPLETED
+	if r.store.State(task) == model.TaskState_CANCELED {
+		// A task canceled while it ran stays canceled.
+		log.Printf("Task %d: %v.\n", i, model.TaskState_CANCELED)
+		return false
+	} else if err != nil {
+		state = model.TaskState_FAILED
+	} else if !finished {
+		if state = r.store.State(task); state != model.TaskState_RUNNING {
+			log.Printf("Task %d: %v.\n", i, state)
+			return false
+		}
+		state = model.TaskState_PENDING
+	}
+	if err := r.store.SetState(task, state, err); err != nil {
+		log.Println(err)
+	}
+	log.Printf("Task %d: %v.\n", i, state)
+	return state == model.TaskState_PENDING
+}
+
+// runner runs the pending and running tasks of a TaskStore in the order of
+// the task file, TaskConcurrency at a time, including the tasks submitted or
+// resumed while it runs.
+type runner struct {
+	store *config.TaskStore
+	pool  *util.Pool
+	conf  *config.Config
+	stats *taskStats
+	// client crawls the sites through the proxy of conf.
+	client *http.Client
+	// statsLock guards the stats files of the folders crawled.
+	statsLock sync.Mutex
+
+	lock    sync.Mutex
+	running map[model.Task]bool
+	// held are the tasks that stopped early, e.g. on low disk space. They
+	// are not run again until resumed.
+	held     map[model.Task]bool
+	trackers map[model.Task]*archive.Tracker
+	wake     chan bool
+
+	// resumed are the sites whose interrupted archives were finished.
+	resumeLock sync.Mutex
+	resumed    map[string]bool
+}
+
+func newRunner(store *config.TaskStore, pool *util.Pool, conf *config.Config) *runner {
+	return &runner{
+		store:    store,
+		pool:     pool,
+		conf:     conf,
+		stats:    newTaskStats(),
+		client:   newClient(conf),
+		running:  make(map[model.Task]bool),
+		held:     make(map[model.Task]bool),
+		trackers: make(map[model.Task]*archive.Tracker),
+		wake:     make(chan bool, 1),
+		resumed:  make(map[string]bool),
+	}
+}
+
+// Wake makes r look for tasks to start.
+func (r *runner) Wake() {
+	select {
+	case r.wake <- true:
+	default:
+	}
+}
+
+// Resume lets a task that stopped early run again.
+func (r *runner) Resume(task model.Task) {
+	r.lock.Lock()
+	delete(r.held, task)
+	r.lock.Unlock()
+	r.Wake()
+}
+
+// tracker returns the tracker archiving the Ids crawled by an IdProfileTask,
+// made the first time the task runs once the interrupted archives of its
+// site are finished. r.lock must not be held: archives are built meanwhile.
+func (r *runner) tracker(task model.Task) *archive.Tracker {
+	t := task.GetSocialImageTask().GetIdProfileTask()
+	if t == nil {
+		return nil
+	}
+	r.lock.Lock()
+	tracker, ok := r.trackers[task]
+	r.lock.Unlock()
+	if ok {
+		return tracker
+	}
+	c := r.conf.Get()
+	site := model.SiteName[task.GetType()]
+	basePath := dataDir(r.conf, site)
+	r.resumeLock.Lock()
+	if !r.resumed[site] {
+		if err := archive.Resume(c.ArchiveFolder, site, basePath); err != nil {
+			log.Println(err)
+		} else {
+			r.resumed[site] = true
+		}
+	}
+	r.resumeLock.Unlock()
+	tracker = archive.NewTracker(c.ArchiveFolder, site, basePath,
+		int(t.BeginId-1), int(t.EndId))
+	r.lock.Lock()
+	r.trackers[task] = tracker
+	r.lock.Unlock()
+	return tracker
+}
+
+// start starts the tasks to run next and returns how many run.
+func (r *runner) start() int {
+	n := int(r.conf.Get().TaskConcurrency)
+	r.lock.Lock()
+	defer r.lock.Unlock()
+	for i, task := range r.store.Tasks() {
+		if n > 0 && len(r.running) >= n {
+			break
+		}
+		if r.running[task] || r.held[task] || !r.store.State(task).Runnable() {
+			continue
+		}
+		r.running[task] = true
+		go func(i int, task model.Task) {
+			stoppedEarly := r.runTask(i, task, r.tracker(task))
+			r.lock.Lock()
+			delete(r.running, task)
+			if stoppedEarly {
+				r.held[task] = true
+			}
+			r.lock.Unlock()
+			r.Wake()
+		}(i, task)
+	}
+	return len(r.running)
+}
+
+// Run runs tasks until none is left to run, or for good when wait is set.
+func (r *runner) Run(wait bool) {
+	for r.start() > 0 || wait {
+		<-r.wake
+	}
+}
+
+// WaitArchives blocks until the ranges being archived are done.
+func (r *runner) WaitArchives() {
+	r.lock.Lock()
+	trackers := make([]*archive.Tracker, 0, len(r.trackers))
+	for _, tracker := range r.trackers {
+		trackers = append(trackers, tracker)
+	}
+	r.lock.Unlock()
+	for _, tracker := range trackers {
+		tracker.Wait()
+	}
+}
+
+// progress tells where task is. The store lock must be held.
+func progress(task model.Task) string {
+	s := task.GetSocialImageTask()
+	if t := s.GetIdProfileTask(); t != nil {
+		return fmt.Sprintf("Id %d of %d", t.BeginId, t.EndId)
+	}
+	if t := s.GetImageTask(); t != nil {
+		if len(t.UrlFile) > 0 {
+			return fmt.Sprintf("image %d", t.Next)
+		}
+		return fmt.Sprintf("image %d of %d", t.Next, len(t.Images))
+	}
+	if t := s.GetSitemapTask(); t != nil {
+		return fmt.Sprintf("sitemap %d, URL %d", t.Sitemap, t.Next)
+	}
+	if t := s.GetLinkTask(); t != nil {
+		return fmt.Sprintf("page %d", t.Next)
+	}
+	return ""
+}
+
+// controlServer serves model.ControlServer for the tasks of a runner.
+type controlServer struct {
+	r *runner
+}
+
+func (s *controlServer) status(i int, task model.Task) *model.TaskStatus {
+	status := &model.TaskStatus{Task: int32(i), Type: task.GetType()}
+	s.r.store.View(func() {
+		status.State = task.GetSocialImageTask().GetState()
+		status.Error = task.GetSocialImageTask().GetError()
+		status.Progress = progress(task)
+	})
+	return status
+}
+
+func (s *controlServer) task(i int32) (model.Task, error) {
+	tasks := s.r.store.Tasks()
+	if i < 0 || int(i) >= len(tasks) {
+		return nil, status.Errorf(codes.NotFound, "No task %d.", i)
+	}
+	return tasks[i], nil
+}
+
+func (s *controlServer) Submit(ctx context.Context, req *model.SubmitRequest) (*model.TaskStatus, error) {
+	if req.Task == nil {
+		return nil, status.Errorf(codes.InvalidArgument, "No task.")
+	}
+	task, err := model.UnpackScraperTask(req.Task)
+	if err != nil {
+		return nil, status.Errorf(codes.InvalidArgument, "%v", err)
+	}
+	task.GetSocialImageTask().SetState(model.TaskState_PENDING, nil)
+	if err := config.Validate(s.r.conf.Get(), []model.Task{task}, model.SiteName); err != nil {
+		return nil, status.Errorf(codes.InvalidArgument, "%v", err)
+	}
+	i, err := s.r.store.Add(task)
+	if err != nil {
+		return nil, err
+	}
+	log.Printf("Task %d: submitted.\n", i)
+	s.r.Wake()
+	return s.status(i, task), nil
+}
+
+func (s *controlServer) List(ctx context.Context, req *model.ListRequest) (*model.TaskList, error) {
+	list := &model.TaskList{}
+	for i, task := range s.r.store.Tasks() {
+		list.Tasks = append(list.Tasks, s.status(i, task))
+	}
+	return list, nil
+}
+
+func (s *controlServer) Pause(ctx context.Context, req *model.TaskRequest) (*model.TaskStatus, error) {
+	task, err := s.task(req.Task)
+	if err != nil {
+		return nil, err
+	}
+	if state := s.r.store.State(task); state.Finished() {
+		return nil, status.Errorf(codes.FailedPrecondition, "Task %d is %v.", req.Task, state)
+	}
+	if err := s.r.store.SetState(task, model.TaskState_PAUSED, nil); err != nil {
+		return nil, err
+	}
+	log.Printf("Task %d: paused.\n", req.Task)
+	return s.status(int(req.Task), task), nil
+}
+
+func (s *controlServer) Resume(ctx context.Context, req *model.TaskRequest) (*model.TaskStatus, error) {
+	task, err := s.task(req.Task)
+	if err != nil {
+		return nil, err
+	}
+	switch state := s.r.store.State(task); state {
+	case model.TaskState_COMPLETED, model.TaskState_CANCELED:
+		return nil, status.Errorf(codes.FailedPrecondition, "Task %d is %v.", req.Task, state)
+	case model.TaskState_PAUSED, model.TaskState_FAILED:
+		if err := s.r.store.SetState(task, model.TaskState_PENDING, nil); err != nil {
+			return nil, err
+		}
+	}
+	log.Printf("Task %d: resumed.\n", req.Task)
+	s.r.Resume(task)
+	return s.status(int(req.Task), task), nil
+}
+
+func (s *controlServer) Cancel(ctx context.Context, req *model.TaskRequest) (*model.TaskStatus, error) {
+	task, err := s.task(req.Task)
+	if err != nil {
+		return nil, err
+	}
+	if state := s.r.store.State(task); state.Finished() {
+		return nil, status.Errorf(codes.FailedPrecondition, "Task %d is %v.", req.Task, state)
+	}
+	if err := s.r.store.SetState(task, model.TaskState_CANCELED, nil); err != nil {
+		return nil, err
+	}
+	log.Printf("Task %d: canceled.\n", req.Task)
+	return s.status(int(req.Task), task), nil
+}
+
+func (s *controlServer) Stats(ctx context.Context, req *model.TaskRequest) (*model.TaskStats, error) {
+	task, err := s.task(req.Task)
+	if err != nil {
+		return nil, err
+	}
+	stats := s.r.stats.get(task)
+	stats.Task = req.Task
+	return &stats, nil
+}
+
+// logSummary logs the state of every task.
+func logSummary(tasks []model.Task) {
+	counts := make(map[model.TaskState]int)
+	for i, task := range tasks {
+		s := task.GetSocialImageTask()
+		counts[s.GetState()]++
+		line := fmt.Sprintf("Task %d (%s): %v", i, model.SiteName[task.GetType()], s.GetState())
+		if len(s.GetError()) > 0 {
+			line += ", " + s.GetError()
+		}
+		log.Println(line)
+	}
+	log.Printf("%d tasks: %d completed, %d failed, %d canceled, %d paused, %d pending.\n", len(tasks),
+		counts[model.TaskState_COMPLETED], counts[model.TaskState_FAILED], counts[model.TaskState_CANCELED],
+		counts[model.TaskState_PAUSED],
+		counts[model.TaskState_PENDING]+counts[model.TaskState_RUNNING])
+}
+
+// leaseRetry is how long a worker waits for the coordinator to be up or to
+// have a range to lease.
+const leaseRetry = 10 * time.Second
+
+// work crawls the Id ranges leased from the coordinator until it has none
+// left to lease.
+func (r *runner) work() {
+	c := r.conf.Get()
+	conn, err := grpc.Dial(c.Coordinator, grpc.WithInsecure())
+	if err != nil {
+		log.Println(err)
+		return
+	}
+	defer conn.Close()
+	client := model.NewCoordinatorClient(conn)
+	host, _ := os.Hostname()
+	worker := fmt.Sprintf("%s:%d", host, os.Getpid())
+	threads := r.pool.Join(1)
+	defer threads.Leave()
+	for !util.IsLowDiskSpace() {
+		l, err := client.Lease(context.Background(), &model.LeaseRequest{Worker: worker})
+		if err != nil {
+			log.Println(err)
+			time.Sleep(leaseRetry)
+			continue
+		}
+		if l.Id == 0 {
+			if l.Finished {
+				log.Println("The coordinator has nothing left to lease.")
+				return
+			}
+			time.Sleep(leaseRetry)
+			continue
+		}
+		r.crawlLease(client, worker, l, threads)
+	}
+}
+
+// crawlLease crawls the Ids of lease l of worker, ThreadNum at a time,
+// reporting its progress in heartbeats, and completes it. It gives up on the lease when
+// the coordinator lost it; another worker crawls the rest.
+func (r *runner) crawlLease(client model.CoordinatorClient, worker string, l *model.IdLease, threads util.Limiter) {
+	template, ok := model.ProfileTemplate[l.Type]
+	if !ok {
+		log.Printf("Lease %d: cannot crawl %v, leaving it to expire.\n", l.Id, l.Type)
+		return
+	}
+	log.Printf("Lease %d: crawling %v %d-%d.\n", l.Id, l.Type, l.BeginId, l.EndId)
+	c := r.conf.Get()
+	basePath := dataDir(r.conf, model.SiteName[l.Type])
+	tracker := archive.NewTracker(c.ArchiveFolder, model.SiteName[l.Type], basePath, int(l.BeginId), int(l.EndId))
+
+	// Every Id below the lowest one running, or else below next, is done.
+	var lock sync.Mutex
+	running := make(map[int64]bool)
+	next := l.BeginId
+	progress := func() int64 {
+		lock.Lock()
+		defer lock.Unlock()
+		p := next
+		for id := range running {
+			if id < p {
+				p = id
+			}
+		}
+		return p
+	}
+	var lost int32
+	stop := make(chan bool)
+	go func() {
+		every := time.Duration(l.LeaseSec) * time.Second / 3
+		if every < time.Second {
+			every = time.Second
+		}
+		ticker := time.NewTicker(every)
+		defer ticker.Stop()
+		for {
+			select {
+			case <-stop:
+				return
+			case <-ticker.C:
+			}
+			_, err := client.Heartbeat(context.Background(), &model.HeartbeatRequest{Lease: l.Id, Next: progress(), Worker: worker})
+			if status.Code(err) == codes.NotFound {
+				atomic.StoreInt32(&lost, 1)
+				log.Printf("Lease %d: lost, %v\n", l.Id, err)
+				return
+			}
+			if err != nil {
+				log.Println(err)
+			}
+		}
+	}()
+
+	var wg sync.WaitGroup
+	for id := l.BeginId; id < l.EndId; id++ {
+		if atomic.LoadInt32(&lost) != 0 || util.IsLowDiskSpace() {
+			break
+		}
+		threads.Acquire()
+		lock.Lock()
+		running[id] = true
+		next = id + 1
+		lock.Unlock()
+		tracker.Start(int(id))
+		wg.Add(1)
+		go func(id int64) {
+			defer func() {
+				tracker.Done(int(id))
+				lock.Lock()
+				delete(running, id)
+				lock.Unlock()
+				threads.Release()
+				wg.Done()
+			}()
+			r.crawlProfile(int(id), fmt.Sprintf(template, id), l.Type)
+		}(id)
+	}
+	wg.Wait()
+	close(stop)
+	tracker.Wait()
+	if p := progress(); p < l.EndId || atomic.LoadInt32(&lost) != 0 {
+		log.Printf("Lease %d: stopped at %d.\n", l.Id, p)
+		return
+	}
+	if _, err := client.Complete(context.Background(), &model.CompleteRequest{Lease: l.Id, Worker: worker}); err != nil {
+		log.Println(err)
+		return
+	}
+	log.Printf("Lease %d: completed.\n", l.Id)
+}
+
+// proxy sends requests through the first proxy of the config in use, or
+// else through the proxy of the environment, e.g. HTTP_PROXY.
+func proxy(conf *config.Config) func(req *http.Request) (*url.URL, error) {
+	return func(req *http.Request) (*url.URL, error) {
+		c := conf.Get()
+		if len(c.Proxies) == 0 {
+			return http.ProxyFromEnvironment(req)
+		}
+		p := c.Proxies[0]
+		if !strings.Contains(p, "://") {
+			p = "http://" + p
+		}
+		return url.Parse(p)
+	}
+}
+
+// newClient returns a client of its own to a scraper, with the settings of
+// http.DefaultTransport and the proxy of conf.
+func newClient(conf *config.Config) *http.Client {
+	return &http.Client{Transport: &http.Transport{
+		Proxy:                 proxy(conf),
+		DialContext:           (&net.Dialer{Timeout: 30 * time.Second, KeepAlive: 30 * time.Second}).DialContext,
+		MaxIdleConns:          100,
+		IdleConnTimeout:       90 * time.Second,
+		TLSHandshakeTimeout:   10 * time.Second,
+		ExpectContinueTimeout: time.Second,
+	}}
+}
+
+func modTime(file string) time.Time {
+	info, err := os.Stat(file)
+	if err != nil {
+		return time.Time{}
+	}
+	return info.ModTime()
+}
+
+// reloadConfig applies the changes of the config file that are safe while
+// crawling: ThreadNum, Proxies, ValidImgNum and how tasks are saved.
+func reloadConfig(conf *config.Config, pool *util.Pool, store *config.TaskStore) {
+	c, err := conf.Reload()
+	if err != nil {
+		log.Println("Keeping the running config:", err)
+		return
+	}
+	pool.Resize(int(c.ThreadNum))
+	if store != nil {
+		store.Configure(c)
+	}
+	log.Println("Active config:", c.String())
+}
+
 func main() {
 	log.SetFlags(log.Lshortfile | log.LstdFlags)
 	configFile := flag.String("config", "scraper.conf", "Config file.")
+	watchConfig := flag.Bool("watch_config", false, "Reload the config file when it changes, as on SIGHUP.")
 	// archiveBefore := flag.Bool("archive_before", false, "Archive previous range.")
+	config.RegisterFlags(flag.CommandLine)
 	flag.Parse()
 
-	config.ConfigFile = *configFile
-	c := config.GetConfig()
-	tasks := config.GetTasks()
-
-	if len(tasks) == 0 {
-		log.Fatal("No task to run.")
+	if args := flag.Args(); len(args) > 0 {
+		if len(args) != 2 || args[0] != "config" || args[1] != "print" {
+			log.Fatalf("Unknown command %q, only \"config print\" is supported.", strings.Join(args, " "))
+		}
+		if err := config.Print(os.Stdout, *configFile, flag.CommandLine); err != nil {
+			log.Fatal(err)
+		}
+		return
+	}
+	conf, store, err := config.Load(*configFile, flag.CommandLine, model.SiteName)
+	if err != nil {
+		log.Fatal(err)
+	}
+	c := conf.Get()
+	if err := config.MakeFolders(c); err != nil {
+		log.Fatal(err)
+	}
+	if len(c.Coordinator) > 0 {
+		// The coordinator owns the tasks.
+		store = nil
+	} else {
+		if err := store.LockFile(); err != nil {
+			log.Fatal(err)
+		}
+		if err := store.Migrate(); err != nil {
+			log.Fatal(err)
+		}
 	}
 
 	if len(c.Proxies) == 0 {
 		log.Println("No proxies set")
-	} else {
-		os.Setenv("HTTP_PROXY", c.Proxies[0])
-		os.Setenv("HTTPS_PROXY", c.Proxies[0])
 	}
+	log.Println("Active config:", c.String())
 
-	InitMaps()
 	// if *archiveBefore {
 	// 	log.Println("Archive previous range.")
-	// 	id := int(tasks[0].GetIdProfileTask().BeginId)
+	// 	id := int(tasks[0].GetSocialImageTask().GetIdProfileTask().BeginId)
 	// 	id = id - id%archive.ArchiveSize
 
 	// 	err := archive.Archive(id-archive.ArchiveSize, id, c.ArchiveFolder, c.DataFolder)
@@ -396,55 +1467,72 @@ func main() {
 	// 		log.Println("Archived previous package.")
 	// 	}
 	// }
-	chTask := make(chan int, c.ThreadNum)
-	for _, task := range tasks {
+	pool := util.NewPool(int(c.ThreadNum))
+	r := newRunner(store, pool, conf)
+	if len(c.Control) > 0 {
+		if store == nil {
+			log.Fatal("Workers of a coordinator cannot serve the Control API.")
+		}
+		lis, err := net.Listen("tcp", c.Control)
+		if err != nil {
+			log.Fatal(err)
+		}
+		s := grpc.NewServer()
+		model.RegisterControlServer(s, &controlServer{r: r})
 		go func() {
-			for id := task.GetIdProfileTask().BeginId - 1; id < task.GetIdProfileTask().EndId && !util.IsLowDiskSpace(); id++ {
-				chTask <- 1
-				taskId := int(id)
-				go func() {
-					defer func() {
-						<-chTask
-					}()
-					log.Println("Crawling Id: ", taskId)
-					url := fmt.Sprintf(ProfileTemplate[task.GetType()], taskId)
-					profile, err := crawl(int(taskId), url, task.GetType())
-					if err != nil {
-						log.Println(err)
-						return
-					}
-					if profile != nil && len(profile.ImageURLs) >= int(c.ValidImgNum) {
-						save(profile, task.GetType())
-					}
-				}()
-				if int(taskId+1)%archive.ArchiveSize == 0 {
-					err := archive.Archive(taskId+1-archive.ArchiveSize, taskId+1, c.ArchiveFolder, SiteName[task.GetType()], path.Join(c.DataFolder, SiteName[task.GetType()]))
-					if err != nil {
-						log.Println(err)
-					}
-				}
-				task.GetIdProfileTask().BeginId = int64(taskId)
-				err := config.SaveTasks()
-				if err != nil {
-					log.Println(err)
-				}
+			if err := s.Serve(lis); err != nil {
+				log.Fatal(err)
 			}
 		}()
+		log.Println("Serving the Control API on", c.Control)
 	}
+	done := make(chan bool)
+	go func() {
+		if store == nil {
+			r.work()
+		} else {
+			r.Run(len(c.Control) > 0)
+		}
+		close(done)
+	}()
 
 	// Handle exiting signals and process.
 	sigChan := make(chan os.Signal, 1)
 	signal.Notify(sigChan, syscall.SIGINT, syscall.SIGTERM)
+	hupChan := make(chan os.Signal, 1)
+	signal.Notify(hupChan, syscall.SIGHUP)
+	configModTime := modTime(*configFile)
 
 	for {
 		select {
+		case <-hupChan:
+			reloadConfig(conf, pool, store)
+		case <-done:
+			if store != nil {
+				if err := store.Close(); err != nil {
+					log.Println(err)
+				}
+				logSummary(store.Tasks())
+			}
+			return
 		case <-sigChan:
-			err := config.SaveTasks()
-			if err != nil {
-				log.Println(err)
+			if store != nil {
+				if err := store.Close(); err != nil {
+					log.Println(err)
+				}
 			}
+			r.WaitArchives()
 			return
 		default:
+			if t := modTime(*configFile); *watchConfig && t.After(configModTime) {
+				configModTime = t
+				reloadConfig(conf, pool, store)
+			}
+			if store != nil {
+				if err := store.SaveIfDue(); err != nil {
+					log.Println(err)
+				}
+			}
 			time.Sleep(time.Second)
 		}
 	}
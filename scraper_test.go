@@ -0,0 +1,395 @@
+package main
+
+import (
+	"bytes"
+	"github.com/charleswong/scraper/archive"
+	"github.com/charleswong/scraper/config"
+	"github.com/charleswong/scraper/lease"
+	"github.com/charleswong/scraper/model"
+	"github.com/charleswong/scraper/util"
+	"github.com/golang/protobuf/jsonpb"
+	"golang.org/x/net/context"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+	"io"
+	"io/ioutil"
+	"log"
+	"net"
+	"net/http"
+	"os"
+	"path"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+)
+
+// newTestConfig writes a config with its folders in dir and a task file
+// holding tasks, and reads them back.
+func newTestConfig(t *testing.T, dir string, settings string, tasks string) (*config.Config, *config.TaskStore) {
+	taskFile := path.Join(dir, "jiayuan.task")
+	if err := ioutil.WriteFile(taskFile, []byte(tasks), 0666); err != nil {
+		t.Fatal(err)
+	}
+	configFile := path.Join(dir, "scraper.conf")
+	conf := `{"TaskFile":"` + taskFile + `","DataFolder":"` + path.Join(dir, "deepavatar") +
+		`","ArchiveFolder":"` + path.Join(dir, "avatar_tars") + `","TmpFolder":"` + path.Join(dir, "deep_tmp") + `",` + settings + `}`
+	if err := ioutil.WriteFile(configFile, []byte(conf), 0666); err != nil {
+		t.Fatal(err)
+	}
+	c, store, err := config.Load(configFile, nil, model.SiteName)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return c, store
+}
+
+// pages serves empty profile pages in place of the sites, holding back the
+// Id in hold until release is closed.
+type pages struct {
+	hold    int
+	release chan bool
+
+	lock    sync.Mutex
+	crawled map[int]bool
+}
+
+func (p *pages) RoundTrip(req *http.Request) (*http.Response, error) {
+	id, _ := strconv.Atoi(filepath.Base(req.URL.Path))
+	if id == p.hold {
+		<-p.release
+	}
+	p.lock.Lock()
+	p.crawled[id] = true
+	p.lock.Unlock()
+	return &http.Response{
+		StatusCode: http.StatusOK,
+		Body:       ioutil.NopCloser(bytes.NewBufferString("<html></html>")),
+		Request:    req,
+	}, nil
+}
+
+func servePages(r *runner, hold int) *pages {
+	p := &pages{hold: hold, release: make(chan bool), crawled: make(map[int]bool)}
+	r.client.Transport = p
+	return p
+}
+
+// logWatch passes the log on to w and closes seen once a line holds text.
+type logWatch struct {
+	w    io.Writer
+	text string
+	seen chan bool
+	once sync.Once
+}
+
+func watchLog(text string) *logWatch {
+	l := &logWatch{w: os.Stderr, text: text, seen: make(chan bool)}
+	log.SetOutput(l)
+	return l
+}
+
+func (l *logWatch) Write(p []byte) (int, error) {
+	if strings.Contains(string(p), l.text) {
+		l.once.Do(func() { close(l.seen) })
+	}
+	return l.w.Write(p)
+}
+
+// testCoordinator reports the calls of the workers to a lease.Coordinator,
+// and loses every lease when lost is set.
+type testCoordinator struct {
+	*lease.Coordinator
+	lost       bool
+	heartbeats chan int64
+	// completed is called before a lease is completed.
+	completed func(req *model.CompleteRequest)
+}
+
+func (c *testCoordinator) Heartbeat(ctx context.Context, req *model.HeartbeatRequest) (*model.HeartbeatReply, error) {
+	select {
+	case c.heartbeats <- req.Next:
+	default:
+	}
+	if c.lost {
+		return nil, status.Errorf(codes.NotFound, "Lease %d expired.", req.Lease)
+	}
+	return c.Coordinator.Heartbeat(ctx, req)
+}
+
+func (c *testCoordinator) Complete(ctx context.Context, req *model.CompleteRequest) (*model.CompleteReply, error) {
+	c.completed(req)
+	return c.Coordinator.Complete(ctx, req)
+}
+
+// serveCoordinator serves c on a loopback port and returns a client of it.
+func serveCoordinator(t *testing.T, c *testCoordinator) (model.CoordinatorClient, func()) {
+	lis, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	s := grpc.NewServer()
+	model.RegisterCoordinatorServer(s, c)
+	go s.Serve(lis)
+	conn, err := grpc.Dial(lis.Addr().String(), grpc.WithInsecure())
+	if err != nil {
+		t.Fatal(err)
+	}
+	return model.NewCoordinatorClient(conn), func() {
+		conn.Close()
+		s.Stop()
+	}
+}
+
+const leaseTask = `{"Tasks":[{"JiayuanTask":{"SocialImageTask":{"IdProfileTask":{"BeginId":"1","EndId":"10000"}}}}]}`
+
+func TestCrawlLeaseReportsProgressAndCompletes(t *testing.T) {
+	dir, err := ioutil.TempDir("", "scraper")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	conf, store := newTestConfig(t, dir, `"LeaseSec":3,"ValidImgNum":1`, leaseTask)
+	r := newRunner(nil, util.NewPool(1), conf)
+	p := servePages(r, 5000)
+
+	archived := false
+	c := &testCoordinator{
+		Coordinator: lease.NewCoordinator(store, conf),
+		heartbeats:  make(chan int64, 10),
+		completed: func(req *model.CompleteRequest) {
+			// The range must be archived before the lease completes.
+			state, err := archive.ReadState(conf.Get().ArchiveFolder, "Jiayuan")
+			archived = err == nil && state.Find(0) != nil && state.Find(0).State == archive.RangeCleaned
+		},
+	}
+	coordinator, stop := serveCoordinator(t, c)
+	defer stop()
+	l, err := coordinator.Lease(context.Background(), &model.LeaseRequest{Worker: "test"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if l.BeginId != 0 || l.EndId != 10000 {
+		t.Fatalf("Leased %v, want 0-10000", l)
+	}
+
+	done := make(chan bool)
+	go func() {
+		r.crawlLease(coordinator, "test", l, util.NewSemaphore(1))
+		close(done)
+	}()
+	// Id 5000 is the lowest one not crawled while it is held back.
+	timeout := time.After(10 * time.Second)
+	for next := int64(0); next != 5000; {
+		select {
+		case next = <-c.heartbeats:
+		case <-timeout:
+			t.Fatal("No heartbeat reported Id 5000")
+		}
+	}
+	if leased := store.Tasks()[0].GetSocialImageTask().GetIdProfileTask().Leased; len(leased) != 1 || leased[0].BeginId != 5000 {
+		t.Fatalf("Coordinator has leases %v, want 5000-10000", leased)
+	}
+	close(p.release)
+	<-done
+
+	if len(p.crawled) != 10000 {
+		t.Fatalf("Crawled %d Ids, want 10000", len(p.crawled))
+	}
+	if !archived {
+		t.Fatal("Lease completed before its range was archived")
+	}
+	if state := store.State(store.Tasks()[0]); state != model.TaskState_COMPLETED {
+		t.Fatalf("Task is %v after its only lease completed", state)
+	}
+}
+
+func TestCrawlLeaseStopsWhenLost(t *testing.T) {
+	dir, err := ioutil.TempDir("", "scraper")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	conf, store := newTestConfig(t, dir, `"LeaseSec":3,"ValidImgNum":1`, leaseTask)
+	r := newRunner(nil, util.NewPool(1), conf)
+	p := servePages(r, 100)
+	lost := watchLog("lost")
+	defer log.SetOutput(os.Stderr)
+
+	completed := false
+	c := &testCoordinator{
+		Coordinator: lease.NewCoordinator(store, conf),
+		lost:        true,
+		heartbeats:  make(chan int64, 10),
+		completed:   func(*model.CompleteRequest) { completed = true },
+	}
+	coordinator, stop := serveCoordinator(t, c)
+	defer stop()
+	l, err := coordinator.Lease(context.Background(), &model.LeaseRequest{Worker: "test"})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	done := make(chan bool)
+	go func() {
+		r.crawlLease(coordinator, "test", l, util.NewSemaphore(1))
+		close(done)
+	}()
+	select {
+	case <-lost.seen:
+	case <-time.After(10 * time.Second):
+		t.Fatal("The lease was not lost")
+	}
+	close(p.release)
+	<-done
+
+	// Id 101 was waiting for the thread of Id 100, then the worker stopped.
+	if len(p.crawled) != 102 {
+		t.Fatalf("Crawled %d Ids, want 102 up to the lost lease", len(p.crawled))
+	}
+	if completed {
+		t.Fatal("Completed a lost lease")
+	}
+}
+
+// newTestControl serves the Control API of a runner that is not running, over
+// the tasks of leaseTask.
+func newTestControl(t *testing.T, dir string) (*controlServer, *config.TaskStore) {
+	conf, store := newTestConfig(t, dir, `"ValidImgNum":1`, leaseTask)
+	return &controlServer{r: newRunner(store, util.NewPool(1), conf)}, store
+}
+
+func submitTask(s *controlServer, task string) (*model.TaskStatus, error) {
+	scraperTask := &model.ScraperTask{}
+	if err := jsonpb.UnmarshalString(task, scraperTask); err != nil {
+		return nil, err
+	}
+	return s.Submit(context.Background(), &model.SubmitRequest{Task: scraperTask})
+}
+
+func TestControlSubmitAndList(t *testing.T) {
+	dir, err := ioutil.TempDir("", "scraper")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	s, store := newTestControl(t, dir)
+
+	st, err := submitTask(s, `{"JiayuanTask":{"SocialImageTask":{"State":"FAILED","IdProfileTask":{"BeginId":"1","EndId":"100"}}}}`)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if st.Task != 1 || st.State != model.TaskState_PENDING {
+		t.Fatalf("Submitted task %d %v, want task 1 PENDING", st.Task, st.State)
+	}
+	if _, err := submitTask(s, `{"JiayuanTask":{"SocialImageTask":{"IdProfileTask":{"BeginId":"100","EndId":"100"}}}}`); status.Code(err) != codes.InvalidArgument {
+		t.Fatalf("Submitting an empty range returned %v, want InvalidArgument", err)
+	}
+	if _, err := s.Submit(context.Background(), &model.SubmitRequest{}); status.Code(err) != codes.InvalidArgument {
+		t.Fatalf("Submitting no task returned %v, want InvalidArgument", err)
+	}
+
+	list, err := s.List(context.Background(), &model.ListRequest{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(list.Tasks) != 2 || list.Tasks[1].Type != model.TaskType_JIAYUAN || list.Tasks[1].Progress != "Id 1 of 100" {
+		t.Fatalf("Listed %v, want the task file and the submitted task", list.Tasks)
+	}
+	if len(store.Tasks()) != 2 {
+		t.Fatalf("Store has %d tasks, want 2", len(store.Tasks()))
+	}
+}
+
+func TestControlTaskStates(t *testing.T) {
+	dir, err := ioutil.TempDir("", "scraper")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	s, store := newTestControl(t, dir)
+	ctx := context.Background()
+	calls := map[string]func(context.Context, *model.TaskRequest) (*model.TaskStatus, error){
+		"Pause": s.Pause, "Resume": s.Resume, "Cancel": s.Cancel,
+	}
+
+	for name, call := range calls {
+		for _, i := range []int32{-1, 1} {
+			if _, err := call(ctx, &model.TaskRequest{Task: i}); status.Code(err) != codes.NotFound {
+				t.Fatalf("%s of task %d returned %v, want NotFound", name, i, err)
+			}
+		}
+	}
+
+	steps := []struct {
+		name string
+		want model.TaskState
+	}{
+		{"Pause", model.TaskState_PAUSED},
+		{"Resume", model.TaskState_PENDING},
+		{"Cancel", model.TaskState_CANCELED},
+	}
+	for _, step := range steps {
+		st, err := calls[step.name](ctx, &model.TaskRequest{Task: 0})
+		if err != nil {
+			t.Fatal(err)
+		}
+		if st.State != step.want || store.State(store.Tasks()[0]) != step.want {
+			t.Fatalf("%s left the task %v, want %v", step.name, st.State, step.want)
+		}
+	}
+	for name, call := range calls {
+		if _, err := call(ctx, &model.TaskRequest{Task: 0}); status.Code(err) != codes.FailedPrecondition {
+			t.Fatalf("%s of a canceled task returned %v, want FailedPrecondition", name, err)
+		}
+	}
+
+	if err := store.SetState(store.Tasks()[0], model.TaskState_COMPLETED, nil); err != nil {
+		t.Fatal(err)
+	}
+	for name, call := range calls {
+		if _, err := call(ctx, &model.TaskRequest{Task: 0}); status.Code(err) != codes.FailedPrecondition {
+			t.Fatalf("%s of a completed task returned %v, want FailedPrecondition", name, err)
+		}
+	}
+
+	if err := store.SetState(store.Tasks()[0], model.TaskState_FAILED, io.EOF); err != nil {
+		t.Fatal(err)
+	}
+	st, err := s.Resume(ctx, &model.TaskRequest{Task: 0})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if st.State != model.TaskState_PENDING || st.Error != "" {
+		t.Fatalf("Resumed a failed task to %v %q, want PENDING without error", st.State, st.Error)
+	}
+}
+
+func TestRunnerReusesTrackers(t *testing.T) {
+	dir, err := ioutil.TempDir("", "scraper")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	conf, store := newTestConfig(t, dir, `"ValidImgNum":1`, leaseTask)
+	r := newRunner(store, util.NewPool(1), conf)
+
+	task := store.Tasks()[0]
+	tracker := r.tracker(task)
+	if tracker == nil || r.tracker(task) != tracker {
+		t.Fatal("A task resumed got a new tracker")
+	}
+	if !r.resumed["Jiayuan"] {
+		t.Fatal("The archives of the site were not resumed")
+	}
+	progress, err := archive.ReadProgress(conf.Get().ArchiveFolder, "Jiayuan")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(progress.Tasks) != 1 || progress.Tasks[0].Site != "Jiayuan" || progress.Tasks[0].EndId != 10000 {
+		t.Fatalf("Progress %+v, want the task of Jiayuan ending at 10000", progress.Tasks)
+	}
+}
@@ -0,0 +1,151 @@
+package main
+
+import (
+	"flag"
+	"fmt"
+	"github.com/charleswong/scraper/config"
+	"github.com/charleswong/scraper/model"
+	"github.com/golang/protobuf/jsonpb"
+	"golang.org/x/net/context"
+	"google.golang.org/grpc"
+	"io"
+	"log"
+	"os"
+	"strconv"
+	"time"
+)
+
+const usage = `Usage: scraperctl [flags] command
+
+Commands:
+  list            List the tasks with their progress.
+  submit FILE     Submit the ScraperTask in FILE, as in a task file, e.g.
+                  {"JiayuanTask":{"SocialImageTask":{"IdProfileTask":{"BeginId":"1","EndId":"100"}}}}
+                  FILE - reads it from stdin.
+  pause TASK      Pause task TASK until resumed.
+  resume TASK     Run paused or failed task TASK again.
+  cancel TASK     Stop task TASK for good.
+  stats TASK      Show what task TASK crawled since the scraper started.
+
+Flags:
+`
+
+func printStatus(s *model.TaskStatus) {
+	line := fmt.Sprintf("%3d %-8v %-9v %s", s.Task, s.Type, s.State, s.Progress)
+	if len(s.Error) > 0 {
+		line += " (" + s.Error + ")"
+	}
+	fmt.Println(line)
+}
+
+func readTask(file string) (*model.ScraperTask, error) {
+	var r io.Reader = os.Stdin
+	if file != "-" {
+		f, err := os.Open(file)
+		if err != nil {
+			return nil, err
+		}
+		defer f.Close()
+		r = f
+	}
+	task := &model.ScraperTask{}
+	err := jsonpb.Unmarshal(r, task)
+	return task, err
+}
+
+// The client talks to the Control API of the scraper run with the config,
+// at its Control address.
+func main() {
+	log.SetFlags(0)
+	configFile := flag.String("config", "scraper.conf", "Config file of the scraper.")
+	config.RegisterFlags(flag.CommandLine)
+	flag.Usage = func() {
+		fmt.Fprint(os.Stderr, usage)
+		flag.PrintDefaults()
+	}
+	flag.Parse()
+	args := flag.Args()
+	if len(args) == 0 {
+		flag.Usage()
+		os.Exit(2)
+	}
+
+	conf, err := config.NewConfig(*configFile, flag.CommandLine)
+	if err != nil {
+		log.Fatal(err)
+	}
+	addr := conf.Get().Control
+	if len(addr) == 0 {
+		log.Fatal("No Control address, set it in the config or with -control.")
+	}
+	conn, err := grpc.Dial(addr, grpc.WithInsecure())
+	if err != nil {
+		log.Fatal(err)
+	}
+	defer conn.Close()
+	client := model.NewControlClient(conn)
+	ctx, cancel := context.WithTimeout(context.Background(), 30*time.Second)
+	defer cancel()
+
+	command := args[0]
+	if command == "list" {
+		list, err := client.List(ctx, &model.ListRequest{})
+		if err != nil {
+			log.Fatal(err)
+		}
+		for _, s := range list.Tasks {
+			printStatus(s)
+		}
+		return
+	}
+	if len(args) != 2 {
+		flag.Usage()
+		os.Exit(2)
+	}
+	if command == "submit" {
+		task, err := readTask(args[1])
+		if err != nil {
+			log.Fatal(err)
+		}
+		status, err := client.Submit(ctx, &model.SubmitRequest{Task: task})
+		if err != nil {
+			log.Fatal(err)
+		}
+		printStatus(status)
+		return
+	}
+	i, err := strconv.Atoi(args[1])
+	if err != nil {
+		log.Fatalf("Invalid task %q.", args[1])
+	}
+	req := &model.TaskRequest{Task: int32(i)}
+	var status *model.TaskStatus
+	switch command {
+	case "pause":
+		status, err = client.Pause(ctx, req)
+	case "resume":
+		status, err = client.Resume(ctx, req)
+	case "cancel":
+		status, err = client.Cancel(ctx, req)
+	case "stats":
+		stats, err := client.Stats(ctx, req)
+		if err != nil {
+			log.Fatal(err)
+		}
+		fmt.Printf("Task %d: %d crawled, %d saved, %d failed\n", stats.Task, stats.Crawled, stats.Saved, stats.Failed)
+		if stats.StartedTs > 0 {
+			fmt.Println("Started", time.Unix(stats.StartedTs, 0))
+		}
+		if stats.UpdatedTs > 0 {
+			fmt.Println("Updated", time.Unix(stats.UpdatedTs, 0))
+		}
+		return
+	default:
+		flag.Usage()
+		os.Exit(2)
+	}
+	if err != nil {
+		log.Fatal(err)
+	}
+	printStatus(status)
+}
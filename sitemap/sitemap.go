@@ -0,0 +1,128 @@
+package sitemap
+
+import (
+	"bytes"
+	"compress/gzip"
+	"encoding/xml"
+	"fmt"
+	"io/ioutil"
+	"log"
+	"strings"
+)
+
+// Sitemap is a sitemap, with the URLs of pages, or a sitemap index, with the
+// URLs of sitemaps.
+type Sitemap struct {
+	Urls     []string
+	Sitemaps []string
+}
+
+// IsIndex tells whether s is a sitemap index.
+func (s *Sitemap) IsIndex() bool {
+	return s.Sitemaps != nil
+}
+
+type loc struct {
+	Loc string `xml:"loc"`
+}
+
+type document struct {
+	XMLName  xml.Name
+	Urls     []loc `xml:"url"`
+	Sitemaps []loc `xml:"sitemap"`
+}
+
+// Parse reads a sitemap or a sitemap index, gunzipping it first when it is
+// gzipped.
+func Parse(data []byte) (*Sitemap, error) {
+	if len(data) > 2 && data[0] == 0x1f && data[1] == 0x8b {
+		r, err := gzip.NewReader(bytes.NewReader(data))
+		if err != nil {
+			return nil, err
+		}
+		data, err = ioutil.ReadAll(r)
+		if err != nil {
+			return nil, err
+		}
+	}
+	doc := &document{}
+	err := xml.Unmarshal(data, doc)
+	if err != nil {
+		return nil, err
+	}
+	s := &Sitemap{}
+	switch doc.XMLName.Local {
+	case "urlset":
+		for _, u := range doc.Urls {
+			s.Urls = append(s.Urls, strings.TrimSpace(u.Loc))
+		}
+	case "sitemapindex":
+		s.Sitemaps = make([]string, 0, len(doc.Sitemaps))
+		for _, u := range doc.Sitemaps {
+			s.Sitemaps = append(s.Sitemaps, strings.TrimSpace(u.Loc))
+		}
+	default:
+		return nil, fmt.Errorf("Not a sitemap: <%s>", doc.XMLName.Local)
+	}
+	return s, nil
+}
+
+// Walk calls f with the page URLs of the sitemap or sitemap index at url and
+// their position: the index of their sitemap in the index, 0 without index,
+// and their index in that sitemap. It starts at position (sitemap, next)
+// and stops when f returns false. get fetches a URL. A sitemap of the index
+// that cannot be read is logged and skipped.
+func Walk(url string, get func(string) ([]byte, error), sitemap, next int, f func(sitemap, next int, loc string) bool) error {
+	data, err := get(url)
+	if err != nil {
+		return err
+	}
+	s, err := Parse(data)
+	if err != nil {
+		return fmt.Errorf("%s: %v", url, err)
+	}
+	if !s.IsIndex() {
+		if sitemap > 0 {
+			return nil
+		}
+		walkUrls(s, next, func(i int, loc string) bool {
+			return f(0, i, loc)
+		})
+		return nil
+	}
+
+	for i := sitemap; i < len(s.Sitemaps); i++ {
+		data, err := get(s.Sitemaps[i])
+		if err != nil {
+			log.Println(err)
+			continue
+		}
+		child, err := Parse(data)
+		if err == nil && child.IsIndex() {
+			err = fmt.Errorf("Nested sitemap index")
+		}
+		if err != nil {
+			log.Printf("Skipping sitemap %s: %v\n", s.Sitemaps[i], err)
+			continue
+		}
+		start := 0
+		if i == sitemap {
+			start = next
+		}
+		if !walkUrls(child, start, func(j int, loc string) bool {
+			return f(i, j, loc)
+		}) {
+			return nil
+		}
+	}
+	return nil
+}
+
+func walkUrls(s *Sitemap, start int, f func(i int, loc string) bool) bool {
+	for i := start; i < len(s.Urls); i++ {
+		if !f(i, s.Urls[i]) {
+			return false
+		}
+	}
+	return true
+}
@@ -0,0 +1,70 @@
+package sitemap
+
+import (
+	"bytes"
+	"compress/gzip"
+	"fmt"
+	"reflect"
+	"testing"
+)
+
+func urlset(urls ...string) []byte {
+	b := &bytes.Buffer{}
+	b.WriteString(`<?xml version="1.0" encoding="UTF-8"?><urlset xmlns="http://www.sitemaps.org/schemas/sitemap/0.9">`)
+	for _, u := range urls {
+		fmt.Fprintf(b, "<url><loc>\n  %s\n</loc><lastmod>2016-01-01</lastmod></url>", u)
+	}
+	b.WriteString("</urlset>")
+	return b.Bytes()
+}
+
+func gzipped(data []byte) []byte {
+	b := &bytes.Buffer{}
+	w := gzip.NewWriter(b)
+	w.Write(data)
+	w.Close()
+	return b.Bytes()
+}
+
+func TestWalkResumesInIndex(t *testing.T) {
+	files := map[string][]byte{
+		"http://a.com/sitemap.xml": []byte(`<sitemapindex xmlns="http://www.sitemaps.org/schemas/sitemap/0.9">` +
+			`<sitemap><loc>http://a.com/1.xml.gz</loc></sitemap>` +
+			`<sitemap><loc>http://a.com/missing.xml</loc></sitemap>` +
+			`<sitemap><loc>http://a.com/3.xml</loc></sitemap></sitemapindex>`),
+		"http://a.com/1.xml.gz": gzipped(urlset("http://a.com/1", "http://a.com/2", "http://a.com/3")),
+		"http://a.com/3.xml":    urlset("http://a.com/4", "http://a.com/5"),
+	}
+	get := func(url string) ([]byte, error) {
+		if data, ok := files[url]; ok {
+			return data, nil
+		}
+		return nil, fmt.Errorf("Not found: %s", url)
+	}
+
+	var visited []string
+	err := Walk("http://a.com/sitemap.xml", get, 0, 1, func(sitemap, next int, loc string) bool {
+		visited = append(visited, fmt.Sprintf("%d/%d %s", sitemap, next, loc))
+		return loc != "http://a.com/4"
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := []string{"0/1 http://a.com/2", "0/2 http://a.com/3", "2/0 http://a.com/4"}
+	if !reflect.DeepEqual(visited, want) {
+		t.Fatalf("Visited %v, want %v", visited, want)
+	}
+
+	visited = nil
+	err = Walk("http://a.com/3.xml", get, 0, 1, func(sitemap, next int, loc string) bool {
+		visited = append(visited, fmt.Sprintf("%d/%d %s", sitemap, next, loc))
+		return true
+	})
+	if err != nil || !reflect.DeepEqual(visited, []string{"0/1 http://a.com/5"}) {
+		t.Fatalf("Visited %v, %v", visited, err)
+	}
+
+	if _, err := Parse([]byte("<html></html>")); err == nil {
+		t.Fatal("Parsed a page as a sitemap")
+	}
+}
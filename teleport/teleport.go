@@ -1,290 +1,578 @@
 package main
 
 import (
-	"archive/tar"
-	"compress/gzip"
 	"encoding/json"
 	"errors"
 	"flag"
 	"fmt"
-	// "golang.org/x/crypto/ssh"
-	"io"
+	"github.com/charleswong/scraper/archive"
+	"github.com/charleswong/scraper/config"
+	"github.com/charleswong/scraper/model"
+	"github.com/charleswong/scraper/transfer"
+	"github.com/charleswong/scraper/util"
 	"io/ioutil"
 	"log"
-	"math"
+	"net/http"
 	"os"
+	"os/signal"
 	"path"
-	"path/filepath"
 	"strconv"
-	"strings"
+	"sync"
 	"syscall"
+	"time"
 )
 
-var (
-	FreeDiskThreshold = 1024 * 1024 * 1024
-)
+type TeleportStatus struct {
+	RemoteServer string
 
-func GetFreeDisk() int {
-	var stat syscall.Statfs_t
-	wd, err := os.Getwd()
-	if err != nil {
-		log.Println(err)
-		return 0
-	}
-	syscall.Statfs(wd, &stat)
-	// Available blocks * size per block = available space in bytes
-	return int(stat.Bavail * uint64(stat.Bsize))
+	// Target receives the archives of all sites. They are only kept in
+	// Destination when it is not set.
+	Target *transfer.Config
+	// LocalRetention is how long a verified archive is kept in Destination,
+	// e.g. "72h". It is deleted right away when empty.
+	LocalRetention string
+
+	// ScraperConfig, when set, adds a site for every task of the scraper
+	// that is not in Sites yet, with its data under DataFolder/<site> and
+	// its archives under ArchiveFolder/<site>.
+	ScraperConfig string
+
+	Sites []*SiteStatus
+
+	// Single site status files before Sites. readStatus moves them into
+	// Sites.
+	LastEndId   int            `json:",omitempty"`
+	StopId      int            `json:",omitempty"`
+	Destination string         `json:",omitempty"`
+	BasePath    string         `json:",omitempty"`
+	Site        string         `json:",omitempty"`
+	Archives    []*ArchiveInfo `json:",omitempty"`
 }
 
-func IsLowDiskSpace() bool {
-	return GetFreeDisk() < FreeDiskThreshold
+// SiteStatus is the progress of the ranges of one site.
+type SiteStatus struct {
+	// Site names the archives on the transfer target.
+	Site     string
+	BasePath string
+	// Destination is the ArchiveFolder/<site> of the scraper, which holds
+	// its progress and the archives of the site.
+	Destination string
+	// Ids below LastEndId are archived.
+	LastEndId int
+	// StopId, when set, is where archiving ends.
+	StopId int
+	// Archives not deleted from Destination yet.
+	Archives []*ArchiveInfo
 }
 
-func checkerror(err error) {
-	if err != nil {
-		fmt.Println(err)
-		os.Exit(1)
+const (
+	// The archive is verified in Destination; its loose files still exist.
+	ArchiveBuilt = "built"
+	// The archive was uploaded to the target.
+	ArchiveUploaded = "uploaded"
+	// The target has a copy with the checksum of the archive.
+	ArchiveVerified = "verified"
+	// The archive was deleted from Destination after LocalRetention, with
+	// its loose files.
+	ArchiveDeleted = "deleted"
+)
+
+type ArchiveInfo struct {
+	File       string
+	StartId    int
+	EndId      int
+	Files      int
+	State      string
+	Checksum   string
+	VerifiedTs int64
+}
+
+// Meta describes the archive to targets that store metadata.
+func (a *ArchiveInfo) Meta(site string) map[string]string {
+	return map[string]string{
+		"Site":    site,
+		"StartId": strconv.Itoa(a.StartId),
+		"EndId":   strconv.Itoa(a.EndId - 1),
+		"Files":   strconv.Itoa(a.Files),
 	}
 }
 
 var (
-	IdStep = 1000
+	statusPath = "./teleport.status"
 )
 
-const privateKey = `content of id_rsa`
-
-// func teleportTar(desFile string, remoteServer string) error {
-// 	signer, _ := ssh.ParsePrivateKey([]byte(privateKey))
-// 	clientConfig := &ssh.ClientConfig{
-// 		User: "jedy",
-// 		Auth: []ssh.AuthMethod{
-// 			ssh.PublicKeys(signer),
-// 		},
-// 	}
-// 	client, err := ssh.Dial("tcp", "127.0.0.1:22", clientConfig)
-// 	if err != nil {
-// 		panic("Failed to dial: " + err.Error())
-// 	}
-// 	session, err := client.NewSession()
-// 	if err != nil {
-// 		panic("Failed to create session: " + err.Error())
-// 	}
-// 	defer session.Close()
-// 	go func() {
-// 		w, _ := session.StdinPipe()
-// 		defer w.Close()
-// 		content := "123456789\n"
-// 		fmt.Fprintln(w, "D0755", 0, "testdir") // mkdir
-// 		fmt.Fprintln(w, "C0644", len(content), "testfile1")
-// 		fmt.Fprint(w, content)
-// 		fmt.Fprint(w, "\x00") // transfer end with \x00
-// 		fmt.Fprintln(w, "C0644", len(content), "testfile2")
-// 		fmt.Fprint(w, content)
-// 		fmt.Fprint(w, "\x00")
-// 	}()
-// 	if err := session.Run("/usr/bin/scp -tr ./"); err != nil {
-// 		panic("Failed to run: " + err.Error())
-// 	}
-// }
-
-func deleteRange(startId, endId int, basePath string) error {
-	for i := startId; i < endId; i += IdStep {
-		pathes := []string{
-			basePath,
-			strconv.Itoa(i / 1000000),
-			strconv.Itoa(i / 1000 % 1000),
-		}
-		p := path.Join(pathes...)
+func readStatus() (*TeleportStatus, error) {
+	bytes, err := ioutil.ReadFile(statusPath)
+	if err != nil {
+		log.Println(err)
+		return nil, err
+	}
+	s := &TeleportStatus{}
+	err = json.Unmarshal(bytes, s)
+	if err != nil {
+		log.Println(err)
+		return nil, err
+	}
+	if len(s.BasePath) > 0 {
+		s.Sites = append(s.Sites, &SiteStatus{
+			Site:        s.Site,
+			BasePath:    s.BasePath,
+			Destination: s.Destination,
+			LastEndId:   s.LastEndId,
+			StopId:      s.StopId,
+			Archives:    s.Archives,
+		})
+		s.LastEndId, s.StopId, s.Destination, s.BasePath, s.Site, s.Archives = 0, 0, "", "", "", nil
+	}
+	return s, nil
+}
 
-		err := os.RemoveAll(p)
+// addScraperSites adds the sites of the scraper tasks missing from
+// status.Sites. A new site starts from its first archived range, or else
+// from where its tasks started.
+func addScraperSites(status *TeleportStatus) error {
+	if len(status.ScraperConfig) == 0 {
+		return nil
+	}
+	conf, err := config.NewConfig(status.ScraperConfig, nil)
+	if err != nil {
+		return err
+	}
+	c := conf.Get()
+	store, err := config.NewTaskStore(c.TaskFile)
+	if err != nil {
+		return err
+	}
+	for _, task := range store.Tasks() {
+		name, ok := model.SiteName[task.GetType()]
+		found := !ok
+		for _, s := range status.Sites {
+			if s.Site == name {
+				found = true
+			}
+		}
+		if found {
+			continue
+		}
+		site := &SiteStatus{
+			Site:        name,
+			BasePath:    path.Join(c.DataFolder, name),
+			Destination: path.Join(c.ArchiveFolder, name),
+		}
+		site.LastEndId, err = firstRange(site)
 		if err != nil {
 			return err
 		}
+		status.Sites = append(status.Sites, site)
+		log.Printf("Teleporting site %s from Id %d.\n", name, site.LastEndId)
 	}
-	log.Printf("Deleted files of Id from %d to %d.\n", startId, endId-1)
 	return nil
 }
 
-func archiveRange(startId, endId int, desFile string, basePath string) error {
-	os.Remove(desFile)
-	tarfile, err := os.Create(desFile)
-	checkerror(err)
-
-	defer tarfile.Close()
-	var fileWriter io.WriteCloser = tarfile
+func siteFolders(site *SiteStatus) (string, string) {
+	dest := path.Clean(site.Destination)
+	return path.Dir(dest), path.Base(dest)
+}
 
-	if strings.HasSuffix(desFile, ".gz") {
-		fileWriter = gzip.NewWriter(tarfile) // add a gzip filter
-		defer fileWriter.Close()             // if user add .gz in the destination filename
+func firstRange(site *SiteStatus) (int, error) {
+	desFolder, subDesFolder := siteFolders(site)
+	state, err := archive.ReadState(desFolder, subDesFolder)
+	if err != nil {
+		return 0, err
+	}
+	if len(state.Ranges) > 0 {
+		return state.Ranges[0].StartId, nil
+	}
+	progress, err := archive.ReadProgress(desFolder, subDesFolder)
+	if err != nil {
+		return 0, err
+	}
+	id := progress.FirstId()
+	if id < 0 {
+		return 0, nil
 	}
+	return id - id%archive.ArchiveSize, nil
+}
 
-	tarfileWriter := tar.NewWriter(fileWriter)
-	defer tarfileWriter.Close()
+func saveStatus(s *TeleportStatus) error {
+	bytes, err := json.Marshal(s)
+	if err != nil {
+		log.Println(err)
+		return err
+	}
+	err = util.WriteFileAtomic(statusPath, bytes, 0666)
+	if err != nil {
+		log.Println(err)
+		return err
+	}
+	return nil
+}
 
-	walkFn := func(path string, info os.FileInfo, err error) error {
-		if info.Mode().IsDir() {
-			return nil
+// advanceArchive moves an archive on to its next state and reports whether
+// it changed.
+func advanceArchive(status *TeleportStatus, site *SiteStatus, target transfer.Target, a *ArchiveInfo) (bool, error) {
+	switch a.State {
+	case ArchiveBuilt:
+		if target == nil {
+			// Destination is the final place of the archive.
+			if err := cleanSite(site, a); err != nil {
+				return false, err
+			}
+			a.State = ArchiveVerified
+			a.VerifiedTs = time.Now().Unix()
+			return true, nil
+		}
+		err := target.Upload(a.File, remoteFile(status, site, a), a.Meta(site.Site))
+		if err != nil {
+			return false, err
 		}
-		// Because of scoping we can reference the external root_directory variable
-		new_path := path[len(basePath):]
-		// log.Println("base_path: ", basePath, path)
-		// log.Println("new_path: ", new_path)
-		if len(new_path) == 0 {
-			return nil
+		a.State = ArchiveUploaded
+		return true, nil
+	case ArchiveUploaded:
+		if target == nil {
+			log.Printf("%s was uploaded but no Target is set, keeping it until one is.\n", a.File)
+			return false, nil
 		}
-		fr, err := os.Open(path)
+		sum, err := target.Checksum(remoteFile(status, site, a))
 		if err != nil {
-			return err
+			return false, err
 		}
-		defer fr.Close()
-
-		if h, err := tar.FileInfoHeader(info, new_path); err != nil {
-			log.Fatalln(err)
-		} else {
-			h.Name = new_path
-			if err = tarfileWriter.WriteHeader(h); err != nil {
-				log.Fatalln(err)
-			}
+		if sum != a.Checksum {
+			log.Printf("Checksum of %s is %q on the target, want %q. Upload again.\n", a.File, sum, a.Checksum)
+			a.State = ArchiveBuilt
+			return true, nil
+		}
+		a.State = ArchiveVerified
+		a.VerifiedTs = time.Now().Unix()
+		log.Printf("Verified %s on the target.\n", a.File)
+		return true, nil
+	case ArchiveVerified:
+		if target == nil {
+			return false, nil
+		}
+		retention, err := time.ParseDuration(status.LocalRetention)
+		if err != nil && len(status.LocalRetention) > 0 {
+			return false, err
+		}
+		if time.Since(time.Unix(a.VerifiedTs, 0)) < retention {
+			return false, nil
+		}
+		if err = cleanSite(site, a); err != nil {
+			return false, err
 		}
-		if _, err := io.Copy(tarfileWriter, fr); err != nil {
-			log.Fatalln(err)
-		} else {
-			// log.Println(length)
+		err = os.Remove(a.File)
+		if err != nil && !os.IsNotExist(err) {
+			return false, err
 		}
+		a.State = ArchiveDeleted
+		log.Printf("Deleted %s.\n", a.File)
+		return true, nil
+	}
+	return false, nil
+}
+
+// cleanSite deletes the loose files of the range of a from the site.
+func cleanSite(site *SiteStatus, a *ArchiveInfo) error {
+	desFolder, subDesFolder := siteFolders(site)
+	state, err := archive.ReadState(desFolder, subDesFolder)
+	if err != nil {
+		return err
+	}
+	if state.Find(a.StartId) == nil {
+		// Archived before the archive state, its files are gone already.
 		return nil
 	}
+	return archive.Clean(a.StartId, desFolder, subDesFolder, site.BasePath)
+}
 
-	for i := startId; i < endId; i += IdStep {
-		pathes := []string{
-			basePath,
-			strconv.Itoa(i / 1000000),
-			strconv.Itoa(i / 1000 % 1000),
-		}
-		p := path.Join(pathes...)
+func remoteFile(status *TeleportStatus, site *SiteStatus, a *ArchiveInfo) string {
+	return path.Join(status.Target.RemoteFolder(site.Site), path.Base(a.File))
+}
 
-		if err = filepath.Walk(p, walkFn); err != nil {
+// teleportArchives moves every archive as far as it can go: built archives
+// are uploaded, uploaded ones are verified against the target's checksum,
+// and only verified ones are deleted locally after LocalRetention.
+func teleportArchives(status *TeleportStatus, stop <-chan struct{}) error {
+	var target transfer.Target
+	if status.Target != nil {
+		t, err := transfer.New(status.Target)
+		if err != nil {
+			log.Println(err)
 			return err
 		}
+		defer t.Close()
+		target = t
+		setUploading(t)
+		defer setUploading(nil)
 	}
-	log.Printf("Archived Id from %d to %d.\n", startId, endId-1)
-	deleteRange(startId, endId, basePath)
-	return nil
+
+	concurrency := 1
+	if status.Target != nil && status.Target.Concurrency > 1 {
+		concurrency = status.Target.Concurrency
+	}
+	type job struct {
+		site *SiteStatus
+		a    *ArchiveInfo
+	}
+	jobs := make(chan job)
+	lock := &sync.Mutex{}
+	var wg sync.WaitGroup
+	var saveErr error
+	for i := 0; i < concurrency; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for j := range jobs {
+				err := teleportArchive(status, j.site, target, j.a, lock, stop)
+				if err != nil {
+					lock.Lock()
+					saveErr = err
+					lock.Unlock()
+				}
+			}
+		}()
+	}
+	for _, site := range status.Sites {
+		for _, a := range site.Archives {
+			jobs <- job{site, a}
+		}
+	}
+	close(jobs)
+	wg.Wait()
+
+	for _, site := range status.Sites {
+		archives := make([]*ArchiveInfo, 0)
+		for _, a := range site.Archives {
+			if a.State != ArchiveDeleted {
+				archives = append(archives, a)
+			}
+		}
+		site.Archives = archives
+	}
+	return saveErr
 }
 
-type TeleportStatus struct {
-	LastEndId    int
-	StopId       int
-	Destination  string
-	BasePath     string
-	RemoteServer string
+// teleportArchive advances a single archive. Archives are advanced on a copy
+// so the status can be saved, under lock, while other archives upload.
+func teleportArchive(status *TeleportStatus, site *SiteStatus, target transfer.Target, a *ArchiveInfo, lock *sync.Mutex, stop <-chan struct{}) error {
+	for !isStopping(stop) {
+		lock.Lock()
+		next := *a
+		lock.Unlock()
+		changed, err := advanceArchive(status, site, target, &next)
+		if err != nil {
+			log.Printf("Failed to teleport %s: %v\n", a.File, err)
+		}
+		if changed {
+			lock.Lock()
+			*a = next
+			saveErr := saveStatus(status)
+			lock.Unlock()
+			if saveErr != nil {
+				return saveErr
+			}
+		}
+		if !changed || err != nil {
+			break
+		}
+	}
+	return nil
 }
 
-var (
-	statusPath = "./teleport.status"
-)
+func isStopping(stop <-chan struct{}) bool {
+	select {
+	case <-stop:
+		return true
+	default:
+		return false
+	}
+}
 
-func readStatus() (*TeleportStatus, error) {
-	bytes, err := ioutil.ReadFile(statusPath)
+// archiveRoutine archives the ranges of every site completed since the last
+// run and ships the archives. It returns early, leaving a consistent status,
+// once stop is closed.
+func archiveRoutine(stop <-chan struct{}) error {
+	status, err := readStatus()
 	if err != nil {
-		log.Println(err)
-		return nil, err
+		return err
 	}
-	s := &TeleportStatus{}
-	err = json.Unmarshal(bytes, s)
+	err = addScraperSites(status)
 	if err != nil {
-		log.Println(err)
-		return nil, err
+		return err
 	}
-	return s, nil
-}
-
-func saveStatus(s *TeleportStatus) error {
-	bytes, err := json.Marshal(s)
+	if len(status.Sites) == 0 {
+		return errors.New("No site to teleport.")
+	}
+	for _, site := range status.Sites {
+		err = archiveSite(status, site, stop)
+		if err != nil {
+			log.Printf("Failed to archive site %s: %v\n", site.Site, err)
+		}
+	}
+	err = teleportArchives(status, stop)
 	if err != nil {
-		log.Println(err)
 		return err
 	}
-	err = ioutil.WriteFile(statusPath, bytes, 0666)
+	err = saveStatus(status)
 	if err != nil {
-		log.Println(err)
 		return err
 	}
 	return nil
 }
 
-func archiveRoutine() error {
-	lastEndId := 0
-
-	basePath := ""
-	status, err := readStatus()
-
-	if status != nil {
-		lastEndId = status.LastEndId
-		basePath = status.BasePath
-	} else {
-		log.Fatal("Invalid Id range to teleport.")
-		return errors.New("Invalid Id range to teleport.")
-	}
-	os.MkdirAll(status.Destination, 0666)
-	currentId := getCurrentId(basePath)
-	if status.StopId > 0 {
-		currentId = status.StopId
+// archiveSite archives the ranges of a site the scraper has finished with,
+// as recorded in its progress, or reuses the archive the scraper made.
+func archiveSite(status *TeleportStatus, site *SiteStatus, stop <-chan struct{}) error {
+	desFolder, subDesFolder := siteFolders(site)
+	progress, err := archive.ReadProgress(desFolder, subDesFolder)
+	if err != nil {
+		return err
 	}
-	for id := lastEndId; id+IdStep*10 <= currentId; id += IdStep * 10 {
-		if IsLowDiskSpace() {
+	for id := site.LastEndId; !isStopping(stop); id += archive.ArchiveSize {
+		endId := id + archive.ArchiveSize
+		if !progress.Complete(id, endId) || (site.StopId > 0 && endId > site.StopId) {
 			break
 		}
-		desFile := fmt.Sprintf("%s/%d-%d.tar.gz", status.Destination, id, id+IdStep*10-1)
-		err := archiveRange(id, id+IdStep*10, desFile, basePath)
+		err = archive.Build(id, endId, desFolder, subDesFolder, site.BasePath)
+		if err != nil {
+			return err
+		}
+		state, err := archive.ReadState(desFolder, subDesFolder)
+		if err != nil {
+			return err
+		}
+		r := state.Find(id)
+		if r == nil {
+			return fmt.Errorf("Id from %d to %d is not in the archive state.", id, endId-1)
+		}
+		desFile := archive.ArchivePath(desFolder, subDesFolder, id, endId)
+		sum, err := transfer.FileChecksum(desFile)
 		if err != nil {
 			return err
 		}
-		status.LastEndId = id + IdStep*10
+		site.LastEndId = endId
+		site.Archives = append(site.Archives, &ArchiveInfo{
+			File:     desFile,
+			StartId:  id,
+			EndId:    endId,
+			Files:    r.Files,
+			State:    ArchiveBuilt,
+			Checksum: sum,
+		})
 		err = saveStatus(status)
 		if err != nil {
 			return err
 		}
 	}
-	err = saveStatus(status)
-	if err != nil {
-		return err
-	}
 	return nil
 }
 
-func getCurrentFolder(basePath string) (string, int) {
-	files, _ := ioutil.ReadDir(basePath)
-	maxId := math.MinInt64
-	maxFolder := ""
-
-	for _, f := range files {
-		pathes := strings.Split(f.Name(), "/")
-		if len(pathes) > 0 {
-			t, err := strconv.Atoi(pathes[len(pathes)-1])
-			if err != nil {
-				continue
-			}
-			if t > maxId {
-				maxId = t
-				maxFolder = f.Name()
-			}
-		}
+// Progress is served by the daemon on -status_addr.
+type Progress struct {
+	StartedTs int64
+	LastRunTs int64
+	LastError string
+	Running   bool
+	Status    *TeleportStatus
+	// Transfers running now.
+	Transfers []transfer.Transfer
+}
+
+var (
+	progress     = &Progress{}
+	progressLock = &sync.Mutex{}
+	// uploading is the target of the archives teleported now, if any.
+	uploading transfer.Target
+)
+
+func setUploading(t transfer.Target) {
+	progressLock.Lock()
+	defer progressLock.Unlock()
+	uploading = t
+}
+
+func serveProgress(w http.ResponseWriter, r *http.Request) {
+	progressLock.Lock()
+	p := *progress
+	t := uploading
+	progressLock.Unlock()
+	p.Status, _ = readStatus()
+	p.Transfers = make([]transfer.Transfer, 0)
+	if t != nil {
+		p.Transfers = t.Transfers()
 	}
 
-	if len(maxFolder) > 0 {
-		return path.Join(basePath, maxFolder), maxId
+	bytes, err := json.Marshal(p)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
 	}
-	return "", 0
+	w.Header().Set("Content-Type", "application/json")
+	w.Write(bytes)
 }
 
-func getCurrentId(basePath string) int {
-	folder1, id1 := getCurrentFolder(basePath)
-	_, id2 := getCurrentFolder(folder1)
-	return id1*1000000 + id2*1000
+// daemon runs archiveRoutine every interval until SIGINT or SIGTERM. A
+// signal lets the running pass finish its current step before exiting.
+func daemon(interval time.Duration, statusAddr string) {
+	progress.StartedTs = time.Now().Unix()
+	if len(statusAddr) > 0 {
+		http.HandleFunc("/progress", serveProgress)
+		go func() {
+			log.Println(http.ListenAndServe(statusAddr, nil))
+		}()
+	}
+
+	stop := make(chan struct{})
+	sigChan := make(chan os.Signal, 1)
+	signal.Notify(sigChan, syscall.SIGINT, syscall.SIGTERM)
+	go func() {
+		<-sigChan
+		log.Println("Stopping teleport.")
+		close(stop)
+	}()
+
+	for {
+		progressLock.Lock()
+		progress.Running = true
+		progressLock.Unlock()
+
+		err := archiveRoutine(stop)
+
+		progressLock.Lock()
+		progress.Running = false
+		progress.LastRunTs = time.Now().Unix()
+		progress.LastError = ""
+		if err != nil {
+			progress.LastError = err.Error()
+		}
+		progressLock.Unlock()
+		if err != nil {
+			log.Println(err)
+		}
+
+		select {
+		case <-stop:
+			log.Println("Teleport stopped.")
+			return
+		case <-time.After(interval):
+		}
+	}
 }
 
 func main() {
+	runDaemon := flag.Bool("daemon", false, "Keep running and teleport ranges as the scraper completes them.")
+	interval := flag.Duration("interval", time.Minute, "How often the daemon looks for completed ranges.")
+	statusAddr := flag.String("status_addr", "", "Address to serve the daemon progress on, e.g. :8090.")
+	flag.StringVar(&statusPath, "status", statusPath, "Teleport status file.")
 	flag.Parse() // get the arguments from command line
 	log.SetFlags(log.Lshortfile | log.LstdFlags)
-	archiveRoutine()
+
+	if *runDaemon {
+		daemon(*interval, *statusAddr)
+		return
+	}
+	err := archiveRoutine(nil)
+	if err != nil {
+		log.Fatal(err)
+	}
 }
@@ -0,0 +1,320 @@
+package main
+
+import (
+	"errors"
+	"github.com/charleswong/scraper/archive"
+	"github.com/charleswong/scraper/transfer"
+	"io/ioutil"
+	"os"
+	"path"
+	"strconv"
+	"sync"
+	"testing"
+)
+
+// fakeTarget keeps the checksums of the files uploaded to it.
+type fakeTarget struct {
+	uploadErr error
+
+	lock  sync.Mutex
+	files map[string]string
+	meta  map[string]map[string]string
+}
+
+func newFakeTarget() *fakeTarget {
+	return &fakeTarget{files: make(map[string]string), meta: make(map[string]map[string]string)}
+}
+
+func (t *fakeTarget) Upload(localFile, remoteFile string, meta map[string]string) error {
+	if t.uploadErr != nil {
+		return t.uploadErr
+	}
+	sum, err := transfer.FileChecksum(localFile)
+	if err != nil {
+		return err
+	}
+	t.lock.Lock()
+	defer t.lock.Unlock()
+	t.files[remoteFile] = sum
+	t.meta[remoteFile] = meta
+	return nil
+}
+
+func (t *fakeTarget) Checksum(remoteFile string) (string, error) {
+	t.lock.Lock()
+	defer t.lock.Unlock()
+	return t.files[remoteFile], nil
+}
+
+func (t *fakeTarget) Transfers() []transfer.Transfer {
+	return nil
+}
+
+func (t *fakeTarget) Close() error {
+	return nil
+}
+
+// newTestSite builds the archives of the ranges starting at startIds for a
+// site in dir, each from one loose profile, and returns them built.
+func newTestSite(t *testing.T, dir string, startIds ...int) (*TeleportStatus, *SiteStatus) {
+	statusPath = path.Join(dir, "teleport.status")
+	site := &SiteStatus{
+		Site:        "Jiayuan",
+		BasePath:    path.Join(dir, "deepavatar", "Jiayuan"),
+		Destination: path.Join(dir, "avatar_tars", "Jiayuan"),
+	}
+	desFolder, subDesFolder := siteFolders(site)
+	for _, startId := range startIds {
+		writeProfile(t, site.BasePath, startId+1)
+		endId := startId + archive.ArchiveSize
+		if err := archive.Build(startId, endId, desFolder, subDesFolder, site.BasePath); err != nil {
+			t.Fatal(err)
+		}
+		file := archive.ArchivePath(desFolder, subDesFolder, startId, endId)
+		sum, err := transfer.FileChecksum(file)
+		if err != nil {
+			t.Fatal(err)
+		}
+		site.Archives = append(site.Archives, &ArchiveInfo{
+			File:     file,
+			StartId:  startId,
+			EndId:    endId,
+			Files:    1,
+			State:    ArchiveBuilt,
+			Checksum: sum,
+		})
+	}
+	status := &TeleportStatus{
+		Target: &transfer.Config{RemotePath: "/remote"},
+		Sites:  []*SiteStatus{site},
+	}
+	return status, site
+}
+
+func profilePath(basePath string, id int) string {
+	return path.Join(basePath, strconv.Itoa(id/1000000), strconv.Itoa(id/1000%1000), strconv.Itoa(id%1000), "photo.jpg")
+}
+
+func writeProfile(t *testing.T, basePath string, id int) {
+	p := profilePath(basePath, id)
+	if err := os.MkdirAll(path.Dir(p), 0777); err != nil {
+		t.Fatal(err)
+	}
+	if err := ioutil.WriteFile(p, []byte(strconv.Itoa(id)), 0666); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func exists(p string) bool {
+	_, err := os.Stat(p)
+	return err == nil
+}
+
+// advance advances a and fails t unless it moves to want.
+func advance(t *testing.T, status *TeleportStatus, site *SiteStatus, target transfer.Target, a *ArchiveInfo, want string) {
+	changed, err := advanceArchive(status, site, target, a)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !changed || a.State != want {
+		t.Fatalf("Archive is %s, changed %v, want %s", a.State, changed, want)
+	}
+}
+
+func TestAdvanceArchiveUploadsVerifiesAndDeletes(t *testing.T) {
+	dir, err := ioutil.TempDir("", "teleport")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	status, site := newTestSite(t, dir, 10000)
+	a := site.Archives[0]
+	target := newFakeTarget()
+
+	advance(t, status, site, target, a, ArchiveUploaded)
+	remote := path.Join("/remote", "Jiayuan", path.Base(a.File))
+	if target.files[remote] != a.Checksum || target.meta[remote]["EndId"] != "19999" {
+		t.Fatalf("Target has %v with %v, want %s", target.files, target.meta[remote], remote)
+	}
+	advance(t, status, site, target, a, ArchiveVerified)
+	if !exists(profilePath(site.BasePath, 10001)) {
+		t.Fatal("Loose files were deleted before the archive was deleted")
+	}
+
+	advance(t, status, site, target, a, ArchiveDeleted)
+	if exists(a.File) || exists(profilePath(site.BasePath, 10001)) {
+		t.Fatal("Deleted archive left its files behind")
+	}
+	state, err := archive.ReadState(siteFolders(site))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if r := state.Find(10000); r == nil || r.State != archive.RangeCleaned {
+		t.Fatalf("Range is %v, want cleaned", r)
+	}
+}
+
+func TestAdvanceArchiveKeepsRetention(t *testing.T) {
+	dir, err := ioutil.TempDir("", "teleport")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	status, site := newTestSite(t, dir, 10000)
+	status.LocalRetention = "72h"
+	a := site.Archives[0]
+	target := newFakeTarget()
+	advance(t, status, site, target, a, ArchiveUploaded)
+	advance(t, status, site, target, a, ArchiveVerified)
+
+	if changed, err := advanceArchive(status, site, target, a); changed || err != nil {
+		t.Fatalf("Advanced an archive within LocalRetention: %v, %v", changed, err)
+	}
+	if !exists(a.File) || !exists(profilePath(site.BasePath, 10001)) {
+		t.Fatal("Deleted an archive within LocalRetention")
+	}
+}
+
+func TestAdvanceArchiveUploadFailure(t *testing.T) {
+	dir, err := ioutil.TempDir("", "teleport")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	status, site := newTestSite(t, dir, 10000)
+	a := site.Archives[0]
+	target := newFakeTarget()
+	target.uploadErr = errors.New("connection reset")
+
+	if changed, err := advanceArchive(status, site, target, a); changed || err != target.uploadErr {
+		t.Fatalf("Failed upload returned %v, %v", changed, err)
+	}
+	if a.State != ArchiveBuilt || !exists(a.File) || !exists(profilePath(site.BasePath, 10001)) {
+		t.Fatalf("Failed upload left the archive %s", a.State)
+	}
+}
+
+func TestAdvanceArchiveChecksumMismatch(t *testing.T) {
+	dir, err := ioutil.TempDir("", "teleport")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	status, site := newTestSite(t, dir, 10000)
+	a := site.Archives[0]
+	target := newFakeTarget()
+	advance(t, status, site, target, a, ArchiveUploaded)
+	target.files[remoteFile(status, site, a)] = "corrupt"
+
+	advance(t, status, site, target, a, ArchiveBuilt)
+	if a.VerifiedTs != 0 || !exists(profilePath(site.BasePath, 10001)) {
+		t.Fatal("Mismatched copy was taken as verified")
+	}
+	advance(t, status, site, target, a, ArchiveUploaded)
+	advance(t, status, site, target, a, ArchiveVerified)
+}
+
+func TestAdvanceArchiveWithoutTarget(t *testing.T) {
+	dir, err := ioutil.TempDir("", "teleport")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	status, site := newTestSite(t, dir, 10000, 20000)
+	status.Target = nil
+	built, uploaded := site.Archives[0], site.Archives[1]
+	uploaded.State = ArchiveUploaded
+
+	// Destination is the final place of built archives.
+	advance(t, status, site, nil, built, ArchiveVerified)
+	if !exists(built.File) || exists(profilePath(site.BasePath, 10001)) {
+		t.Fatal("Archive without target should be kept without its loose files")
+	}
+	if changed, err := advanceArchive(status, site, nil, built); changed || err != nil {
+		t.Fatalf("Advanced a verified archive without target: %v, %v", changed, err)
+	}
+
+	if changed, err := advanceArchive(status, site, nil, uploaded); changed || err != nil {
+		t.Fatalf("Advanced an uploaded archive without target: %v, %v", changed, err)
+	}
+	if uploaded.State != ArchiveUploaded || !exists(profilePath(site.BasePath, 20001)) {
+		t.Fatalf("Uploaded archive without target is %s", uploaded.State)
+	}
+}
+
+func TestTeleportArchivesConcurrently(t *testing.T) {
+	dir, err := ioutil.TempDir("", "teleport")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	status, site := newTestSite(t, dir, 10000, 20000, 30000, 40000)
+	target := newFakeTarget()
+
+	lock := &sync.Mutex{}
+	var wg sync.WaitGroup
+	for _, a := range site.Archives {
+		wg.Add(1)
+		go func(a *ArchiveInfo) {
+			defer wg.Done()
+			if err := teleportArchive(status, site, target, a, lock, nil); err != nil {
+				t.Error(err)
+			}
+		}(a)
+	}
+	wg.Wait()
+
+	saved, err := readStatus()
+	if err != nil {
+		t.Fatal(err)
+	}
+	for i, a := range saved.Sites[0].Archives {
+		if a.State != ArchiveDeleted || site.Archives[i].State != ArchiveDeleted {
+			t.Fatalf("Archive %s is %s, saved %s, want deleted", a.File, site.Archives[i].State, a.State)
+		}
+	}
+	if len(target.files) != 4 {
+		t.Fatalf("Target has %d files, want 4", len(target.files))
+	}
+}
+
+func TestReadStatusMovesLegacySite(t *testing.T) {
+	dir, err := ioutil.TempDir("", "teleport")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	statusPath = path.Join(dir, "teleport.status")
+	legacy := `{"RemoteServer":"backup","LastEndId":20000,"StopId":90000,"Destination":"/data/avatar_tars/Jiayuan",` +
+		`"BasePath":"/data/deepavatar/Jiayuan","Site":"Jiayuan","Archives":[{"File":"a.tar","StartId":10000,"EndId":20000,"State":"built"}]}`
+	if err := ioutil.WriteFile(statusPath, []byte(legacy), 0666); err != nil {
+		t.Fatal(err)
+	}
+
+	s, err := readStatus()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(s.Sites) != 1 {
+		t.Fatalf("Read %d sites, want 1", len(s.Sites))
+	}
+	site := s.Sites[0]
+	if site.Site != "Jiayuan" || site.BasePath != "/data/deepavatar/Jiayuan" || site.Destination != "/data/avatar_tars/Jiayuan" ||
+		site.LastEndId != 20000 || site.StopId != 90000 || len(site.Archives) != 1 || site.Archives[0].File != "a.tar" {
+		t.Fatalf("Moved the legacy site to %+v", site)
+	}
+	if s.RemoteServer != "backup" || len(s.BasePath) > 0 || len(s.Archives) > 0 || s.LastEndId != 0 {
+		t.Fatalf("Legacy fields left in %+v", s)
+	}
+
+	// Once saved, the site is not moved a second time.
+	if err := saveStatus(s); err != nil {
+		t.Fatal(err)
+	}
+	if s, err = readStatus(); err != nil {
+		t.Fatal(err)
+	}
+	if len(s.Sites) != 1 || s.Sites[0].LastEndId != 20000 {
+		t.Fatalf("Read %d sites after saving, want 1", len(s.Sites))
+	}
+}
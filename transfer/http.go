@@ -0,0 +1,247 @@
+package transfer
+
+import (
+	"errors"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"log"
+	"math/rand"
+	"net/http"
+	"path"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// MetaHeader prefixes the headers carrying the metadata of an upload.
+const MetaHeader = "X-Archive-"
+
+// ChecksumHeader carries the hex sha256 of a complete remote file. The
+// server sends it on HEAD and echoes it after the last PUT, which is taken as
+// confirmation that the archive arrived intact.
+const ChecksumHeader = "X-Checksum-Sha256"
+
+// StatusResumeIncomplete is returned by HEAD for a partial upload, with a
+// "Range: bytes=0-<last byte>" header telling how much the server has.
+const StatusResumeIncomplete = 308
+
+var (
+	uploadRetries = 3
+	// uploadBackoff is the delay before the first retry of an upload, doubled
+	// at every further retry.
+	uploadBackoff = 2 * time.Second
+	// maxRetryAfter caps the delay a server asks for in Retry-After.
+	maxRetryAfter = 10 * time.Minute
+	sleep         = time.Sleep
+)
+
+// statusError is an unexpected status of the server, with the delay it asks
+// for before a retry, if any.
+type statusError struct {
+	msg        string
+	retryAfter time.Duration
+}
+
+func (e *statusError) Error() string {
+	return e.msg
+}
+
+func newStatusError(method, remoteFile string, resp *http.Response) error {
+	return &statusError{
+		msg:        fmt.Sprintf("%s %s: %s", method, remoteFile, resp.Status),
+		retryAfter: retryAfter(resp.Header.Get("Retry-After")),
+	}
+}
+
+// retryAfter parses a Retry-After header, in seconds or as an HTTP date.
+func retryAfter(header string) time.Duration {
+	if len(header) == 0 {
+		return 0
+	}
+	var d time.Duration
+	if secs, err := strconv.Atoi(header); err == nil {
+		d = time.Duration(secs) * time.Second
+	} else if date, err := http.ParseTime(header); err == nil {
+		d = time.Until(date)
+	}
+	if d > maxRetryAfter {
+		d = maxRetryAfter
+	}
+	return d
+}
+
+// retryDelay is how long to wait after attempt i failed with err: what the
+// server asked for, or else uploadBackoff doubled i times plus up to half of
+// that as jitter, so that targets failing together do not retry together.
+func retryDelay(i int, err error) time.Duration {
+	if e, ok := err.(*statusError); ok && e.retryAfter > 0 {
+		return e.retryAfter
+	}
+	d := uploadBackoff << uint(i)
+	return d + time.Duration(rand.Int63n(int64(d)/2+1))
+}
+
+type HttpTarget struct {
+	url     string
+	token   string
+	client  *http.Client
+	limiter *limiter
+	uploads
+}
+
+func NewHttpTarget(c *Config) (*HttpTarget, error) {
+	if len(c.URL) == 0 {
+		return nil, errors.New("No URL for http target.")
+	}
+	l, err := newLimiter(c)
+	if err != nil {
+		log.Println(err)
+		return nil, err
+	}
+	t := &HttpTarget{
+		url:     strings.TrimSuffix(c.URL, "/"),
+		client:  &http.Client{},
+		limiter: l,
+	}
+	if len(c.TokenFile) > 0 {
+		bytes, err := ioutil.ReadFile(c.TokenFile)
+		if err != nil {
+			log.Println(err)
+			return nil, err
+		}
+		t.token = strings.TrimSpace(string(bytes))
+	}
+	return t, nil
+}
+
+func (t *HttpTarget) newRequest(method, remoteFile string, body io.Reader) (*http.Request, error) {
+	req, err := http.NewRequest(method, t.url+path.Clean("/"+remoteFile), body)
+	if err != nil {
+		return nil, err
+	}
+	if len(t.token) > 0 {
+		req.Header.Set("Authorization", "Bearer "+t.token)
+	}
+	return req, nil
+}
+
+// remoteState returns how many bytes of remoteFile the server has and the
+// checksum it reports once the file is complete.
+func (t *HttpTarget) remoteState(remoteFile string) (int64, string, error) {
+	req, err := t.newRequest("HEAD", remoteFile, nil)
+	if err != nil {
+		return 0, "", err
+	}
+	resp, err := t.client.Do(req)
+	if err != nil {
+		return 0, "", err
+	}
+	resp.Body.Close()
+
+	switch resp.StatusCode {
+	case http.StatusNotFound:
+		return 0, "", nil
+	case http.StatusOK:
+		return resp.ContentLength, resp.Header.Get(ChecksumHeader), nil
+	case StatusResumeIncomplete:
+		r := resp.Header.Get("Range")
+		if len(r) == 0 {
+			return 0, "", nil
+		}
+		i := strings.LastIndex(r, "-")
+		last, err := strconv.ParseInt(r[i+1:], 10, 64)
+		if i < 0 || err != nil {
+			return 0, "", fmt.Errorf("Invalid Range %q from %s", r, t.url)
+		}
+		return last + 1, "", nil
+	}
+	return 0, "", newStatusError("HEAD", remoteFile, resp)
+}
+
+func (t *HttpTarget) put(localFile, remoteFile string, offset int64, meta map[string]string) (string, error) {
+	f, size, err := openLocal(localFile, offset)
+	if err != nil {
+		return "", err
+	}
+	defer f.Close()
+	if offset >= size && offset > 0 {
+		// The server claims more than the file has, start over.
+		offset = 0
+		if _, err := f.Seek(0, io.SeekStart); err != nil {
+			return "", err
+		}
+	}
+
+	u := t.start(localFile, size, offset, t.limiter)
+	defer u.finish()
+	req, err := t.newRequest("PUT", remoteFile, u.reader(f))
+	if err != nil {
+		return "", err
+	}
+	req.ContentLength = size - offset
+	for k, v := range meta {
+		req.Header.Set(MetaHeader+k, v)
+	}
+	if size > 0 {
+		req.Header.Set("Content-Range", fmt.Sprintf("bytes %d-%d/%d", offset, size-1, size))
+	}
+	resp, err := t.client.Do(req)
+	if err != nil {
+		return "", err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK && resp.StatusCode != http.StatusCreated {
+		return "", newStatusError("PUT", remoteFile, resp)
+	}
+	return resp.Header.Get(ChecksumHeader), nil
+}
+
+// Upload PUTs localFile, resuming from what the server already has. The
+// upload is confirmed only when the server echoes the checksum of the file.
+// Failed attempts are retried after retryDelay.
+func (t *HttpTarget) Upload(localFile, remoteFile string, meta map[string]string) error {
+	sum, err := FileChecksum(localFile)
+	if err != nil {
+		return err
+	}
+
+	for i := 0; ; i++ {
+		var offset int64
+		var remoteSum string
+		offset, remoteSum, err = t.remoteState(remoteFile)
+		if err == nil && remoteSum == sum {
+			log.Printf("%s is already on %s\n", remoteFile, t.url)
+			return nil
+		}
+		if err == nil {
+			if len(remoteSum) > 0 {
+				// A different file is there, upload from scratch.
+				offset = 0
+			}
+			remoteSum, err = t.put(localFile, remoteFile, offset, meta)
+		}
+		if err == nil && remoteSum != sum {
+			err = fmt.Errorf("Checksum mismatch after uploading %s: %q", remoteFile, remoteSum)
+		}
+		if err == nil {
+			log.Printf("Uploaded %s -> %s%s from offset %d\n", localFile, t.url, path.Clean("/"+remoteFile), offset)
+			return nil
+		}
+		log.Printf("Error: upload %s -> %v\n", remoteFile, err)
+		if i+1 >= uploadRetries {
+			return err
+		}
+		sleep(retryDelay(i, err))
+	}
+}
+
+// Checksum returns the checksum the server reports for a complete file.
+func (t *HttpTarget) Checksum(remoteFile string) (string, error) {
+	_, sum, err := t.remoteState(remoteFile)
+	return sum, err
+}
+
+func (t *HttpTarget) Close() error {
+	return nil
+}
@@ -0,0 +1,216 @@
+package transfer
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path"
+	"sync"
+	"testing"
+	"time"
+)
+
+// uploadServer is a stand-in for an upload box speaking the protocol of
+// HttpTarget.
+type uploadServer struct {
+	lock     sync.Mutex
+	token    string
+	files    map[string][]byte
+	complete map[string]bool
+	ranges   []string
+	badSum   bool
+	// busy has the Retry-After, if any, of each PUT to refuse first.
+	busy []string
+}
+
+func newUploadServer(token string) *uploadServer {
+	return &uploadServer{
+		token:    token,
+		files:    make(map[string][]byte),
+		complete: make(map[string]bool),
+	}
+}
+
+func (s *uploadServer) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	s.lock.Lock()
+	defer s.lock.Unlock()
+	if r.Header.Get("Authorization") != "Bearer "+s.token {
+		w.WriteHeader(http.StatusUnauthorized)
+		return
+	}
+	data := s.files[r.URL.Path]
+	switch r.Method {
+	case "HEAD":
+		switch {
+		case data == nil:
+			w.WriteHeader(http.StatusNotFound)
+		case s.complete[r.URL.Path]:
+			w.Header().Set(ChecksumHeader, checksumOf(data))
+			w.WriteHeader(http.StatusOK)
+		default:
+			w.Header().Set("Range", fmt.Sprintf("bytes=0-%d", len(data)-1))
+			w.WriteHeader(StatusResumeIncomplete)
+		}
+	case "PUT":
+		if len(s.busy) > 0 {
+			if len(s.busy[0]) > 0 {
+				w.Header().Set("Retry-After", s.busy[0])
+			}
+			s.busy = s.busy[1:]
+			w.WriteHeader(http.StatusServiceUnavailable)
+			return
+		}
+		var start, end, total int
+		contentRange := r.Header.Get("Content-Range")
+		s.ranges = append(s.ranges, contentRange)
+		fmt.Sscanf(contentRange, "bytes %d-%d/%d", &start, &end, &total)
+		if start == 0 {
+			data = nil
+		}
+		if start != len(data) {
+			w.WriteHeader(http.StatusRequestedRangeNotSatisfiable)
+			return
+		}
+		body, _ := ioutil.ReadAll(r.Body)
+		if s.badSum {
+			// Corrupted on the way.
+			body = append([]byte("!"), body[1:]...)
+		}
+		data = append(data, body...)
+		s.files[r.URL.Path] = data
+		if len(data) == total {
+			s.complete[r.URL.Path] = true
+			w.Header().Set(ChecksumHeader, checksumOf(data))
+		}
+		w.WriteHeader(http.StatusCreated)
+	}
+}
+
+func checksumOf(data []byte) string {
+	sum := sha256.Sum256(data)
+	return hex.EncodeToString(sum[:])
+}
+
+func newHttpTest(t *testing.T, s *uploadServer) (*Config, string, func()) {
+	dir, err := ioutil.TempDir("", "transfer")
+	if err != nil {
+		t.Fatal(err)
+	}
+	tokenFile := path.Join(dir, "token")
+	if err := ioutil.WriteFile(tokenFile, []byte("secret\n"), 0600); err != nil {
+		t.Fatal(err)
+	}
+	localFile := path.Join(dir, "100000000-100009999.tar.gz")
+	if err := ioutil.WriteFile(localFile, []byte("0123456789"), 0666); err != nil {
+		t.Fatal(err)
+	}
+	server := httptest.NewServer(s)
+	sleep = func(time.Duration) {}
+	c := &Config{
+		Type:       "http",
+		URL:        server.URL + "/upload",
+		TokenFile:  tokenFile,
+		RemotePath: "avatar_tars",
+	}
+	return c, localFile, func() {
+		sleep = time.Sleep
+		server.Close()
+		os.RemoveAll(dir)
+	}
+}
+
+func TestHttpUploadResumes(t *testing.T) {
+	s := newUploadServer("secret")
+	c, localFile, cleanup := newHttpTest(t, s)
+	defer cleanup()
+	// An earlier upload was interrupted after 4 bytes.
+	s.files["/upload/avatar_tars/Jiayuan/100000000-100009999.tar.gz"] = []byte("0123")
+
+	target, err := New(c)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer target.Close()
+	remoteFile := path.Join(c.RemoteFolder("Jiayuan"), path.Base(localFile))
+	if err := target.Upload(localFile, remoteFile, nil); err != nil {
+		t.Fatal(err)
+	}
+
+	data := s.files["/upload/avatar_tars/Jiayuan/100000000-100009999.tar.gz"]
+	if string(data) != "0123456789" {
+		t.Fatalf("Server has %q, want 0123456789", data)
+	}
+	if len(s.ranges) != 1 || s.ranges[0] != "bytes 4-9/10" {
+		t.Fatalf("Uploaded ranges %v, want [bytes 4-9/10]", s.ranges)
+	}
+	sum, _ := FileChecksum(localFile)
+	if remoteSum, err := target.Checksum(remoteFile); err != nil || remoteSum != sum {
+		t.Fatalf("Remote checksum %q, %v, want %q", remoteSum, err, sum)
+	}
+
+	// A complete file with the same checksum is not uploaded again.
+	if err := target.Upload(localFile, remoteFile, nil); err != nil {
+		t.Fatal(err)
+	}
+	if len(s.ranges) != 1 {
+		t.Fatalf("Uploaded ranges %v, want no new upload", s.ranges)
+	}
+}
+
+func TestHttpUploadNeedsConfirmation(t *testing.T) {
+	s := newUploadServer("secret")
+	s.badSum = true
+	c, localFile, cleanup := newHttpTest(t, s)
+	defer cleanup()
+
+	target, err := New(c)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := target.Upload(localFile, "avatar_tars/Jiayuan/a.tar.gz", nil); err == nil {
+		t.Fatal("Upload succeeded without a matching checksum")
+	}
+}
+
+func TestHttpUploadNeedsToken(t *testing.T) {
+	s := newUploadServer("other")
+	c, localFile, cleanup := newHttpTest(t, s)
+	defer cleanup()
+
+	target, err := New(c)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := target.Upload(localFile, "avatar_tars/Jiayuan/a.tar.gz", nil); err == nil {
+		t.Fatal("Upload succeeded with a wrong token")
+	}
+}
+
+func TestHttpUploadBacksOff(t *testing.T) {
+	s := newUploadServer("secret")
+	s.busy = []string{"7", ""}
+	c, localFile, cleanup := newHttpTest(t, s)
+	defer cleanup()
+	var delays []time.Duration
+	sleep = func(d time.Duration) {
+		delays = append(delays, d)
+	}
+
+	target, err := New(c)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := target.Upload(localFile, "avatar_tars/Jiayuan/a.tar.gz", nil); err != nil {
+		t.Fatal(err)
+	}
+	// The server asked for 7s, then the second retry backs off twice
+	// uploadBackoff, with jitter.
+	if len(delays) != 2 || delays[0] != 7*time.Second ||
+		delays[1] < 2*uploadBackoff || delays[1] > 3*uploadBackoff {
+		t.Fatalf("Retried after %v", delays)
+	}
+}
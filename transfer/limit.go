@@ -0,0 +1,196 @@
+package transfer
+
+import (
+	"fmt"
+	"io"
+	"log"
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+var (
+	// Reads are throttled in chunks of at most readChunk bytes.
+	readChunk = 32 * 1024
+)
+
+// RateWindow sets the bandwidth cap between From and To, as "15:04" local
+// time. A window with From after To runs over midnight.
+type RateWindow struct {
+	From      string
+	To        string
+	RateLimit int64
+}
+
+type window struct {
+	from, to  int
+	rateLimit int64
+}
+
+// limiter is a token bucket shared by the uploads of a target.
+type limiter struct {
+	rateLimit int64
+	windows   []window
+
+	lock   sync.Mutex
+	tokens float64
+	last   time.Time
+}
+
+func parseClock(s string) (int, error) {
+	t, err := time.Parse("15:04", s)
+	if err != nil {
+		return 0, err
+	}
+	return t.Hour()*60 + t.Minute(), nil
+}
+
+func newLimiter(c *Config) (*limiter, error) {
+	l := &limiter{rateLimit: c.RateLimit}
+	for _, w := range c.RateSchedule {
+		from, err := parseClock(w.From)
+		if err != nil {
+			return nil, fmt.Errorf("Invalid RateSchedule From %q", w.From)
+		}
+		to, err := parseClock(w.To)
+		if err != nil {
+			return nil, fmt.Errorf("Invalid RateSchedule To %q", w.To)
+		}
+		l.windows = append(l.windows, window{from: from, to: to, rateLimit: w.RateLimit})
+	}
+	return l, nil
+}
+
+// rate returns the cap in bytes/sec at now, 0 for none.
+func (l *limiter) rate(now time.Time) int64 {
+	minute := now.Hour()*60 + now.Minute()
+	for _, w := range l.windows {
+		if w.from <= w.to && minute >= w.from && minute < w.to {
+			return w.rateLimit
+		}
+		if w.from > w.to && (minute >= w.from || minute < w.to) {
+			return w.rateLimit
+		}
+	}
+	return l.rateLimit
+}
+
+// wait blocks until n more bytes may be sent.
+func (l *limiter) wait(n int) {
+	l.lock.Lock()
+	now := time.Now()
+	rate := float64(l.rate(now))
+	if rate <= 0 {
+		l.last = now
+		l.lock.Unlock()
+		return
+	}
+	l.tokens += now.Sub(l.last).Seconds() * rate
+	if l.tokens > rate {
+		// Burst at most one second worth of bytes.
+		l.tokens = rate
+	}
+	l.last = now
+	l.tokens -= float64(n)
+	delay := time.Duration(-l.tokens / rate * float64(time.Second))
+	l.lock.Unlock()
+	if delay > 0 {
+		time.Sleep(delay)
+	}
+}
+
+// Transfer is the progress of an upload.
+type Transfer struct {
+	LocalFile string
+	Size      int64
+	Sent      int64
+	StartedTs int64
+}
+
+type upload struct {
+	localFile string
+	size      int64
+	sent      int64
+	started   time.Time
+	limiter   *limiter
+	reported  int64
+	uploads   *uploads
+}
+
+// uploads are the uploads of a target running now.
+type uploads struct {
+	lock    sync.Mutex
+	running map[*upload]bool
+}
+
+// start registers an upload of size bytes of localFile, already offset
+// bytes in, until finish is called.
+func (s *uploads) start(localFile string, size, offset int64, l *limiter) *upload {
+	u := &upload{
+		localFile: localFile,
+		size:      size,
+		sent:      offset,
+		started:   time.Now(),
+		limiter:   l,
+		reported:  offset,
+		uploads:   s,
+	}
+	s.lock.Lock()
+	defer s.lock.Unlock()
+	if s.running == nil {
+		s.running = make(map[*upload]bool)
+	}
+	s.running[u] = true
+	return u
+}
+
+func (u *upload) finish() {
+	u.uploads.lock.Lock()
+	defer u.uploads.lock.Unlock()
+	delete(u.uploads.running, u)
+}
+
+// Transfers returns the progress of the uploads running now.
+func (s *uploads) Transfers() []Transfer {
+	s.lock.Lock()
+	defer s.lock.Unlock()
+	transfers := make([]Transfer, 0)
+	for u := range s.running {
+		transfers = append(transfers, Transfer{
+			LocalFile: u.localFile,
+			Size:      u.size,
+			Sent:      atomic.LoadInt64(&u.sent),
+			StartedTs: u.started.Unix(),
+		})
+	}
+	return transfers
+}
+
+// reader throttles r by the limiter of the upload and counts what is read
+// as sent.
+func (u *upload) reader(r io.Reader) io.Reader {
+	return &uploadReader{r: r, u: u}
+}
+
+type uploadReader struct {
+	r io.Reader
+	u *upload
+}
+
+func (r *uploadReader) Read(p []byte) (int, error) {
+	if len(p) > readChunk {
+		p = p[:readChunk]
+	}
+	if r.u.limiter != nil {
+		r.u.limiter.wait(len(p))
+	}
+	n, err := r.r.Read(p)
+	sent := atomic.AddInt64(&r.u.sent, int64(n))
+	// Log every tenth of the file.
+	if r.u.size > 0 && sent-r.u.reported >= r.u.size/10 && sent < r.u.size {
+		r.u.reported = sent
+		rate := float64(sent) / time.Since(r.u.started).Seconds()
+		log.Printf("Sent %d%% of %s at %.0f bytes/s\n", sent*100/r.u.size, r.u.localFile, rate)
+	}
+	return n, err
+}
@@ -0,0 +1,60 @@
+package transfer
+
+import (
+	"bytes"
+	"io/ioutil"
+	"testing"
+	"time"
+)
+
+func TestRateSchedule(t *testing.T) {
+	l, err := newLimiter(&Config{
+		RateLimit: 100,
+		RateSchedule: []*RateWindow{
+			{From: "09:00", To: "18:00", RateLimit: 10},
+			{From: "23:00", To: "06:00", RateLimit: 0},
+		},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	for clock, want := range map[string]int64{
+		"08:59": 100,
+		"09:00": 10,
+		"17:59": 10,
+		"18:00": 100,
+		"23:30": 0,
+		"03:00": 0,
+	} {
+		now, _ := time.Parse("15:04", clock)
+		if rate := l.rate(now); rate != want {
+			t.Errorf("Rate at %s is %d, want %d", clock, rate, want)
+		}
+	}
+
+	if _, err := newLimiter(&Config{RateSchedule: []*RateWindow{{From: "9am", To: "18:00"}}}); err == nil {
+		t.Fatal("Accepted an invalid RateSchedule")
+	}
+}
+
+func TestUploadIsThrottled(t *testing.T) {
+	l, _ := newLimiter(&Config{RateLimit: 4000})
+	var s uploads
+	u := s.start("archive", 6000, 0, l)
+	defer u.finish()
+
+	start := time.Now()
+	n, err := ioutil.ReadAll(u.reader(bytes.NewReader(make([]byte, 6000))))
+	if err != nil {
+		t.Fatal(err)
+	}
+	// One second worth of bytes goes at once, the other 2000 at RateLimit,
+	// in 500ms. The delays are rounded to the nanosecond, hence a little slack.
+	want := 500*time.Millisecond - 10*time.Millisecond
+	if elapsed := time.Since(start); elapsed < want {
+		t.Fatalf("Read %d bytes in %v, want at least %v", len(n), elapsed, want)
+	}
+	if transfers := s.Transfers(); len(transfers) != 1 || transfers[0].Sent != 6000 {
+		t.Fatalf("Transfers %+v, want 6000 bytes sent", transfers)
+	}
+}
@@ -0,0 +1,180 @@
+package transfer
+
+import (
+	"context"
+	"crypto/md5"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/hex"
+	"errors"
+	"github.com/minio/minio-go/v7"
+	"github.com/minio/minio-go/v7/pkg/credentials"
+	"io"
+	"io/ioutil"
+	"log"
+	"strings"
+)
+
+// ChecksumMeta is the object metadata holding the hex sha256 of an archive.
+const ChecksumMeta = "Sha256"
+
+var (
+	// Parts of a multipart upload. S3 needs at least 5 MiB but the last.
+	DefaultPartSize = int64(64 * 1024 * 1024)
+)
+
+type S3Target struct {
+	core     *minio.Core
+	bucket   string
+	partSize int64
+	limiter  *limiter
+	uploads
+}
+
+// NewS3Target connects to an S3-compatible object store. The secret key is
+// read from SecretKeyFile.
+func NewS3Target(c *Config) (*S3Target, error) {
+	if len(c.Endpoint) == 0 || len(c.Bucket) == 0 {
+		return nil, errors.New("No Endpoint or Bucket for s3 target.")
+	}
+	l, err := newLimiter(c)
+	if err != nil {
+		log.Println(err)
+		return nil, err
+	}
+	secretKey := ""
+	if len(c.SecretKeyFile) > 0 {
+		key, err := ioutil.ReadFile(c.SecretKeyFile)
+		if err != nil {
+			log.Println(err)
+			return nil, err
+		}
+		secretKey = strings.TrimSpace(string(key))
+	}
+	region := c.Region
+	if len(region) == 0 {
+		region = "us-east-1"
+	}
+	core, err := minio.NewCore(c.Endpoint, &minio.Options{
+		Creds:        credentials.NewStaticV4(c.AccessKey, secretKey, ""),
+		Secure:       !c.Insecure,
+		Region:       region,
+		BucketLookup: minio.BucketLookupPath,
+	})
+	if err != nil {
+		log.Println(err)
+		return nil, err
+	}
+	partSize := c.PartSize
+	if partSize <= 0 {
+		partSize = DefaultPartSize
+	}
+	return &S3Target{core: core, bucket: c.Bucket, partSize: partSize, limiter: l}, nil
+}
+
+func objectName(remoteFile string) string {
+	return strings.TrimPrefix(remoteFile, "/")
+}
+
+// remoteChecksum reads an object back and hashes it, as the store has it,
+// or returns "" if the object does not exist. The checksum in its metadata
+// is only what Upload meant to store.
+func (t *S3Target) remoteChecksum(object string) (string, error) {
+	body, _, _, err := t.core.GetObject(context.Background(), t.bucket, object, minio.GetObjectOptions{})
+	if err != nil {
+		if minio.ToErrorResponse(err).Code == "NoSuchKey" {
+			return "", nil
+		}
+		return "", err
+	}
+	defer body.Close()
+	hash := sha256.New()
+	if _, err := io.Copy(hash, body); err != nil {
+		return "", err
+	}
+	return hex.EncodeToString(hash.Sum(nil)), nil
+}
+
+// Upload stores localFile with a multipart upload, with meta and the checksum
+// of the file as object metadata. Each part carries its MD5 and sha256 so the
+// store rejects corrupted parts. Objects already stored with the same
+// checksum are skipped.
+func (t *S3Target) Upload(localFile, remoteFile string, meta map[string]string) error {
+	sum, err := FileChecksum(localFile)
+	if err != nil {
+		return err
+	}
+	object := objectName(remoteFile)
+	remoteSum, err := t.remoteChecksum(object)
+	if err != nil {
+		return err
+	}
+	if remoteSum == sum {
+		log.Printf("%s is already in bucket %s\n", object, t.bucket)
+		return nil
+	}
+
+	f, size, err := openLocal(localFile, 0)
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+	u := t.start(localFile, size, 0, t.limiter)
+	defer u.finish()
+
+	userMetadata := map[string]string{ChecksumMeta: sum}
+	for k, v := range meta {
+		userMetadata[k] = v
+	}
+	ctx := context.Background()
+	uploadId, err := t.core.NewMultipartUpload(ctx, t.bucket, object, minio.PutObjectOptions{
+		UserMetadata: userMetadata,
+		ContentType:  "application/gzip",
+	})
+	if err != nil {
+		return err
+	}
+
+	// Parts are read from the file twice, to hash and to send them, so that
+	// concurrent uploads hold no part in memory.
+	parts := make([]minio.CompletePart, 0)
+	for partId, offset := 1, int64(0); partId == 1 || offset < size; partId, offset = partId+1, offset+t.partSize {
+		n := size - offset
+		if n > t.partSize {
+			n = t.partSize
+		}
+		md5Hash, sha256Hash := md5.New(), sha256.New()
+		_, err := io.Copy(io.MultiWriter(md5Hash, sha256Hash), io.NewSectionReader(f, offset, n))
+		if err != nil {
+			t.core.AbortMultipartUpload(ctx, t.bucket, object, uploadId)
+			return err
+		}
+		part, err := t.core.PutObjectPart(ctx, t.bucket, object, uploadId, partId,
+			u.reader(io.NewSectionReader(f, offset, n)), n, minio.PutObjectPartOptions{
+				Md5Base64: base64.StdEncoding.EncodeToString(md5Hash.Sum(nil)),
+				Sha256Hex: hex.EncodeToString(sha256Hash.Sum(nil)),
+			})
+		if err != nil {
+			t.core.AbortMultipartUpload(ctx, t.bucket, object, uploadId)
+			return err
+		}
+		parts = append(parts, minio.CompletePart{PartNumber: partId, ETag: part.ETag})
+	}
+
+	_, err = t.core.CompleteMultipartUpload(ctx, t.bucket, object, uploadId, parts, minio.PutObjectOptions{})
+	if err != nil {
+		t.core.AbortMultipartUpload(ctx, t.bucket, object, uploadId)
+		return err
+	}
+	log.Printf("Uploaded %d bytes %s -> %s/%s in %d parts\n", size, localFile, t.bucket, object, len(parts))
+	return nil
+}
+
+// Checksum reads the object back and hashes it.
+func (t *S3Target) Checksum(remoteFile string) (string, error) {
+	return t.remoteChecksum(objectName(remoteFile))
+}
+
+func (t *S3Target) Close() error {
+	return nil
+}
@@ -0,0 +1,195 @@
+package transfer
+
+import (
+	"crypto/md5"
+	"encoding/base64"
+	"encoding/hex"
+	"encoding/xml"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"testing"
+)
+
+type s3Object struct {
+	data []byte
+	meta http.Header
+}
+
+type s3Upload struct {
+	meta  http.Header
+	parts map[int][]byte
+}
+
+// s3Server is a stand-in for an S3-compatible store with just the calls
+// S3Target makes: GET of an object and multipart uploads.
+type s3Server struct {
+	lock    sync.Mutex
+	objects map[string]*s3Object
+	uploads map[string]*s3Upload
+	parts   int
+}
+
+func newS3Server() *s3Server {
+	return &s3Server{
+		objects: make(map[string]*s3Object),
+		uploads: make(map[string]*s3Upload),
+	}
+}
+
+func (s *s3Server) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	s.lock.Lock()
+	defer s.lock.Unlock()
+	key := r.URL.Path
+	query := r.URL.Query()
+	switch {
+	case r.Method == "GET":
+		o, ok := s.objects[key]
+		if !ok {
+			w.Header().Set("Content-Type", "application/xml")
+			w.WriteHeader(http.StatusNotFound)
+			fmt.Fprint(w, "<Error><Code>NoSuchKey</Code></Error>")
+			return
+		}
+		for k, v := range o.meta {
+			w.Header()[k] = v
+		}
+		w.Header().Set("ETag", `"object"`)
+		w.Header().Set("Last-Modified", "Mon, 19 Oct 2026 10:00:00 GMT")
+		w.Header().Set("Content-Length", strconv.Itoa(len(o.data)))
+		w.WriteHeader(http.StatusOK)
+		w.Write(o.data)
+	case r.Method == "POST" && query.Has("uploads"):
+		uploadId := strconv.Itoa(len(s.uploads) + 1)
+		meta := make(http.Header)
+		for k, v := range r.Header {
+			if strings.HasPrefix(k, "X-Amz-Meta-") {
+				meta[k] = v
+			}
+		}
+		s.uploads[uploadId] = &s3Upload{meta: meta, parts: make(map[int][]byte)}
+		fmt.Fprintf(w, "<InitiateMultipartUploadResult><Key>%s</Key><UploadId>%s</UploadId></InitiateMultipartUploadResult>", key, uploadId)
+	case r.Method == "PUT" && query.Has("uploadId"):
+		upload := s.uploads[query.Get("uploadId")]
+		body, _ := ioutil.ReadAll(r.Body)
+		sum := md5.Sum(body)
+		if upload == nil || r.Header.Get("Content-Md5") != base64.StdEncoding.EncodeToString(sum[:]) {
+			w.WriteHeader(http.StatusBadRequest)
+			return
+		}
+		partId, _ := strconv.Atoi(query.Get("partNumber"))
+		upload.parts[partId] = body
+		s.parts++
+		w.Header().Set("ETag", `"`+hex.EncodeToString(sum[:])+`"`)
+		w.WriteHeader(http.StatusOK)
+	case r.Method == "POST" && query.Has("uploadId"):
+		upload := s.uploads[query.Get("uploadId")]
+		complete := struct {
+			Parts []struct{ PartNumber int } `xml:"Part"`
+		}{}
+		body, _ := ioutil.ReadAll(r.Body)
+		if upload == nil || xml.Unmarshal(body, &complete) != nil {
+			w.WriteHeader(http.StatusBadRequest)
+			return
+		}
+		ids := make([]int, 0)
+		for _, p := range complete.Parts {
+			ids = append(ids, p.PartNumber)
+		}
+		sort.Ints(ids)
+		data := make([]byte, 0)
+		for _, id := range ids {
+			data = append(data, upload.parts[id]...)
+		}
+		s.objects[key] = &s3Object{data: data, meta: upload.meta}
+		delete(s.uploads, query.Get("uploadId"))
+		bucket := strings.Split(key, "/")[1]
+		fmt.Fprintf(w, `<CompleteMultipartUploadResult><Bucket>%s</Bucket><Key>%s</Key><ETag>"object"</ETag></CompleteMultipartUploadResult>`, bucket, key)
+	case r.Method == "DELETE" && query.Has("uploadId"):
+		delete(s.uploads, query.Get("uploadId"))
+		w.WriteHeader(http.StatusNoContent)
+	default:
+		w.WriteHeader(http.StatusNotImplemented)
+	}
+}
+
+func TestS3Upload(t *testing.T) {
+	dir, err := ioutil.TempDir("", "transfer")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	localFile := path.Join(dir, "100000000-100009999.tar.gz")
+	if err := ioutil.WriteFile(localFile, []byte("0123456789"), 0666); err != nil {
+		t.Fatal(err)
+	}
+
+	s := newS3Server()
+	server := httptest.NewServer(s)
+	defer server.Close()
+	c := &Config{
+		Type:       "s3",
+		Endpoint:   strings.TrimPrefix(server.URL, "http://"),
+		Bucket:     "avatars",
+		AccessKey:  "teleport",
+		Insecure:   true,
+		PartSize:   4,
+		RemotePath: "avatar_tars",
+	}
+	target, err := New(c)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer target.Close()
+
+	remoteFile := path.Join(c.RemoteFolder("Jiayuan"), path.Base(localFile))
+	meta := map[string]string{"Site": "Jiayuan", "Files": "3"}
+	if err := target.Upload(localFile, remoteFile, meta); err != nil {
+		t.Fatal(err)
+	}
+	o := s.objects["/avatars/avatar_tars/Jiayuan/100000000-100009999.tar.gz"]
+	if o == nil || string(o.data) != "0123456789" {
+		t.Fatalf("Stored %v, want 0123456789", o)
+	}
+	if s.parts != 3 {
+		t.Fatalf("Uploaded %d parts, want 3", s.parts)
+	}
+	if o.meta.Get("X-Amz-Meta-Site") != "Jiayuan" || o.meta.Get("X-Amz-Meta-Files") != "3" {
+		t.Fatalf("Stored metadata %v", o.meta)
+	}
+	sum, _ := FileChecksum(localFile)
+	if o.meta.Get("X-Amz-Meta-Sha256") != sum {
+		t.Fatalf("Stored checksum %q, want %q", o.meta.Get("X-Amz-Meta-Sha256"), sum)
+	}
+
+	// The same archive is skipped the second time.
+	if err := target.Upload(localFile, remoteFile, meta); err != nil {
+		t.Fatal(err)
+	}
+	if s.parts != 3 {
+		t.Fatalf("Uploaded %d parts, want no new part", s.parts)
+	}
+
+	// A corrupted object fails the checksum despite its metadata, and is
+	// uploaded again.
+	o.data = []byte("01234")
+	if remoteSum, err := target.Checksum(remoteFile); err != nil || remoteSum == sum {
+		t.Fatalf("Checksum of a truncated object is %q, %v", remoteSum, err)
+	}
+	if err := target.Upload(localFile, remoteFile, meta); err != nil {
+		t.Fatal(err)
+	}
+	if remoteSum, err := target.Checksum(remoteFile); err != nil || remoteSum != sum {
+		t.Fatalf("Checksum is %q, %v after uploading again, want %q", remoteSum, err, sum)
+	}
+	if remoteSum, err := target.Checksum("avatar_tars/Jiayuan/missing.tar.gz"); err != nil || remoteSum != "" {
+		t.Fatalf("Checksum of a missing object is %q, %v", remoteSum, err)
+	}
+}
@@ -0,0 +1,165 @@
+package transfer
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"github.com/pkg/sftp"
+	"golang.org/x/crypto/ssh"
+	"golang.org/x/crypto/ssh/agent"
+	"golang.org/x/crypto/ssh/knownhosts"
+	"io"
+	"io/ioutil"
+	"log"
+	"net"
+	"os"
+	"path"
+)
+
+type SftpTarget struct {
+	conn    *ssh.Client
+	client  *sftp.Client
+	agent   net.Conn
+	limiter *limiter
+	uploads
+}
+
+func authMethods(c *Config) ([]ssh.AuthMethod, net.Conn, error) {
+	if len(c.KeyFile) > 0 {
+		key, err := ioutil.ReadFile(c.KeyFile)
+		if err != nil {
+			return nil, nil, err
+		}
+		signer, err := ssh.ParsePrivateKey(key)
+		if err != nil {
+			return nil, nil, err
+		}
+		return []ssh.AuthMethod{ssh.PublicKeys(signer)}, nil, nil
+	}
+	sock := os.Getenv("SSH_AUTH_SOCK")
+	if len(sock) == 0 {
+		return nil, nil, errors.New("No KeyFile set and no ssh-agent running.")
+	}
+	conn, err := net.Dial("unix", sock)
+	if err != nil {
+		return nil, nil, err
+	}
+	return []ssh.AuthMethod{ssh.PublicKeysCallback(agent.NewClient(conn).Signers)}, conn, nil
+}
+
+func knownHostsFile(c *Config) string {
+	if len(c.KnownHosts) > 0 {
+		return c.KnownHosts
+	}
+	return path.Join(os.Getenv("HOME"), ".ssh", "known_hosts")
+}
+
+// NewSftpTarget connects to c.Host over SSH and verifies its host key
+// against the known_hosts file.
+func NewSftpTarget(c *Config) (*SftpTarget, error) {
+	l, err := newLimiter(c)
+	if err != nil {
+		log.Println(err)
+		return nil, err
+	}
+	hostKeyCallback, err := knownhosts.New(knownHostsFile(c))
+	if err != nil {
+		log.Println(err)
+		return nil, err
+	}
+	auth, agentConn, err := authMethods(c)
+	if err != nil {
+		log.Println(err)
+		return nil, err
+	}
+	clientConfig := &ssh.ClientConfig{
+		User:            c.User,
+		Auth:            auth,
+		HostKeyCallback: hostKeyCallback,
+	}
+	conn, err := ssh.Dial("tcp", c.Host, clientConfig)
+	if err != nil {
+		log.Printf("Failed to dial %s: %v\n", c.Host, err)
+		if agentConn != nil {
+			agentConn.Close()
+		}
+		return nil, err
+	}
+	client, err := sftp.NewClient(conn)
+	if err != nil {
+		log.Println(err)
+		conn.Close()
+		if agentConn != nil {
+			agentConn.Close()
+		}
+		return nil, err
+	}
+	return &SftpTarget{conn: conn, client: client, agent: agentConn, limiter: l}, nil
+}
+
+func (t *SftpTarget) Upload(localFile, remoteFile string, meta map[string]string) error {
+	f, size, err := openLocal(localFile, 0)
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+	u := t.start(localFile, size, 0, t.limiter)
+	defer u.finish()
+
+	err = t.client.MkdirAll(path.Dir(remoteFile))
+	if err != nil {
+		return err
+	}
+	partFile := remoteFile + ".part"
+	w, err := t.client.Create(partFile)
+	if err != nil {
+		return err
+	}
+	n, err := io.Copy(w, u.reader(f))
+	if closeErr := w.Close(); err == nil {
+		err = closeErr
+	}
+	if err == nil && n != size {
+		err = io.ErrShortWrite
+	}
+	if err != nil {
+		t.client.Remove(partFile)
+		return err
+	}
+	if _, ok := t.client.HasExtension("posix-rename@openssh.com"); ok {
+		err = t.client.PosixRename(partFile, remoteFile)
+	} else {
+		t.client.Remove(remoteFile)
+		err = t.client.Rename(partFile, remoteFile)
+	}
+	if err != nil {
+		return err
+	}
+	log.Printf("Uploaded %d bytes %s -> %s:%s\n", n, localFile, t.conn.RemoteAddr(), remoteFile)
+	return nil
+}
+
+// Checksum reads remoteFile back over SFTP and hashes it.
+func (t *SftpTarget) Checksum(remoteFile string) (string, error) {
+	f, err := t.client.Open(remoteFile)
+	if err != nil {
+		if os.IsNotExist(err) {
+			return "", nil
+		}
+		return "", err
+	}
+	defer f.Close()
+	hash := sha256.New()
+	if _, err := io.Copy(hash, f); err != nil {
+		return "", err
+	}
+	return hex.EncodeToString(hash.Sum(nil)), nil
+}
+
+func (t *SftpTarget) Close() error {
+	t.client.Close()
+	if t.agent != nil {
+		t.agent.Close()
+	}
+	return t.conn.Close()
+}
@@ -0,0 +1,182 @@
+package transfer
+
+import (
+	"crypto/ed25519"
+	"crypto/rand"
+	"encoding/pem"
+	"github.com/pkg/sftp"
+	"golang.org/x/crypto/ssh"
+	"golang.org/x/crypto/ssh/knownhosts"
+	"io/ioutil"
+	"net"
+	"os"
+	"path"
+	"testing"
+)
+
+// startSftpServer serves SFTP over SSH on a local port for the client key it
+// writes to dir, and returns a Config to reach it.
+func startSftpServer(t *testing.T, dir string) *Config {
+	_, hostPriv, err := ed25519.GenerateKey(rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+	hostSigner, err := ssh.NewSignerFromKey(hostPriv)
+	if err != nil {
+		t.Fatal(err)
+	}
+	clientPub, clientPriv, err := ed25519.GenerateKey(rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+	authorized, err := ssh.NewPublicKey(clientPub)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	serverConfig := &ssh.ServerConfig{
+		PublicKeyCallback: func(conn ssh.ConnMetadata, key ssh.PublicKey) (*ssh.Permissions, error) {
+			if string(key.Marshal()) == string(authorized.Marshal()) {
+				return nil, nil
+			}
+			return nil, ssh.ErrNoAuth
+		},
+	}
+	serverConfig.AddHostKey(hostSigner)
+
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	go func() {
+		for {
+			nConn, err := listener.Accept()
+			if err != nil {
+				return
+			}
+			go serveSsh(nConn, serverConfig)
+		}
+	}()
+	t.Cleanup(func() { listener.Close() })
+
+	block, err := ssh.MarshalPrivateKey(clientPriv, "")
+	if err != nil {
+		t.Fatal(err)
+	}
+	keyFile := path.Join(dir, "id_ed25519")
+	if err := ioutil.WriteFile(keyFile, pem.EncodeToMemory(block), 0600); err != nil {
+		t.Fatal(err)
+	}
+	host := listener.Addr().String()
+	knownHostsFile := path.Join(dir, "known_hosts")
+	line := knownhosts.Line([]string{knownhosts.Normalize(host)}, hostSigner.PublicKey())
+	if err := ioutil.WriteFile(knownHostsFile, []byte(line+"\n"), 0600); err != nil {
+		t.Fatal(err)
+	}
+
+	return &Config{
+		Type:       "sftp",
+		Host:       host,
+		User:       "teleport",
+		KeyFile:    keyFile,
+		KnownHosts: knownHostsFile,
+		RemotePath: path.Join(dir, "remote"),
+	}
+}
+
+func serveSsh(nConn net.Conn, config *ssh.ServerConfig) {
+	conn, chans, reqs, err := ssh.NewServerConn(nConn, config)
+	if err != nil {
+		return
+	}
+	defer conn.Close()
+	go ssh.DiscardRequests(reqs)
+	for newChannel := range chans {
+		if newChannel.ChannelType() != "session" {
+			newChannel.Reject(ssh.UnknownChannelType, "unknown channel type")
+			continue
+		}
+		channel, requests, err := newChannel.Accept()
+		if err != nil {
+			return
+		}
+		go func() {
+			for req := range requests {
+				// The payload of a subsystem request is the length prefixed name.
+				ok := req.Type == "subsystem" && string(req.Payload[4:]) == "sftp"
+				req.Reply(ok, nil)
+				if !ok {
+					continue
+				}
+				server, err := sftp.NewServer(channel)
+				if err != nil {
+					channel.Close()
+					return
+				}
+				server.Serve()
+				channel.Close()
+			}
+		}()
+	}
+}
+
+func TestSftpUpload(t *testing.T) {
+	dir, err := ioutil.TempDir("", "transfer")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	c := startSftpServer(t, dir)
+	localFile := path.Join(dir, "100000000-100009999.tar.gz")
+	if err := ioutil.WriteFile(localFile, []byte("archive"), 0666); err != nil {
+		t.Fatal(err)
+	}
+
+	target, err := New(c)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer target.Close()
+
+	remoteFile := path.Join(c.RemoteFolder("Jiayuan"), path.Base(localFile))
+	if err := target.Upload(localFile, remoteFile, nil); err != nil {
+		t.Fatal(err)
+	}
+	data, err := ioutil.ReadFile(remoteFile)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if string(data) != "archive" {
+		t.Fatalf("Uploaded %q, want archive", data)
+	}
+	sum, _ := FileChecksum(localFile)
+	if remoteSum, err := target.Checksum(remoteFile); err != nil || remoteSum != sum {
+		t.Fatalf("Remote checksum %q, %v, want %q", remoteSum, err, sum)
+	}
+	if remoteSum, err := target.Checksum(remoteFile + ".missing"); err != nil || remoteSum != "" {
+		t.Fatalf("Checksum of a missing file %q, %v", remoteSum, err)
+	}
+}
+
+func TestSftpRejectsUnknownHost(t *testing.T) {
+	dir, err := ioutil.TempDir("", "transfer")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	c := startSftpServer(t, dir)
+	other, err := ioutil.TempDir("", "transfer")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(other)
+	// The known_hosts of another server does not list this one's key.
+	c.KnownHosts = startSftpServer(t, other).KnownHosts
+
+	if target, err := New(c); err == nil {
+		target.Close()
+		t.Fatal("Connected to a host missing from known_hosts")
+	}
+}
@@ -0,0 +1,119 @@
+package transfer
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"io"
+	"os"
+	"path"
+)
+
+// Target is a place teleport ships finished archives to.
+type Target interface {
+	// Upload copies localFile to remoteFile on the target. A partially
+	// uploaded file never shows up under remoteFile. Targets that can store
+	// metadata keep meta with the file.
+	Upload(localFile, remoteFile string, meta map[string]string) error
+	// Checksum returns the hex sha256 of remoteFile as the target sees it,
+	// or "" if there is no such file.
+	Checksum(remoteFile string) (string, error)
+	// Transfers returns the progress of the uploads running now.
+	Transfers() []Transfer
+	Close() error
+}
+
+// Config describes a transfer target in teleport.status.
+type Config struct {
+	// Type of the target, "sftp", "http" or "s3".
+	Type string
+	// Host as host:port.
+	Host string
+	User string
+	// KeyFile is a private key file. Keys of the running ssh-agent are used
+	// when it is empty.
+	KeyFile string
+	// KnownHosts verifies the host key. Defaults to ~/.ssh/known_hosts.
+	KnownHosts string
+	// RemotePath is the folder archives go to. Each site uses a subfolder
+	// unless it is listed in SiteRemotePaths.
+	RemotePath      string
+	SiteRemotePaths map[string]string
+
+	// URL is the base URL of an "http" target. Archives are PUT under it.
+	URL string
+	// TokenFile holds the bearer token of an "http" target.
+	TokenFile string
+
+	// Endpoint as host:port and Bucket of an "s3" target. Objects are
+	// named after the remote file.
+	Endpoint      string
+	Bucket        string
+	Region        string
+	AccessKey     string
+	SecretKeyFile string
+	// Insecure talks plain http to the endpoint.
+	Insecure bool
+	// PartSize of multipart uploads in bytes.
+	PartSize int64
+
+	// RateLimit caps the bandwidth of all uploads in bytes/sec, 0 for
+	// none. The first window of RateSchedule covering the time of day
+	// overrides it.
+	RateLimit    int64
+	RateSchedule []*RateWindow
+	// Concurrency is how many archives teleport uploads at once.
+	Concurrency int
+}
+
+// RemoteFolder returns the remote folder of the archives of site.
+func (c *Config) RemoteFolder(site string) string {
+	if p, ok := c.SiteRemotePaths[site]; ok {
+		return p
+	}
+	return path.Join(c.RemotePath, site)
+}
+
+// New connects to the target described by c.
+func New(c *Config) (Target, error) {
+	switch c.Type {
+	case "sftp":
+		return NewSftpTarget(c)
+	case "http":
+		return NewHttpTarget(c)
+	case "s3":
+		return NewS3Target(c)
+	}
+	return nil, errors.New("Invalid transfer target type " + c.Type)
+}
+
+// openLocal opens a local file to upload from offset and returns its size.
+func openLocal(localFile string, offset int64) (*os.File, int64, error) {
+	f, err := os.Open(localFile)
+	if err != nil {
+		return nil, 0, err
+	}
+	info, err := f.Stat()
+	if err == nil && offset > 0 {
+		_, err = f.Seek(offset, io.SeekStart)
+	}
+	if err != nil {
+		f.Close()
+		return nil, 0, err
+	}
+	return f, info.Size(), nil
+}
+
+// FileChecksum returns the hex sha256 of a local file.
+func FileChecksum(localFile string) (string, error) {
+	f, err := os.Open(localFile)
+	if err != nil {
+		return "", err
+	}
+	defer f.Close()
+	hash := sha256.New()
+	if _, err := io.Copy(hash, f); err != nil {
+		return "", err
+	}
+	return hex.EncodeToString(hash.Sum(nil)), nil
+}
@@ -0,0 +1,75 @@
+package util
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"syscall"
+)
+
+// SyncDir flushes a directory so that files created or renamed in it survive
+// a crash.
+func SyncDir(dir string) error {
+	d, err := os.Open(dir)
+	if err != nil {
+		return err
+	}
+	defer d.Close()
+	return d.Sync()
+}
+
+// WriteFileAtomic writes data to a temporary file next to filename, syncs it
+// and renames it over filename, so readers see either the old or the new
+// content but never a partial write.
+func WriteFileAtomic(filename string, data []byte, perm os.FileMode) error {
+	dir := filepath.Dir(filename)
+	f, err := ioutil.TempFile(dir, filepath.Base(filename)+".tmp")
+	if err != nil {
+		return err
+	}
+	tmp := f.Name()
+	_, err = f.Write(data)
+	if err == nil {
+		err = f.Sync()
+	}
+	if closeErr := f.Close(); err == nil {
+		err = closeErr
+	}
+	if err == nil {
+		err = os.Chmod(tmp, perm)
+	}
+	if err == nil {
+		err = os.Rename(tmp, filename)
+	}
+	if err != nil {
+		os.Remove(tmp)
+		return err
+	}
+	return SyncDir(dir)
+}
+
+// LockFile takes an exclusive lock on filename, creating it if needed. The
+// lock is held until the returned file is closed or the process exits, so a
+// crashed holder never leaves it stale.
+func LockFile(filename string) (*os.File, error) {
+	return lockFile(filename, syscall.LOCK_EX|syscall.LOCK_NB)
+}
+
+// WaitLockFile takes the lock of LockFile, waiting for its holder to release
+// it. Holders in the same process wait for each other too.
+func WaitLockFile(filename string) (*os.File, error) {
+	return lockFile(filename, syscall.LOCK_EX)
+}
+
+func lockFile(filename string, how int) (*os.File, error) {
+	f, err := os.OpenFile(filename, os.O_RDWR|os.O_CREATE, 0666)
+	if err != nil {
+		return nil, err
+	}
+	err = syscall.Flock(int(f.Fd()), how)
+	if err != nil {
+		f.Close()
+		return nil, err
+	}
+	return f, nil
+}
@@ -0,0 +1,126 @@
+package util
+
+import (
+	"sync"
+)
+
+// Limiter bounds how many goroutines run at once, as Semaphore and the
+// members of a Pool do.
+type Limiter interface {
+	Acquire()
+	Release()
+}
+
+// Pool shares its slots among members by weight. A free slot goes to the
+// waiting member holding the fewest slots for its weight, the one served
+// least recently on a tie, so busy members end up with slots in proportion
+// to their weights, while a member with nothing to do leaves its share to
+// the others.
+type Pool struct {
+	lock    sync.Mutex
+	cond    *sync.Cond
+	size    int
+	used    int
+	grants  int
+	members []*Member
+	// asked, when set, is called with p.lock held whenever a member asks
+	// for a slot, so tests know who waits.
+	asked func(m *Member)
+}
+
+// Member is the part of a Pool one user gets.
+type Member struct {
+	pool    *Pool
+	weight  int
+	used    int
+	waiting int
+	// served is when m last got a slot, counting the grants of the pool.
+	served int
+}
+
+func NewPool(size int) *Pool {
+	p := &Pool{size: size}
+	p.cond = sync.NewCond(&p.lock)
+	return p
+}
+
+// Join adds a member of weight, at least 1, to p.
+func (p *Pool) Join(weight int) *Member {
+	if weight < 1 {
+		weight = 1
+	}
+	p.lock.Lock()
+	defer p.lock.Unlock()
+	m := &Member{pool: p, weight: weight}
+	p.members = append(p.members, m)
+	return m
+}
+
+// Resize sets how many slots p has from now on.
+func (p *Pool) Resize(size int) {
+	p.lock.Lock()
+	defer p.lock.Unlock()
+	p.size = size
+	p.cond.Broadcast()
+}
+
+// next is the waiting member to get the next slot. p.lock must be held.
+func (p *Pool) next() *Member {
+	var best *Member
+	for _, m := range p.members {
+		if m.waiting == 0 {
+			continue
+		}
+		if best == nil {
+			best = m
+			continue
+		}
+		if a, b := m.used*best.weight, best.used*m.weight; a < b || (a == b && m.served < best.served) {
+			best = m
+		}
+	}
+	return best
+}
+
+func (m *Member) Acquire() {
+	p := m.pool
+	p.lock.Lock()
+	defer p.lock.Unlock()
+	m.waiting++
+	if p.asked != nil {
+		p.asked(m)
+	}
+	for p.used >= p.size || p.next() != m {
+		p.cond.Wait()
+	}
+	m.waiting--
+	m.used++
+	p.used++
+	p.grants++
+	m.served = p.grants
+	// Another member may be next now.
+	p.cond.Broadcast()
+}
+
+func (m *Member) Release() {
+	p := m.pool
+	p.lock.Lock()
+	defer p.lock.Unlock()
+	m.used--
+	p.used--
+	p.cond.Broadcast()
+}
+
+// Leave removes m from its pool once it holds no slot.
+func (m *Member) Leave() {
+	p := m.pool
+	p.lock.Lock()
+	defer p.lock.Unlock()
+	for i, member := range p.members {
+		if member == m {
+			p.members = append(p.members[:i], p.members[i+1:]...)
+			break
+		}
+	}
+	p.cond.Broadcast()
+}
@@ -0,0 +1,90 @@
+package util
+
+import (
+	"testing"
+)
+
+// acquireAll makes each of members ask for a slot in its own goroutine, once
+// every member holds what it asked for before, and returns the channel the
+// members are sent to as they get their slot. It returns once all asked.
+func acquireAll(p *Pool, members []*Member) <-chan *Member {
+	asked := make(chan bool, len(members))
+	p.lock.Lock()
+	p.asked = func(*Member) { asked <- true }
+	p.lock.Unlock()
+	got := make(chan *Member, len(members))
+	for _, m := range members {
+		go func(m *Member) {
+			m.Acquire()
+			got <- m
+		}(m)
+	}
+	for range members {
+		<-asked
+	}
+	return got
+}
+
+// expectGrants checks the next slots given out go to want, in order, and
+// that no other member got one.
+func expectGrants(t *testing.T, got <-chan *Member, names map[*Member]string, want ...*Member) {
+	for _, w := range want {
+		if m := <-got; m != w {
+			t.Fatalf("%s got the slot, want %s", names[m], names[w])
+		}
+	}
+	select {
+	case m := <-got:
+		t.Fatalf("%s got a slot, want none", names[m])
+	default:
+	}
+}
+
+func TestPoolSharesByWeight(t *testing.T) {
+	p := NewPool(4)
+	slow, fast := p.Join(1), p.Join(3)
+	names := map[*Member]string{slow: "slow", fast: "fast"}
+
+	// The slow member takes every slot while alone.
+	for i := 0; i < 4; i++ {
+		slow.Acquire()
+	}
+	members := make([]*Member, 0)
+	for i := 0; i < 4; i++ {
+		members = append(members, slow, fast)
+	}
+	got := acquireAll(p, members)
+
+	// Freed slots go to the fast member until it has its 3 of 4.
+	for i := 0; i < 3; i++ {
+		slow.Release()
+	}
+	expectGrants(t, got, names, fast, fast, fast)
+
+	// Then both get slots as they are freed, in proportion.
+	slow.Release()
+	expectGrants(t, got, names, slow)
+
+	held := map[*Member]int{slow: 1, fast: 3}
+	p.Resize(100)
+	for i := 0; i < 4; i++ {
+		held[<-got]++
+	}
+	if held[fast] != 4 || held[slow] != 4 {
+		t.Fatalf("After Resize fast has %d and slow %d, want 4 each", held[fast], held[slow])
+	}
+}
+
+func TestPoolTakesTurnsOnTies(t *testing.T) {
+	p := NewPool(1)
+	first, second := p.Join(1), p.Join(1)
+	names := map[*Member]string{first: "first", second: "second"}
+	first.Acquire()
+	got := acquireAll(p, []*Member{first, second})
+
+	// Both hold nothing; second was never served.
+	first.Release()
+	expectGrants(t, got, names, second)
+	second.Release()
+	expectGrants(t, got, names, first)
+}